@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/maclon-lee/golanglib/lib/config"
+
+	//引入框架各模块的配置节点结构（不建立连接），注册各配置节点的校验结构
+	_ "github.com/maclon-lee/golanglib/lib/alert/schema"
+	_ "github.com/maclon-lee/golanglib/lib/cache/redis/schema"
+	_ "github.com/maclon-lee/golanglib/lib/elastic_v6/schema"
+	_ "github.com/maclon-lee/golanglib/lib/elastic_v7/schema"
+	_ "github.com/maclon-lee/golanglib/lib/httpd/schema"
+	_ "github.com/maclon-lee/golanglib/lib/log/schema"
+	_ "github.com/maclon-lee/golanglib/lib/mongodb/schema"
+	_ "github.com/maclon-lee/golanglib/lib/mq/kafka/schema"
+	_ "github.com/maclon-lee/golanglib/lib/mq/rabbitmq/schema"
+	_ "github.com/maclon-lee/golanglib/lib/sql/schema"
+)
+
+func init() {
+	register("config", "check", "[-c 配置文件]", configCheck)
+	register("config", "dump", "[-c 配置文件] [-key 节点]", configDump)
+	register("config", "encrypt", "明文", configEncrypt)
+}
+
+//内部方法：解析配置文件参数
+func configOptions(fs *flag.FlagSet, args []string) ([]config.Option, error) {
+	file := fs.String("c", "", "配置文件路径，默认按GOLANGLIB_CONFIG和默认路径查找")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	var opts []config.Option
+	if *file != "" {
+		opts = append(opts, config.WithFile(*file))
+	}
+	return opts, nil
+}
+
+//内部方法：解析通用参数并加载配置
+func loadConfig(fs *flag.FlagSet, args []string) error {
+	opts, err := configOptions(fs, args)
+	if err != nil {
+		return err
+	}
+	return config.Load(opts...)
+}
+
+//校验配置，存在问题时返回非0退出码，可用于CI
+func configCheck(args []string) error {
+	fs := flag.NewFlagSet("config check", flag.ContinueOnError)
+	opts, err := configOptions(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if err = config.Check(opts...); err != nil {
+		return err
+	}
+	fmt.Println("配置校验通过")
+	return nil
+}
+
+//输出生效的配置
+func configDump(args []string) error {
+	fs := flag.NewFlagSet("config dump", flag.ContinueOnError)
+	key := fs.String("key", "", "配置节点，默认输出全部")
+	if err := loadConfig(fs, args); err != nil {
+		return err
+	}
+
+	out, err := config.Dump(*key)
+	if err != nil {
+		return err
+	}
+	fmt.Println(out)
+	return nil
+}
+
+//加密配置值
+func configEncrypt(args []string) error {
+	if len(args) != 1 {
+		return errors.New("用法: golanglib config encrypt 明文")
+	}
+
+	out, err := config.EncryptSecret(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Println(out)
+	return nil
+}
@@ -0,0 +1,69 @@
+/**
+golanglib 命令行工具
+
+用法：
+  golanglib config check   [-c 配置文件]           校验配置
+  golanglib config dump    [-c 配置文件] [-key 节点] 输出生效的配置（敏感信息已屏蔽）
+  golanglib config encrypt 明文                     加密配置值（主密钥取自环境变量GOLANGLIB_MASTER_KEY）
+  golanglib sql reverse -db 数据库 [-out models] [-tables 表名] [-repo]  按表结构生成Go实体代码
+  golanglib sql reshard create|copy|verify|cutover -db 数据库 -table 表名  分表迁移（新规则取自splitTables.reshard）
+  golanglib migrate status|up|down|redo -db 数据库 [-dir migrations] [-n 数量]  数据库结构迁移
+**/
+package main
+
+import (
+	"fmt"
+	logger "github.com/maclon-lee/golanglib/lib/log"
+	"os"
+	"sort"
+	"strings"
+)
+
+//子命令
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+//命令分组，如config、sql
+var groups = map[string]map[string]command{}
+
+//内部方法：注册子命令
+func register(group string, name string, usage string, run func(args []string) error) {
+	if _, ok := groups[group]; !ok {
+		groups[group] = make(map[string]command)
+	}
+	groups[group][name] = command{usage: usage, run: run}
+}
+
+func main() {
+	if len(os.Args) < 3 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	cmd, ok := groups[os.Args[1]][os.Args[2]]
+	if !ok {
+		printUsage()
+		os.Exit(2)
+	}
+
+	err := cmd.run(os.Args[3:])
+	logger.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+//内部方法：输出用法
+func printUsage() {
+	var lines []string
+	for g, cmds := range groups {
+		for n, c := range cmds {
+			lines = append(lines, fmt.Sprintf("  golanglib %s %s %s", g, n, c.usage))
+		}
+	}
+	sort.Strings(lines)
+	fmt.Fprintf(os.Stderr, "用法:\n%s\n", strings.Join(lines, "\n"))
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/maclon-lee/golanglib/lib/sql"
+	"github.com/maclon-lee/golanglib/lib/sql/migrate"
+)
+
+func init() {
+	usage := "-db 数据库 [-dir migrations] [-c 配置文件]"
+	register("migrate", "status", usage, migrateStatus)
+	register("migrate", "up", usage+" [-n 0]", migrateUp)
+	register("migrate", "down", usage+" [-n 1]", migrateDown)
+	register("migrate", "redo", usage, migrateRedo)
+}
+
+//内部方法：解析参数并构建迁移执行器，n为-n参数的默认值
+func newMigrator(name string, args []string, n int) (*migrate.Migrator, int, context.Context, func(), error) {
+	fs := flag.NewFlagSet("migrate "+name, flag.ContinueOnError)
+	db := fs.String("db", "", "数据库名称，对应dbs.db的name")
+	dir := fs.String("dir", "migrations", "迁移文件目录，文件名为 版本_名称.up.sql、版本_名称.down.sql")
+	steps := fs.Int("n", n, "执行的数量，up时0为全部")
+	if err := loadConfig(fs, args); err != nil {
+		return nil, 0, nil, nil, err
+	}
+	if *db == "" {
+		return nil, 0, nil, nil, errors.New("-db不能为空")
+	}
+
+	dtx, err := sql.GetContext(*db)
+	if err != nil {
+		return nil, 0, nil, nil, fmt.Errorf("数据库%s: %s", *db, err)
+	}
+	m := migrate.New(dtx)
+	if err = m.LoadDir(*dir); err != nil {
+		return nil, 0, nil, nil, err
+	}
+	m.Logf = func(format string, a ...interface{}) {
+		fmt.Printf(format+"\n", a...)
+	}
+
+	//中断时在当前迁移完成后停止
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		cancel()
+	}()
+	return m, *steps, ctx, cancel, nil
+}
+
+//迁移状态
+func migrateStatus(args []string) error {
+	m, _, ctx, cancel, err := newMigrator("status", args, 0)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	list, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range list {
+		status, at := "pending", ""
+		if s.Applied {
+			status, at = "applied", s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		if s.Missing {
+			status = "missing"
+		} else if s.Changed {
+			status = "changed"
+		}
+		fmt.Printf("%-8s %d_%s %s\n", status, s.Version, s.Name, at)
+	}
+	return nil
+}
+
+//执行未执行的迁移
+func migrateUp(args []string) error {
+	m, steps, ctx, cancel, err := newMigrator("up", args, 0)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	n, err := m.Up(ctx, steps)
+	fmt.Printf("已执行%d个迁移\n", n)
+	return err
+}
+
+//回滚最后执行的迁移
+func migrateDown(args []string) error {
+	m, steps, ctx, cancel, err := newMigrator("down", args, 1)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	n, err := m.Down(ctx, steps)
+	fmt.Printf("已回滚%d个迁移\n", n)
+	return err
+}
+
+//回滚并重新执行最后一个迁移
+func migrateRedo(args []string) error {
+	m, _, ctx, cancel, err := newMigrator("redo", args, 0)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	return m.Redo(ctx)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/maclon-lee/golanglib/lib/sql"
+)
+
+func init() {
+	register("sql", "reverse", "-db 数据库 [-c 配置文件] [-out models] [-pkg models] [-tables 表1,表2] [-repo]", sqlReverse)
+	register("sql", "reshard", "create|copy|verify|cutover -db 数据库 -table 表名 [-c 配置文件] [-batch 1000] [-parallel 1] [-restart]", sqlReshard)
+}
+
+//分表迁移，新分表规则取自dbs.db.splitTables.reshard节点
+func sqlReshard(args []string) error {
+	if len(args) == 0 {
+		return errors.New("用法: golanglib sql reshard create|copy|verify|cutover -db 数据库 -table 表名")
+	}
+	step := args[0]
+
+	fs := flag.NewFlagSet("sql reshard", flag.ContinueOnError)
+	db := fs.String("db", "", "数据库名称，对应dbs.db的name")
+	table := fs.String("table", "", "分表配置的表名")
+	batch := fs.Int("batch", 1000, "单批复制行数")
+	parallel := fs.Int("parallel", 1, "并发处理的原分表数")
+	restart := fs.Bool("restart", false, "copy时忽略已有进度重新复制")
+	if err := loadConfig(fs, args[1:]); err != nil {
+		return err
+	}
+	if *db == "" || *table == "" {
+		return errors.New("-db和-table不能为空")
+	}
+
+	dtx, err := sql.GetContext(*db)
+	if err != nil {
+		return fmt.Errorf("数据库%s: %s", *db, err)
+	}
+	r, err := sql.NewResharder(dtx, *table)
+	if err != nil {
+		return err
+	}
+	r.BatchSize = *batch
+	r.Parallel = *parallel
+	r.Logf = func(format string, a ...interface{}) {
+		fmt.Printf(format+"\n", a...)
+	}
+
+	//中断时在当前批次提交后停止，再次执行copy从进度处继续
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	switch step {
+	case "create":
+		return r.CreateTables(ctx)
+	case "copy":
+		return r.Copy(ctx, *restart)
+	case "verify":
+		reports, err := r.Verify(ctx)
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, rep := range reports {
+			status := "OK"
+			if !rep.OK() {
+				status = "MISMATCH"
+				failed++
+			}
+			fmt.Printf("%-8s %s 行数 %d/%d 校验和 %d/%d\n", status, rep.Table, rep.ActualCount, rep.ExpectedCount, rep.ActualChecksum, rep.ExpectedChecksum)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d个分表校验不一致", failed)
+		}
+		fmt.Println("校验通过")
+		return nil
+	case "cutover":
+		if err := r.Cutover(ctx); err != nil {
+			return err
+		}
+		fmt.Println("切换完成，请将splitTables.policy改为新规则并删除reshard节点")
+		return nil
+	}
+	return fmt.Errorf("不支持的步骤:%s", step)
+}
+
+//按数据库表结构生成Go实体代码
+func sqlReverse(args []string) error {
+	fs := flag.NewFlagSet("sql reverse", flag.ContinueOnError)
+	db := fs.String("db", "", "数据库名称，对应dbs.db的name")
+	out := fs.String("out", "models", "输出目录")
+	pkg := fs.String("pkg", "", "包名，默认为输出目录名")
+	tables := fs.String("tables", "", "只生成指定的表，逗号分隔，分表为配置的表名")
+	repo := fs.Bool("repo", false, "生成Get/Inserts/Update/Delete仓储方法")
+	if err := loadConfig(fs, args); err != nil {
+		return err
+	}
+	if *db == "" {
+		return errors.New("-db不能为空")
+	}
+
+	dtx, err := sql.GetContext(*db)
+	if err != nil {
+		return fmt.Errorf("数据库%s: %s", *db, err)
+	}
+	conf := sql.ReverseConf{Package: *pkg, Repository: *repo}
+	if conf.Package == "" {
+		conf.Package = filepath.Base(*out)
+	}
+	if *tables != "" {
+		conf.Tables = strings.Split(*tables, ",")
+	}
+	files, err := dtx.Reverse(conf)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(*out, 0755); err != nil {
+		return err
+	}
+	for name, code := range files {
+		path := filepath.Join(*out, name)
+		if err = ioutil.WriteFile(path, code, 0644); err != nil {
+			return err
+		}
+		fmt.Println(path)
+	}
+	return nil
+}
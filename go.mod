@@ -3,22 +3,27 @@ module github.com/maclon-lee/golanglib
 go 1.15
 
 require (
+	github.com/ClickHouse/clickhouse-go v1.5.4
 	github.com/Shopify/sarama v1.27.2
 	github.com/aliyun/aliyun-log-go-sdk v0.1.16
 	github.com/denisenkom/go-mssqldb v0.9.0
 	github.com/elastic/go-elasticsearch/v6 v6.8.10
 	github.com/elastic/go-elasticsearch/v7 v7.17.10
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/gin-contrib/pprof v1.3.0
 	github.com/gin-gonic/gin v1.6.3
+	github.com/go-playground/validator/v10 v10.2.0
 	github.com/go-redis/redis v6.15.9+incompatible
 	github.com/go-sql-driver/mysql v1.5.0
 	github.com/json-iterator/go v1.1.10
 	github.com/lib/pq v1.7.0
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/spf13/viper v1.7.1
 	github.com/streadway/amqp v0.0.0-20190827072141-edfb9018d271
 	github.com/unknwon/com v1.0.1
 	go.mongodb.org/mongo-driver v1.4.7
 	go.uber.org/zap v1.16.0
 	gopkg.in/guregu/null.v3 v3.5.0
+	xorm.io/builder v0.3.7
 	xorm.io/xorm v1.0.5
 )
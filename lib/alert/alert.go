@@ -0,0 +1,304 @@
+package alert
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"github.com/maclon-lee/golanglib/lib/utility"
+	syslog "log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+//报警消息
+type Message struct {
+	Title       string    //标题，默认为 环境(主机名)
+	Content     string    //内容
+	Source      string    //报警位置，file:line
+	Fingerprint string    //去重标识，为空时按Source和Content（忽略数字）生成
+	Time        time.Time //最后发生时间
+
+	Count  int           //窗口内发生次数，首次发送为1
+	First  time.Time     //窗口内首次发生时间
+	Window time.Duration //合并窗口
+}
+
+//报警通道，DingTalk、WeCom、Feishu、Webhook、Email均实现此接口
+type Notifier interface {
+	Notify(ctx context.Context, msg *Message) error
+}
+
+//函数形式的报警通道
+type NotifierFunc func(ctx context.Context, msg *Message) error
+
+func (f NotifierFunc) Notify(ctx context.Context, msg *Message) error {
+	return f(ctx, msg)
+}
+
+//报警内容中的数字，生成去重标识时忽略
+var digits = regexp.MustCompile(`\d+`)
+
+//报警选项
+type Options struct {
+	Window    time.Duration //同一报警合并窗口，窗口内重复发生的报警在窗口结束时汇总发送一次，默认60秒
+	RateLimit int           //每分钟最多发送条数，超出的报警延后合并发送，0为不限
+	MaxLength int           //内容最大字符数，超出截断，默认4000
+	Timeout   time.Duration //单次发送超时，默认10秒
+	OnError   func(err error)
+}
+
+//报警器，按去重标识合并报警并限流，可并发使用
+type Alerter struct {
+	notifiers []Notifier
+	opts      Options
+
+	mu     sync.Mutex
+	states map[string]*state
+	sent   []time.Time //最近一分钟的发送时间，用于限流
+	closed bool
+	now    func() time.Time
+
+	//发送中的数量，Wait可与定时汇总并发调用，不使用WaitGroup
+	inflight int
+	idle     *sync.Cond
+}
+
+//同一去重标识的报警状态
+type state struct {
+	msg     *Message    //最近一次报警
+	pending int         //未发送的次数
+	first   time.Time   //未发送报警的首次发生时间
+	timer   *time.Timer //窗口结束时汇总发送
+}
+
+/*
+* 构建报警器
+*
+* param  opts       报警选项
+* param  notifiers  报警通道，同一报警发送到全部通道
+* return 报警器
+ */
+func New(opts Options, notifiers ...Notifier) *Alerter {
+	if opts.Window <= 0 {
+		opts.Window = time.Minute
+	}
+	if opts.MaxLength <= 0 {
+		opts.MaxLength = 4000
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.OnError == nil {
+		opts.OnError = func(err error) {
+			syslog.Printf("alert error: %s", err)
+		}
+	}
+	return &Alerter{
+		notifiers: notifiers,
+		opts:      opts,
+		states:    make(map[string]*state),
+		now:       time.Now,
+		idle:      sync.NewCond(&sync.Mutex{}),
+	}
+}
+
+/*
+* 发送报警，首次发生立即发送，窗口内重复发生的合并为一条汇总
+*
+* param  msg  报警消息
+ */
+func (a *Alerter) Send(msg Message) {
+	if len(a.notifiers) == 0 {
+		return
+	}
+
+	now := a.now()
+	if msg.Time.IsZero() {
+		msg.Time = now
+	}
+	if msg.Fingerprint == "" {
+		msg.Fingerprint = Fingerprint(msg.Source, msg.Content)
+	}
+	msg.Content = truncate(msg.Content, a.opts.MaxLength)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return
+	}
+
+	st, ok := a.states[msg.Fingerprint]
+	if !ok {
+		st = &state{}
+		a.states[msg.Fingerprint] = st
+	}
+	m := msg
+	st.msg = &m
+	if st.pending == 0 {
+		st.first = msg.Time
+	}
+	st.pending++
+
+	//窗口内已发送过，等待窗口结束汇总
+	if st.timer != nil {
+		return
+	}
+	a.flush(msg.Fingerprint, st, now)
+}
+
+//内部方法：发送未发送的报警并开始新窗口，需持有锁
+func (a *Alerter) flush(fp string, st *state, now time.Time) {
+	if st.pending > 0 && a.allow(now) {
+		m := *st.msg
+		m.Count = st.pending
+		m.First = st.first
+		m.Window = a.opts.Window
+		st.pending = 0
+		a.dispatch(&m)
+	} else if st.pending == 0 {
+		//窗口内没有新的报警，结束
+		delete(a.states, fp)
+		st.timer = nil
+		return
+	}
+
+	st.timer = time.AfterFunc(a.opts.Window, func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.closed || a.states[fp] != st {
+			return
+		}
+		a.flush(fp, st, a.now())
+	})
+}
+
+//内部方法：限流检查，需持有锁
+func (a *Alerter) allow(now time.Time) bool {
+	if a.opts.RateLimit <= 0 {
+		return true
+	}
+	cutoff := now.Add(-time.Minute)
+	i := 0
+	for i < len(a.sent) && !a.sent[i].After(cutoff) {
+		i++
+	}
+	a.sent = a.sent[i:]
+	if len(a.sent) >= a.opts.RateLimit {
+		return false
+	}
+	a.sent = append(a.sent, now)
+	return true
+}
+
+//内部方法：异步发送到全部通道
+func (a *Alerter) dispatch(msg *Message) {
+	for _, n := range a.notifiers {
+		a.idle.L.Lock()
+		a.inflight++
+		a.idle.L.Unlock()
+
+		go func(n Notifier) {
+			defer func() {
+				a.idle.L.Lock()
+				a.inflight--
+				if a.inflight == 0 {
+					a.idle.Broadcast()
+				}
+				a.idle.L.Unlock()
+			}()
+			defer func() {
+				if r := recover(); r != nil {
+					a.opts.OnError(fmt.Errorf("%v", r))
+				}
+			}()
+
+			ctx, cancel := context.WithTimeout(context.Background(), a.opts.Timeout)
+			defer cancel()
+			if err := n.Notify(ctx, msg); err != nil {
+				a.opts.OnError(err)
+			}
+		}(n)
+	}
+}
+
+//等待发送中的报警完成
+func (a *Alerter) Wait() {
+	a.idle.L.Lock()
+	for a.inflight > 0 {
+		a.idle.Wait()
+	}
+	a.idle.L.Unlock()
+}
+
+//关闭报警器，发送窗口内未发送的汇总（不受限流限制），并等待发送完成
+func (a *Alerter) Close() {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		for fp, st := range a.states {
+			if st.timer != nil {
+				st.timer.Stop()
+			}
+			if st.pending > 0 {
+				m := *st.msg
+				m.Count = st.pending
+				m.First = st.first
+				m.Window = a.opts.Window
+				a.dispatch(&m)
+			}
+			delete(a.states, fp)
+		}
+	}
+	a.mu.Unlock()
+	a.Wait()
+}
+
+/*
+* 生成去重标识，内容中的数字不参与计算，如订单号、耗时不同的同类错误视为同一报警
+*
+* param  source   报警位置
+* param  content  报警内容
+* return 去重标识
+ */
+func Fingerprint(source, content string) string {
+	h := sha1.New()
+	h.Write([]byte(source))
+	h.Write([]byte{0})
+	h.Write([]byte(digits.ReplaceAllString(content, "#")))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+//报警文本，各通道的默认内容格式
+func (m *Message) Text() string {
+	var b strings.Builder
+	if m.Title != "" {
+		b.WriteString(m.Title)
+		b.WriteString("\n")
+	}
+	b.WriteString(m.Time.Format(utility.FORMATLOGTIME))
+	if m.Count > 1 {
+		b.WriteString(fmt.Sprintf("【%s内发生%d次，首次%s】", m.Window, m.Count, m.First.Format(utility.FORMATLOGTIME)))
+	}
+	if m.Source != "" {
+		b.WriteString(" ")
+		b.WriteString(m.Source)
+	}
+	b.WriteString("\n")
+	b.WriteString(m.Content)
+	return b.String()
+}
+
+//内部方法：按字符截断
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max]) + "..."
+}
@@ -0,0 +1,153 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//本地HTTP服务，记录收到的请求体
+type recorder struct {
+	mu     sync.Mutex
+	bodies []map[string]interface{}
+	urls   []string
+	reply  string
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	data, _ := ioutil.ReadAll(req.Body)
+	var body map[string]interface{}
+	_ = json.Unmarshal(data, &body)
+
+	r.mu.Lock()
+	r.bodies = append(r.bodies, body)
+	r.urls = append(r.urls, req.URL.String())
+	reply := r.reply
+	r.mu.Unlock()
+
+	if reply == "" {
+		reply = `{"errcode":0}`
+	}
+	_, _ = w.Write([]byte(reply))
+}
+
+func (r *recorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.bodies)
+}
+
+func TestNotifiers(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	msg := &Message{Title: "prod(host)", Content: "db error", Source: "order.go:10", Time: time.Now(), Count: 1}
+	ctx := context.Background()
+
+	if err := (&DingTalk{Url: srv.URL + "/robot/send?access_token=t", Secret: "s", AtMobiles: []string{"13800000000"}}).Notify(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rec.urls[0], "&timestamp=") || !strings.Contains(rec.urls[0], "&sign=") {
+		t.Errorf("dingtalk url = %s", rec.urls[0])
+	}
+	if text := rec.bodies[0]["text"].(map[string]interface{})["content"].(string); !strings.Contains(text, "db error") {
+		t.Errorf("dingtalk content = %s", text)
+	}
+
+	if err := (&WeCom{Url: srv.URL}).Notify(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Feishu{Url: srv.URL, Secret: "s"}).Notify(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	if rec.bodies[2]["sign"] == nil || rec.bodies[2]["msg_type"] != "text" {
+		t.Errorf("feishu body = %v", rec.bodies[2])
+	}
+	if err := (&Webhook{Url: srv.URL}).Notify(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	if rec.bodies[3]["text"] == nil || rec.bodies[3]["source"] != "order.go:10" {
+		t.Errorf("webhook body = %v", rec.bodies[3])
+	}
+
+	rec.reply = `{"errcode":310000,"errmsg":"sign not match"}`
+	if err := (&DingTalk{Url: srv.URL + "/?a=1"}).Notify(ctx, msg); err == nil || !strings.Contains(err.Error(), "sign not match") {
+		t.Errorf("dingtalk error = %v", err)
+	}
+	rec.reply = `{"code":19021,"msg":"sign match fail"}`
+	if err := (&Feishu{Url: srv.URL}).Notify(ctx, msg); err == nil {
+		t.Error("feishu error expected")
+	}
+}
+
+func TestDedupSummary(t *testing.T) {
+	var mu sync.Mutex
+	var got []Message
+	n := NotifierFunc(func(_ context.Context, msg *Message) error {
+		mu.Lock()
+		got = append(got, *msg)
+		mu.Unlock()
+		return nil
+	})
+
+	a := New(Options{Window: 100 * time.Millisecond}, n)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			//数字不同视为同一报警
+			a.Send(Message{Content: "order " + string(rune('0'+i)) + " failed", Source: "order.go:10"})
+		}(i)
+	}
+	wg.Wait()
+	a.Send(Message{Content: "other", Source: "user.go:5"})
+	a.Wait()
+
+	mu.Lock()
+	if len(got) != 2 || got[0].Count != 1 {
+		t.Fatalf("first send = %+v", got)
+	}
+	mu.Unlock()
+
+	time.Sleep(250 * time.Millisecond)
+	a.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 3 || got[2].Count != 9 || !strings.Contains(got[2].Text(), "9次") {
+		t.Fatalf("summary = %+v", got)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	a := New(Options{Window: time.Hour, RateLimit: 2}, &Webhook{Url: srv.URL})
+	for _, s := range []string{"a", "b", "c", "d"} {
+		a.Send(Message{Content: s})
+	}
+	a.Wait()
+	if c := rec.count(); c != 2 {
+		t.Errorf("sent = %d, want 2", c)
+	}
+
+	//关闭时发送被限流的报警
+	a.Close()
+	if c := rec.count(); c != 4 {
+		t.Errorf("sent after close = %d, want 4", c)
+	}
+	a.Send(Message{Content: "e"})
+	a.Wait()
+	if c := rec.count(); c != 4 {
+		t.Errorf("sent after closed = %d, want 4", c)
+	}
+}
@@ -0,0 +1,169 @@
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"github.com/maclon-lee/golanglib/lib/alert/schema"
+	"github.com/maclon-lee/golanglib/lib/config"
+	"github.com/spf13/viper"
+	syslog "log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//报警配置结构（config.toml中的alert节点）
+type alertConf = schema.Conf
+
+//报警通道配置结构
+type notifierConf = schema.Notifier
+
+var defaultAlerter = New(Options{})
+var alertLock sync.RWMutex
+var title string
+
+//初始化
+func init() {
+	if err := load(); err != nil {
+		syslog.Printf("alert config error: %s", err)
+	}
+
+	//配置变更时重建报警器
+	reload := func(_, _ *viper.Viper) {
+		if err := load(); err != nil {
+			syslog.Printf("alert config error: %s", err)
+		}
+	}
+	config.OnChange("alert", reload)
+	config.OnChange("dingtalk", reload)
+}
+
+//内部方法：按配置构建默认报警器
+func load() error {
+	var c alertConf
+	if cnf := config.GetSubConfig("alert"); cnf != nil {
+		if err := cnf.Unmarshal(&c); err != nil {
+			return err
+		}
+	} else if cnf := config.GetSubConfig("dingtalk"); cnf != nil {
+		var d schema.Dingtalk
+		if err := cnf.Unmarshal(&d); err != nil {
+			return err
+		}
+		if d.IsOpen {
+			c.Notifiers = []notifierConf{{
+				Type:      "dingtalk",
+				Url:       d.Url,
+				Secret:    d.Secret,
+				AtMobiles: d.AtMobiles,
+			}}
+		}
+	}
+
+	envs := c.Envs
+	if len(envs) == 0 {
+		envs = []string{"prod"}
+	}
+	enable := false
+	for _, env := range envs {
+		if strings.EqualFold(env, config.Env) {
+			enable = true
+			break
+		}
+	}
+
+	var notifiers []Notifier
+	if enable {
+		for i, nc := range c.Notifiers {
+			n, err := newNotifier(nc)
+			if err != nil {
+				return fmt.Errorf("alert.notifiers[%d]: %s", i, err)
+			}
+			notifiers = append(notifiers, n)
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	alertLock.Lock()
+	title = fmt.Sprintf("%s(%s)", config.Env, hostname)
+	alertLock.Unlock()
+
+	rateLimit := c.RateLimit
+	if rateLimit == 0 {
+		rateLimit = 20
+	}
+	SetDefault(New(Options{
+		Window:    time.Duration(c.Window) * time.Second,
+		RateLimit: rateLimit,
+		MaxLength: c.MaxLength,
+	}, notifiers...))
+	return nil
+}
+
+//内部方法：按配置构建报警通道
+func newNotifier(c notifierConf) (Notifier, error) {
+	if c.Type != "email" && c.Url == "" {
+		return nil, errors.New("url未配置")
+	}
+
+	switch c.Type {
+	case "dingtalk":
+		return &DingTalk{Url: c.Url, Secret: c.Secret, AtMobiles: c.AtMobiles}, nil
+	case "wecom":
+		return &WeCom{Url: c.Url, AtMobiles: c.AtMobiles}, nil
+	case "feishu":
+		return &Feishu{Url: c.Url, Secret: c.Secret}, nil
+	case "webhook":
+		return &Webhook{Url: c.Url, Headers: c.Headers}, nil
+	case "email":
+		if c.Host == "" || len(c.To) == 0 {
+			return nil, errors.New("host、to未配置")
+		}
+		port := c.Port
+		if port == 0 {
+			port = 25
+		}
+		return &Email{Host: c.Host, Port: port, Username: c.Username, Password: c.Password, From: c.From, To: c.To}, nil
+	}
+	return nil, fmt.Errorf("不支持的报警类型:%s", c.Type)
+}
+
+/*
+* 替换默认报警器，原报警器窗口内未发送的汇总在后台发送
+*
+* param  a  报警器
+ */
+func SetDefault(a *Alerter) {
+	alertLock.Lock()
+	old := defaultAlerter
+	defaultAlerter = a
+	alertLock.Unlock()
+
+	if old != nil && old != a {
+		go old.Close()
+	}
+}
+
+//获取默认报警器
+func Default() *Alerter {
+	alertLock.RLock()
+	defer alertLock.RUnlock()
+	return defaultAlerter
+}
+
+/*
+* 通过默认报警器发送报警，标题为空时使用 环境(主机名)
+* logger.Errorf会自动调用，一般无需直接使用
+*
+* param  msg  报警消息
+ */
+func Send(msg Message) {
+	alertLock.RLock()
+	a := defaultAlerter
+	if msg.Title == "" {
+		msg.Title = title
+	}
+	alertLock.RUnlock()
+	a.Send(msg)
+}
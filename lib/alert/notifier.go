@@ -0,0 +1,277 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//钉钉机器人
+type DingTalk struct {
+	Url       string   //机器人地址，https://oapi.dingtalk.com/robot/send?access_token=TOKEN
+	Secret    string   //加签密钥，为空时不加签
+	AtMobiles []string //@的手机号
+	Client    *http.Client
+}
+
+func (n *DingTalk) Notify(ctx context.Context, msg *Message) error {
+	addr := n.Url
+	if n.Secret != "" {
+		timestamp := time.Now().Unix() * 1000
+		sign := hmacSign(n.Secret, fmt.Sprintf("%d\n%s", timestamp, n.Secret))
+		addr = fmt.Sprintf("%s&timestamp=%d&sign=%s", n.Url, timestamp, url.QueryEscape(sign))
+	}
+
+	atMobiles := n.AtMobiles
+	if atMobiles == nil {
+		atMobiles = []string{}
+	}
+	body := map[string]interface{}{
+		"msgtype": "text",
+		"at":      map[string]interface{}{"atMobiles": atMobiles, "isAtAll": false},
+		"text":    map[string]interface{}{"content": msg.Text()},
+	}
+	ret, err := postJSON(ctx, n.Client, addr, body)
+	if err != nil {
+		return fmt.Errorf("dingtalk: %s", err)
+	}
+	return checkCode("dingtalk", ret, "errcode", "errmsg")
+}
+
+//企业微信群机器人
+type WeCom struct {
+	Url       string   //机器人地址，https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=KEY
+	AtMobiles []string //@的手机号
+	Client    *http.Client
+}
+
+func (n *WeCom) Notify(ctx context.Context, msg *Message) error {
+	text := map[string]interface{}{"content": msg.Text()}
+	if len(n.AtMobiles) > 0 {
+		text["mentioned_mobile_list"] = n.AtMobiles
+	}
+	body := map[string]interface{}{
+		"msgtype": "text",
+		"text":    text,
+	}
+	ret, err := postJSON(ctx, n.Client, n.Url, body)
+	if err != nil {
+		return fmt.Errorf("wecom: %s", err)
+	}
+	return checkCode("wecom", ret, "errcode", "errmsg")
+}
+
+//飞书/Lark群机器人
+type Feishu struct {
+	Url    string //机器人地址，https://open.feishu.cn/open-apis/bot/v2/hook/TOKEN
+	Secret string //签名校验密钥，为空时不签名
+	Client *http.Client
+}
+
+func (n *Feishu) Notify(ctx context.Context, msg *Message) error {
+	body := map[string]interface{}{
+		"msg_type": "text",
+		"content":  map[string]interface{}{"text": msg.Text()},
+	}
+	if n.Secret != "" {
+		timestamp := time.Now().Unix()
+		body["timestamp"] = strconv.FormatInt(timestamp, 10)
+		body["sign"] = hmacSign(fmt.Sprintf("%d\n%s", timestamp, n.Secret), "")
+	}
+	ret, err := postJSON(ctx, n.Client, n.Url, body)
+	if err != nil {
+		return fmt.Errorf("feishu: %s", err)
+	}
+	if _, ok := ret["StatusCode"]; ok {
+		return checkCode("feishu", ret, "StatusCode", "StatusMessage")
+	}
+	return checkCode("feishu", ret, "code", "msg")
+}
+
+//通用Webhook，请求体兼容Slack：{"text": "...", "title": "...", ...}
+type Webhook struct {
+	Url     string
+	Headers map[string]string //附加请求头，如Authorization
+	Client  *http.Client
+}
+
+func (n *Webhook) Notify(ctx context.Context, msg *Message) error {
+	body := map[string]interface{}{
+		"text":        msg.Text(),
+		"title":       msg.Title,
+		"content":     msg.Content,
+		"source":      msg.Source,
+		"fingerprint": msg.Fingerprint,
+		"count":       msg.Count,
+		"time":        msg.Time.Format(time.RFC3339),
+	}
+	if _, err := postJSON(ctx, n.Client, n.Url, body, n.Headers); err != nil {
+		return fmt.Errorf("webhook: %s", err)
+	}
+	return nil
+}
+
+//SMTP邮件
+type Email struct {
+	Host     string
+	Port     int //465时使用TLS连接，其他端口支持STARTTLS
+	Username string
+	Password string
+	From     string //发件人，为空时使用Username
+	To       []string
+}
+
+func (n *Email) Notify(ctx context.Context, msg *Message) error {
+	if len(n.To) == 0 {
+		return errors.New("email: 收件人为空")
+	}
+	from := n.From
+	if from == "" {
+		from = n.Username
+	}
+
+	subject := msg.Title
+	if subject == "" {
+		subject = "报警"
+	}
+	if msg.Count > 1 {
+		subject = fmt.Sprintf("%s（%d次）", subject, msg.Count)
+	}
+	var b bytes.Buffer
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + strings.Join(n.To, ",") + "\r\n")
+	b.WriteString("Subject: =?UTF-8?B?" + base64.StdEncoding.EncodeToString([]byte(subject)) + "?=\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	b.WriteString(base64.StdEncoding.EncodeToString([]byte(msg.Text())))
+
+	if err := n.send(ctx, from, b.Bytes()); err != nil {
+		return fmt.Errorf("email: %s", err)
+	}
+	return nil
+}
+
+//内部方法：连接SMTP服务器发送
+func (n *Email) send(ctx context.Context, from string, data []byte) error {
+	addr := net.JoinHostPort(n.Host, strconv.Itoa(n.Port))
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	var err error
+	if n.Port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: n.Host})
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, n.Host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok && n.Port != 465 {
+		if err = c.StartTLS(&tls.Config{ServerName: n.Host}); err != nil {
+			return err
+		}
+	}
+	if n.Username != "" {
+		if err = c.Auth(smtp.PlainAuth("", n.Username, n.Password, n.Host)); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(from); err != nil {
+		return err
+	}
+	for _, to := range n.To {
+		if err = c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+//内部方法：HmacSHA256签名后base64编码
+func hmacSign(key, data string) string {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(data))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+//内部方法：POST JSON请求，返回响应JSON（非JSON响应返回nil）
+func postJSON(ctx context.Context, client *http.Client, addr string, body interface{}, headers ...map[string]string) (map[string]interface{}, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, addr, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json;charset=utf-8")
+	for _, h := range headers {
+		for k, v := range h {
+			req.Header.Set(k, v)
+		}
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	content, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("[%d] %s", res.StatusCode, content)
+	}
+	var ret map[string]interface{}
+	_ = json.Unmarshal(content, &ret)
+	return ret, nil
+}
+
+//内部方法：检查响应错误码
+func checkCode(name string, ret map[string]interface{}, codeKey, msgKey string) error {
+	if ret == nil {
+		return nil
+	}
+	if code, ok := ret[codeKey].(float64); ok && code != 0 {
+		return fmt.Errorf("%s: [%v] %v", name, code, ret[msgKey])
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+//报警配置节点（alert、dingtalk）结构，lib/alert按此结构读取配置，可单独引入用于配置校验
+package schema
+
+import "github.com/maclon-lee/golanglib/lib/config"
+
+//报警配置结构（config.toml中的alert节点）
+type Conf struct {
+	Envs      []string   `mapstructure:"envs"`                       //生效的环境，默认仅prod
+	Window    int        `mapstructure:"window" validate:"min=0"`    //同一报警合并窗口，默认60，单位：秒
+	RateLimit int        `mapstructure:"rateLimit" validate:"min=0"` //每分钟最多发送条数，默认20，0为默认值
+	MaxLength int        `mapstructure:"maxLength" validate:"min=0"` //内容最大字符数，默认4000
+	Notifiers []Notifier `mapstructure:"notifiers" validate:"dive"`
+}
+
+//报警通道配置结构
+type Notifier struct {
+	Type      string            `mapstructure:"type" validate:"required,oneof=dingtalk wecom feishu webhook email"`
+	Url       string            `mapstructure:"url" validate:"omitempty,url"` //机器人或Webhook地址
+	Secret    string            `mapstructure:"secret"`                       //dingtalk、feishu签名密钥
+	AtMobiles []string          `mapstructure:"atMobiles"`                    //dingtalk、wecom：@的手机号
+	Headers   map[string]string `mapstructure:"headers"`                      //webhook：附加请求头
+	Host      string            `mapstructure:"host"`                         //email：SMTP服务器
+	Port      int               `mapstructure:"port" validate:"min=0,max=65535"`
+	Username  string            `mapstructure:"username"`
+	Password  string            `mapstructure:"password"`
+	From      string            `mapstructure:"from"`
+	To        []string          `mapstructure:"to"`
+}
+
+//钉钉报警配置结构（兼容原有dingtalk节点，未配置alert节点时使用）
+type Dingtalk struct {
+	IsOpen    bool     `mapstructure:"isOpen"`
+	Url       string   `mapstructure:"url" validate:"required_with=IsOpen,omitempty,url"`
+	Secret    string   `mapstructure:"secret"`
+	AtMobiles []string `mapstructure:"atMobiles"`
+}
+
+func init() {
+	config.RegisterSection("alert", Conf{}, false)
+	config.RegisterSection("dingtalk", Dingtalk{}, false)
+}
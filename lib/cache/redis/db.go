@@ -4,22 +4,42 @@ import (
 	"errors"
 	"github.com/go-redis/redis"
 	"github.com/maclon-lee/golanglib/lib/config"
+	_ "github.com/maclon-lee/golanglib/lib/cache/redis/schema"
 	logger "github.com/maclon-lee/golanglib/lib/log"
+	"github.com/spf13/viper"
+	"sync"
 	"time"
 )
 
-var rdb *redis.Client
+//redis模块日志
+var log = logger.Named("redis")
+
+var client *redis.Client
+
+var clientLock sync.RWMutex
+
+//配置变更后原有连接延迟关闭的时间，等待执行中的命令完成
+const closeDelay = time.Minute
 
 /*
 * 初始配置和连接
 */
 func init() {
 	if !config.IsSet("redis") {
-		logger.Errorf("Redis连接未配置")
-		return
+		log.Errorf("Redis连接未配置")
+	} else {
+		connect(config.GetSubConfig("redis"))
 	}
 
-	cfglist := config.GetSubConfig("redis")
+	//配置变更时重建连接
+	config.OnChange("redis", func(_, nv *viper.Viper) {
+		connect(nv)
+	})
+}
+
+//内部方法：按配置创建连接，替换原有连接，原有连接在closeDelay后关闭
+func connect(cfglist *viper.Viper) {
+	var rdb *redis.Client
 	if cfglist != nil {
 		rdb = redis.NewClient(&redis.Options{
 			Addr:       cfglist.GetString("addr"),
@@ -29,14 +49,34 @@ func init() {
 		})
 
 		if rdb == nil {
-			logger.Errorf("Error creating redis client")
+			log.Errorf("Error creating redis client")
 			return
 		}
 	}
+
+	clientLock.Lock()
+	old := client
+	client = rdb
+	clientLock.Unlock()
+
+	//已取得原有连接的调用（含Engine()返回的客户端）继续可用，超过closeDelay的阻塞命令会被中断
+	if old != nil {
+		time.AfterFunc(closeDelay, func() {
+			_ = old.Close()
+		})
+	}
+}
+
+//内部方法：获取当前连接
+func getClient() *redis.Client {
+	clientLock.RLock()
+	defer clientLock.RUnlock()
+	return client
 }
 
 //Ping
 func Ping() (string, error) {
+	rdb := getClient()
 	if rdb == nil {
 		return "error", errors.New("redis init: fail ")
 	}
@@ -46,6 +86,7 @@ func Ping() (string, error) {
 
 //缓存key-value数据
 func Set(key string, value interface{}, expiration time.Duration) error {
+	rdb := getClient()
 	if rdb == nil {
 		return errors.New("redis init: fail ")
 	}
@@ -60,6 +101,7 @@ func Set(key string, value interface{}, expiration time.Duration) error {
 
 //获取key-value数据
 func Get(key string) (result string, err error) {
+	rdb := getClient()
 	if rdb == nil {
 		return "", errors.New("redis init: fail ")
 	}
@@ -77,6 +119,7 @@ func Get(key string) (result string, err error) {
 
 //缓存key-value数据，并返回key的旧值
 func GetSet(key string, value interface{}) (result string, err error) {
+	rdb := getClient()
 	if rdb == nil {
 		return "", errors.New("redis init: fail ")
 	}
@@ -94,6 +137,7 @@ func GetSet(key string, value interface{}) (result string, err error) {
 
 //当key不存在时才缓存key-value数据（返回是否保存了缓存）
 func SetNX(key string, value interface{}, expiration time.Duration) (bool, error) {
+	rdb := getClient()
 	if rdb == nil {
 		return false, errors.New("redis init: fail ")
 	}
@@ -103,6 +147,7 @@ func SetNX(key string, value interface{}, expiration time.Duration) (bool, error
 
 //删除缓存数据（返回删除数量）
 func Del(keys ...string) error {
+	rdb := getClient()
 	if rdb == nil {
 		return errors.New("redis init: fail ")
 	}
@@ -112,6 +157,7 @@ func Del(keys ...string) error {
 
 //判断key是否存在（返回存在数量）
 func Exists(keys ...string) (int64, error) {
+	rdb := getClient()
 	if rdb == nil {
 		return 0, errors.New("redis init: fail ")
 	}
@@ -121,6 +167,7 @@ func Exists(keys ...string) (int64, error) {
 
 //对key的value值增量加1（整型，返回增量后的值）
 func Incr(key string) (int64, error) {
+	rdb := getClient()
 	if rdb == nil {
 		return 0, errors.New("redis init: fail ")
 	}
@@ -130,6 +177,7 @@ func Incr(key string) (int64, error) {
 
 //对key的value值增量加指定值（整型，返回增量后的值）
 func IncrBy(key string, value int64) (int64, error) {
+	rdb := getClient()
 	if rdb == nil {
 		return 0, errors.New("redis init: fail ")
 	}
@@ -139,6 +187,7 @@ func IncrBy(key string, value int64) (int64, error) {
 
 //对key的value值增量加指定值（浮点型，返回增量后的值）
 func IncrByFloat(key string, value float64) (float64, error) {
+	rdb := getClient()
 	if rdb == nil {
 		return 0, errors.New("redis init: fail ")
 	}
@@ -148,6 +197,7 @@ func IncrByFloat(key string, value float64) (float64, error) {
 
 //对key的value值减量减1（整型，返回减量后的值）
 func Decr(key string) (int64, error) {
+	rdb := getClient()
 	if rdb == nil {
 		return 0, errors.New("redis init: fail ")
 	}
@@ -157,6 +207,7 @@ func Decr(key string) (int64, error) {
 
 //对key的value值减量减指定值（整型，返回减量后的值）
 func DecrBy(key string, decrement int64) (int64, error) {
+	rdb := getClient()
 	if rdb == nil {
 		return 0, errors.New("redis init: fail ")
 	}
@@ -166,6 +217,7 @@ func DecrBy(key string, decrement int64) (int64, error) {
 
 //从key的列表值中移出并获取列表的第一个元素，如果列表没有元素会阻塞列表直到等待超时或发现可弹出元素为止。
 func BLPop(timeout time.Duration, keys ...string) ([]string, error) {
+	rdb := getClient()
 	if rdb == nil {
 		return nil, errors.New("redis init: fail ")
 	}
@@ -175,6 +227,7 @@ func BLPop(timeout time.Duration, keys ...string) ([]string, error) {
 
 //从key的列表值中移出并获取列表的最后一个元素，如果列表没有元素会阻塞列表直到等待超时或发现可弹出元素为止。
 func BRPop(timeout time.Duration, keys ...string) ([]string, error) {
+	rdb := getClient()
 	if rdb == nil {
 		return nil, errors.New("redis init: fail ")
 	}
@@ -184,6 +237,7 @@ func BRPop(timeout time.Duration, keys ...string) ([]string, error) {
 
 //从source列表中弹出一个值，将弹出的元素插入到destination列表中并返回它； 如果列表没有元素会阻塞列表直到等待超时或发现可弹出元素为止。
 func BRPopLPush(source string, destination string, timeout time.Duration) (string, error) {
+	rdb := getClient()
 	if rdb == nil {
 		return "", errors.New("redis init: fail ")
 	}
@@ -201,6 +255,7 @@ func BRPopLPush(source string, destination string, timeout time.Duration) (strin
 
 //通过索引获取列表中的元素
 func LIndex(key string, index int64) (string, error) {
+	rdb := getClient()
 	if rdb == nil {
 		return "", errors.New("redis init: fail ")
 	}
@@ -218,6 +273,7 @@ func LIndex(key string, index int64) (string, error) {
 
 //在key列表的pivot元素前或者后插入value元素（op取值范围为：BEFORE | AFTER）
 func LInsert(key string, op string, pivot interface{}, value interface{}) error {
+	rdb := getClient()
 	if rdb == nil {
 		return errors.New("redis init: fail ")
 	}
@@ -227,6 +283,7 @@ func LInsert(key string, op string, pivot interface{}, value interface{}) error
 
 //获取列表长度
 func LLen(key string) (int64, error) {
+	rdb := getClient()
 	if rdb == nil {
 		return 0, errors.New("redis init: fail ")
 	}
@@ -236,6 +293,7 @@ func LLen(key string) (int64, error) {
 
 //移出并获取列表的第一个元素
 func LPop(key string) (string, error) {
+	rdb := getClient()
 	if rdb == nil {
 		return "", errors.New("redis init: fail ")
 	}
@@ -253,6 +311,7 @@ func LPop(key string) (string, error) {
 
 //将一个或多个值插入到列表头部
 func LPush(key string, values ...interface{}) error {
+	rdb := getClient()
 	if rdb == nil {
 		return errors.New("redis init: fail ")
 	}
@@ -262,6 +321,7 @@ func LPush(key string, values ...interface{}) error {
 
 //将一个值插入到已存在的列表头部
 func LPushX(key string, value interface{}) error {
+	rdb := getClient()
 	if rdb == nil {
 		return errors.New("redis init: fail ")
 	}
@@ -271,6 +331,7 @@ func LPushX(key string, value interface{}) error {
 
 //获取列表指定范围内的元素
 func LRange(key string, start int64, stop int64) ([]string, error) {
+	rdb := getClient()
 	if rdb == nil {
 		return nil, errors.New("redis init: fail ")
 	}
@@ -286,6 +347,7 @@ func LRange(key string, start int64, stop int64) ([]string, error) {
 * count = 0 : 移除表中所有与 value 相等的值。
 */
 func LRem(key string, count int64, value interface{}) error {
+	rdb := getClient()
 	if rdb == nil {
 		return errors.New("redis init: fail ")
 	}
@@ -295,6 +357,7 @@ func LRem(key string, count int64, value interface{}) error {
 
 //通过索引index设置列表元素的value值
 func LSet(key string, index int64, value interface{}) error {
+	rdb := getClient()
 	if rdb == nil {
 		return errors.New("redis init: fail ")
 	}
@@ -304,6 +367,7 @@ func LSet(key string, index int64, value interface{}) error {
 
 //对一个列表进行修剪(trim)，让列表只保留指定区间内的元素，不在指定区间之内的元素都将被删除。
 func LTrim(key string, start int64, stop int64) error {
+	rdb := getClient()
 	if rdb == nil {
 		return errors.New("redis init: fail ")
 	}
@@ -313,6 +377,7 @@ func LTrim(key string, start int64, stop int64) error {
 
 //移除列表的最后一个元素，返回值为移除的元素。
 func RPop(key string) (string, error) {
+	rdb := getClient()
 	if rdb == nil {
 		return "", errors.New("redis init: fail ")
 	}
@@ -330,6 +395,7 @@ func RPop(key string) (string, error) {
 
 //移除source列表的最后一个元素，并将该元素添加到destination列表并返回
 func RPopLPush(source string, destination string) (string, error) {
+	rdb := getClient()
 	if rdb == nil {
 		return "", errors.New("redis init: fail ")
 	}
@@ -347,6 +413,7 @@ func RPopLPush(source string, destination string) (string, error) {
 
 //在列表中添加一个或多个值
 func RPush(key string, values ...interface{}) error {
+	rdb := getClient()
 	if rdb == nil {
 		return errors.New("redis init: fail ")
 	}
@@ -356,6 +423,7 @@ func RPush(key string, values ...interface{}) error {
 
 //为已存在的列表添加值
 func RPushX(key string, value interface{}) error {
+	rdb := getClient()
 	if rdb == nil {
 		return errors.New("redis init: fail ")
 	}
@@ -365,6 +433,7 @@ func RPushX(key string, value interface{}) error {
 
 //获取key的有效期
 func TTL(key string) (time.Duration, error) {
+	rdb := getClient()
 	if rdb == nil {
 		return 0, errors.New("redis init: fail ")
 	}
@@ -372,7 +441,7 @@ func TTL(key string) (time.Duration, error) {
 	return rdb.TTL(key).Result()
 }
 
-//返回客户端引擎
+//返回客户端引擎，配置热更新后原有客户端在closeDelay后关闭，不要长期持有
 func Engine() *redis.Client {
-	return rdb
+	return getClient()
 }
\ No newline at end of file
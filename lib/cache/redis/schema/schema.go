@@ -0,0 +1,15 @@
+//redis配置节点结构，仅注册校验规则，不建立连接，可单独引入用于配置校验
+package schema
+
+import "github.com/maclon-lee/golanglib/lib/config"
+
+//redis配置结构
+type Conf struct {
+	Addr     string `mapstructure:"addr" validate:"required,hostname_port"`
+	Password string `mapstructure:"password"`
+	Database int    `mapstructure:"database" validate:"min=0,max=15"`
+}
+
+func init() {
+	config.RegisterSection("redis", Conf{}, false)
+}
@@ -1,44 +1,223 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"github.com/spf13/viper"
+	"io"
+	syslog "log"
+	"os"
+	"strings"
+	"sync"
 )
 
+//配置文件格式
+const (
+	FormatToml = "toml"
+	FormatYaml = "yaml"
+	FormatJson = "json"
+)
+
+//环境变量：指定配置文件路径，优先于默认搜索路径
+const EnvConfigFile = "GOLANGLIB_CONFIG"
+
 var Env = "prod"
 
+//默认配置文件名和搜索路径
+var defaultName = "config"
+var defaultPaths = []string{"/etc/conf/", "./conf", "../conf", "../../conf"}
+
+var v = viper.New()
+var mu sync.RWMutex
+
+//加载选项
+type loadOptions struct {
+	file   string
+	paths  []string
+	format string
+	reader io.Reader
+
+	envPrefix    string
+	envPrefixSet bool
+}
+
+//配置加载选项
+type Option func(*loadOptions)
+
+//指定配置文件路径
+func WithFile(file string) Option {
+	return func(o *loadOptions) {
+		o.file = file
+	}
+}
+
+//指定配置文件搜索路径（替换默认搜索路径）
+func WithPaths(paths ...string) Option {
+	return func(o *loadOptions) {
+		o.paths = paths
+	}
+}
+
+//指定配置格式（toml, yaml, json），未指定时按文件扩展名识别，io.Reader来源默认为toml
+func WithFormat(format string) Option {
+	return func(o *loadOptions) {
+		o.format = strings.ToLower(format)
+	}
+}
+
+//从内存读取配置内容
+func WithReader(r io.Reader) Option {
+	return func(o *loadOptions) {
+		o.reader = r
+	}
+}
+
+//初始化：按默认规则加载配置，配置文件不存在时不再中断程序
 func init() {
-	viper.SetConfigName("config")
-	viper.AddConfigPath("/etc/conf/") // path to look for the config file in
-	viper.AddConfigPath("./conf")
-	viper.AddConfigPath("../conf")
-	viper.AddConfigPath("../../conf")
-	err := viper.ReadInConfig()
+	if err := Load(); err != nil {
+		syslog.Printf("config: %s", err)
+	}
+}
+
+/*
+* 加载配置
+*
+* 加载优先级：WithReader > WithFile > 环境变量GOLANGLIB_CONFIG > 搜索路径（默认为/etc/conf/, ./conf, ../conf, ../../conf）
+* 配置分层：基础配置config.toml < 环境配置config.<env>.toml < 环境变量（如GOLANGLIB_DBS_DB_0_STR）
+* 环境名取自setting.env，可由环境变量GOLANGLIB_SETTING_ENV覆盖
+* 合并后解析配置值中的密钥引用：${env:NAME}、${file:/path}、enc:AES256:<base64>及已注册的SecretProvider
+* 加载失败时返回错误，原有配置保持不变
+* 部分密钥解析失败时其余配置正常加载，失败的配置项保留原值，返回*SecretError列出失败的配置项
+*
+* param  opts  加载选项
+* return 是否异常
+ */
+func Load(opts ...Option) error {
+	return load(newOptions(opts))
+}
+
+//内部方法：构建加载选项
+func newOptions(opts []Option) *loadOptions {
+	o := &loadOptions{paths: defaultPaths}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if !o.envPrefixSet {
+		o.envPrefix = DefaultEnvPrefix
+	}
+	return o
+}
+
+//内部方法：按加载选项读取配置，成功后替换当前配置并通知订阅者，部分密钥解析失败时同样替换并返回*SecretError
+func load(o *loadOptions) error {
+	nv, err := read(o)
+	if nv == nil {
+		return err
+	}
+
+	mu.Lock()
+	old := v
+	v = nv
+	lastOpts = o
+	Env = "prod"
+	if env := v.GetString("setting.env"); env != "" {
+		Env = env
+	}
+	mu.Unlock()
+
+	notify(old, nv)
+	return err
+}
+
+//内部方法：按加载选项读取并合并配置
+func read(o *loadOptions) (*viper.Viper, error) {
+	if o.format != "" && o.format != FormatToml && o.format != FormatYaml && o.format != FormatJson {
+		return nil, fmt.Errorf("不支持的配置格式:%s", o.format)
+	}
+
+	nv := viper.New()
+	var err error
+	switch {
+	case o.reader != nil:
+		format := o.format
+		if format == "" {
+			format = FormatToml
+		}
+		nv.SetConfigType(format)
+		err = nv.ReadConfig(o.reader)
+	default:
+		file := o.file
+		if file == "" {
+			file = os.Getenv(EnvConfigFile)
+		}
+
+		if file != "" {
+			nv.SetConfigFile(file)
+		} else {
+			if len(o.paths) == 0 {
+				return nil, errors.New("未指定配置文件搜索路径")
+			}
+			nv.SetConfigName(defaultName)
+			for _, p := range o.paths {
+				nv.AddConfigPath(p)
+			}
+		}
+		if o.format != "" {
+			nv.SetConfigType(o.format)
+		}
+		err = nv.ReadInConfig()
+	}
 	if err != nil {
-		panic(fmt.Errorf("Fatal error config file: %s ", err))
+		return nil, fmt.Errorf("读取配置文件失败:%s", err)
+	}
+
+	env := nv.GetString("setting.env")
+	if o.envPrefix != "" {
+		if e := os.Getenv(strings.ToUpper(o.envPrefix) + "_SETTING_ENV"); e != "" {
+			env = e
+		}
 	}
-	Env = GetSubConfig("setting").GetString("env")
+	if err = mergeEnvOverlay(nv, env); err != nil {
+		return nil, err
+	}
+	if nv, err = mergeEnvVars(nv, o.envPrefix); err != nil {
+		return nil, err
+	}
+	//部分密钥解析失败时仍返回配置，由调用方决定是否使用
+	return resolveSecrets(nv)
+}
+
+//内部方法：获取当前配置
+func current() *viper.Viper {
+	mu.RLock()
+	defer mu.RUnlock()
+	return v
+}
+
+//当前使用的配置文件路径，从io.Reader加载时为空
+func ConfigFileUsed() string {
+	return current().ConfigFileUsed()
 }
 
 //根据配置节点key获取配置的map，key==""时获取所有配置
 func GetConfigMap(key string) map[string]interface{} {
 	if key == "" {
-		return viper.AllSettings()
+		return current().AllSettings()
 	}
-	return viper.GetStringMap(key)
+	return current().GetStringMap(key)
 }
 
 //获取子节点的配置，如kafka，mysql，sqlserver...
 func GetSubConfig(key string) *viper.Viper {
-	return viper.Sub(key)
+	return current().Sub(key)
 }
 
 //是否配置了子节点
 func IsSet(key string) bool {
-	return viper.IsSet(key)
+	return current().IsSet(key)
 }
 
 //获取子节点配置，对象化
 func UnmarshalKey(key string, rawVal interface{}, opts ...viper.DecoderConfigOption) error {
-	return viper.UnmarshalKey(key, rawVal, opts ...)
+	return current().UnmarshalKey(key, rawVal, opts...)
 }
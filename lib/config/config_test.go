@@ -1,6 +1,15 @@
 package config
 
-import "testing"
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
 
 func TestGetSubConfig(t *testing.T) {
 	root := GetSubConfig("dbs")
@@ -11,3 +20,264 @@ func TestGetSubConfig(t *testing.T) {
 	t.Log(setting)
 
 }
+
+func TestLoadReader(t *testing.T) {
+	t.Cleanup(func() { _ = Load() })
+
+	err := Load(WithReader(strings.NewReader("[setting]\nenv=\"stage\"\n[redis]\naddr=\"127.0.0.1:6380\"\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Env != "stage" {
+		t.Errorf("Env = %s, want stage", Env)
+	}
+	if addr := GetSubConfig("redis").GetString("addr"); addr != "127.0.0.1:6380" {
+		t.Errorf("redis.addr = %s", addr)
+	}
+
+	err = Load(WithReader(strings.NewReader(`{"setting": {"env": "dev"}}`)), WithFormat(FormatJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Env != "dev" {
+		t.Errorf("Env = %s, want dev", Env)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	t.Cleanup(func() { _ = Load() })
+
+	if err := Load(WithFile("./not_exist/config.toml")); err == nil {
+		t.Error("expected error for missing file")
+	}
+	if err := Load(WithPaths("./not_exist")); err == nil {
+		t.Error("expected error for missing search path")
+	}
+	if !IsSet("dbs") {
+		t.Error("config should be kept after failed load")
+	}
+}
+
+func TestLoadEnvOverride(t *testing.T) {
+	t.Cleanup(func() { _ = Load() })
+
+	file := filepath.Join(t.TempDir(), "app.yaml")
+	if err := ioutil.WriteFile(file, []byte("setting:\n  env: stage\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Setenv(EnvConfigFile, file)
+	defer os.Unsetenv(EnvConfigFile)
+
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	if ConfigFileUsed() != file || Env != "stage" {
+		t.Errorf("file = %s, env = %s", ConfigFileUsed(), Env)
+	}
+}
+
+func TestLoadLayered(t *testing.T) {
+	t.Cleanup(func() { _ = Load() })
+
+	dir := t.TempDir()
+	base := "[setting]\nenv=\"stage\"\n[redis]\naddr=\"127.0.0.1:6379\"\npassword=\"123456\"\ndatabase=0\n" +
+		"[dbs]\n[[dbs.db]]\nname=\"mydb\"\ndriver=\"mysql\"\nstr=\"root:123456@tcp(127.0.0.1:3306)/mydb\"\n"
+	stage := "[redis]\naddr=\"10.0.0.1:6379\"\n"
+	_ = ioutil.WriteFile(filepath.Join(dir, "config.toml"), []byte(base), 0644)
+	_ = ioutil.WriteFile(filepath.Join(dir, "config.stage.toml"), []byte(stage), 0644)
+
+	_ = os.Setenv("GOLANGLIB_DBS_DB_0_STR", "root:abc@tcp(10.0.0.2:3306)/mydb")
+	_ = os.Setenv("GOLANGLIB_REDIS_DATABASE", "2")
+	defer os.Unsetenv("GOLANGLIB_DBS_DB_0_STR")
+	defer os.Unsetenv("GOLANGLIB_REDIS_DATABASE")
+
+	if err := Load(WithPaths(dir)); err != nil {
+		t.Fatal(err)
+	}
+
+	redis := GetSubConfig("redis")
+	if redis.GetString("addr") != "10.0.0.1:6379" || redis.GetInt("database") != 2 || redis.GetString("password") != "123456" {
+		t.Errorf("redis = %v", redis.AllSettings())
+	}
+
+	var dbs []struct {
+		Name string `mapstructure:"name"`
+		Str  string `mapstructure:"str"`
+	}
+	if err := GetSubConfig("dbs").UnmarshalKey("db", &dbs); err != nil {
+		t.Fatal(err)
+	}
+	if len(dbs) != 1 || dbs[0].Str != "root:abc@tcp(10.0.0.2:3306)/mydb" {
+		t.Errorf("dbs = %v", dbs)
+	}
+
+	dump, err := Dump("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(dump, "123456") || strings.Contains(dump, "abc@") {
+		t.Errorf("secrets not masked: %s", dump)
+	}
+	t.Log(dump)
+}
+
+func TestWatchOnChange(t *testing.T) {
+	t.Cleanup(func() {
+		StopWatch()
+		_ = Load()
+	})
+
+	file := filepath.Join(t.TempDir(), "config.toml")
+	_ = ioutil.WriteFile(file, []byte("[redis]\naddr=\"127.0.0.1:6379\"\n[kafka]\ntopic=\"a\"\n"), 0644)
+	if err := Load(WithFile(file)); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := make(chan string, 10)
+	OnChange("redis", func(old, new *viper.Viper) {
+		changed <- old.GetString("addr") + "->" + new.GetString("addr")
+	})
+	OnChange("kafka", func(_, _ *viper.Viper) {
+		changed <- "kafka"
+	})
+
+	if err := Watch(); err != nil {
+		t.Fatal(err)
+	}
+	_ = ioutil.WriteFile(file, []byte("[redis]\naddr=\"10.0.0.1:6379\"\n[kafka]\ntopic=\"a\"\n"), 0644)
+
+	select {
+	case c := <-changed:
+		if c != "127.0.0.1:6379->10.0.0.1:6379" {
+			t.Errorf("changed = %s", c)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("OnChange not called")
+	}
+	if GetSubConfig("redis").GetString("addr") != "10.0.0.1:6379" {
+		t.Error("config not reloaded")
+	}
+
+	select {
+	case c := <-changed:
+		t.Errorf("unexpected change: %s", c)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestLoadSecrets(t *testing.T) {
+	t.Cleanup(func() { _ = Load() })
+
+	_ = os.Setenv(EnvMasterKey, "2Jw74PPkxwbz7eedVtGTlM4UnMAedRHU")
+	_ = os.Setenv("TEST_DB_PASS", "p@ss")
+	defer os.Unsetenv(EnvMasterKey)
+	defer os.Unsetenv("TEST_DB_PASS")
+
+	secretFile := filepath.Join(t.TempDir(), "redis")
+	_ = ioutil.WriteFile(secretFile, []byte("redis-pass\n"), 0600)
+	enc, err := EncryptSecret("ak-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterSecretProvider("test", SecretProviderFunc(func(ref string) (string, error) {
+		return "vault-" + ref, nil
+	}))
+
+	toml := "[redis]\npassword=\"${file:" + secretFile + "}\"\n" +
+		"[aliyunlog]\naccessKeySecret=\"" + enc + "\"\n" +
+		"[dingtalk]\nsecret=\"${test:dingtalk}\"\n" +
+		"[dbs]\n[[dbs.db]]\nstr=\"root:${env:TEST_DB_PASS}@tcp(127.0.0.1:3306)/mydb\"\n"
+	if err = Load(WithReader(strings.NewReader(toml))); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := GetSubConfig("redis").GetString("password"); s != "redis-pass" {
+		t.Errorf("redis.password = %s", s)
+	}
+	if s := GetSubConfig("aliyunlog").GetString("accessKeySecret"); s != "ak-secret" {
+		t.Errorf("aliyunlog.accessKeySecret = %s", s)
+	}
+	if s := GetSubConfig("dingtalk").GetString("secret"); s != "vault-dingtalk" {
+		t.Errorf("dingtalk.secret = %s", s)
+	}
+	var dbs []struct {
+		Str string `mapstructure:"str"`
+	}
+	_ = GetSubConfig("dbs").UnmarshalKey("db", &dbs)
+	if len(dbs) != 1 || dbs[0].Str != "root:p@ss@tcp(127.0.0.1:3306)/mydb" {
+		t.Errorf("dbs = %v", dbs)
+	}
+
+	err = Load(WithReader(strings.NewReader("[redis]\naddr=\"127.0.0.1:6379\"\npassword=\"${env:TEST_NOT_EXIST}\"\n" +
+		"[dingtalk]\nsecret=\"${test:dingtalk}\"\n")))
+	serr, ok := err.(*SecretError)
+	if !ok {
+		t.Fatalf("expected *SecretError for missing env secret, got %v", err)
+	}
+	if len(serr.Keys) != 1 || serr.Keys[0] != "redis.password" || !strings.Contains(err.Error(), "redis.password") {
+		t.Errorf("failed keys = %v, error = %s", serr.Keys, err)
+	}
+	if s := GetSubConfig("redis").GetString("password"); s != "${env:TEST_NOT_EXIST}" {
+		t.Errorf("unresolved redis.password = %s", s)
+	}
+	if s := GetSubConfig("redis").GetString("addr"); s != "127.0.0.1:6379" {
+		t.Errorf("redis.addr = %s", s)
+	}
+	if s := GetSubConfig("dingtalk").GetString("secret"); s != "vault-dingtalk" {
+		t.Errorf("dingtalk.secret = %s", s)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	type policy struct {
+		Column string `mapstructure:"column" validate:"required"`
+		Count  int    `mapstructure:"count" validate:"min=0"`
+	}
+	type db struct {
+		Name   string   `mapstructure:"name" validate:"required"`
+		Driver string   `mapstructure:"driver" validate:"required,oneof=mysql mssql postgres"`
+		Policy []policy `mapstructure:"policy" validate:"dive"`
+	}
+	type dbs struct {
+		Db []db `mapstructure:"db" validate:"required,dive"`
+	}
+	type kafka struct {
+		Address []string `mapstructure:"address" validate:"required,dive,hostname_port"`
+	}
+	RegisterSection("test_dbs", dbs{}, true)
+	RegisterSection("test_kafka", &kafka{}, false)
+	RegisterSection("test_required", kafka{}, true)
+	defer func() {
+		sectionLock.Lock()
+		delete(sections, "test_dbs")
+		delete(sections, "test_kafka")
+		delete(sections, "test_required")
+		sectionLock.Unlock()
+	}()
+
+	toml := "[test_dbs]\n[[test_dbs.db]]\nname=\"a\"\ndriver=\"oracle\"\n[[test_dbs.db.policy]]\ncount=-1\n" +
+		"[test_kafka]\naddress=[\"127.0.0.1:9092\", \"bad\"]\n"
+	err := Check(WithReader(strings.NewReader(toml)))
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("err = %v", err)
+	}
+
+	want := map[string]bool{
+		"test_dbs.db[0].driver":           true,
+		"test_dbs.db[0].policy[0].column": true,
+		"test_dbs.db[0].policy[0].count":  true,
+		"test_kafka.address[1]":           true,
+		"test_required":                   true,
+	}
+	for _, e := range errs {
+		if !want[e.Key] {
+			t.Errorf("unexpected error: %s", e)
+		}
+		delete(want, e.Key)
+	}
+	for k := range want {
+		t.Errorf("missing error for %s", k)
+	}
+	t.Log(err)
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/spf13/viper"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//配置校验错误
+type ValidationError struct {
+	Key     string //配置项路径，如dbs.db[0].driver
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Key, e.Message)
+}
+
+//配置校验错误列表
+type ValidationErrors []ValidationError
+
+func (es ValidationErrors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Error()
+	}
+	return fmt.Sprintf("配置校验失败(%d项):\n%s", len(es), strings.Join(msgs, "\n"))
+}
+
+//配置节点结构定义
+type section struct {
+	key      string
+	schema   reflect.Type
+	required bool
+}
+
+var (
+	sections    = make(map[string]section)
+	sectionLock sync.RWMutex
+	validate    *validator.Validate
+)
+
+func init() {
+	validate = validator.New()
+	//以mapstructure标签名作为字段路径，与配置文件中的键名一致
+	validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("mapstructure"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+}
+
+/*
+* 注册配置节点结构，供Validate校验
+* 结构字段用mapstructure标签映射配置键名，用validate标签定义规则，如：
+*   type RedisConf struct {
+*      Addr     string `mapstructure:"addr" validate:"required,hostname_port"`
+*      Database int    `mapstructure:"database" validate:"min=0,max=15"`
+*   }
+* 常用规则：required, url, oneof=mysql mssql postgres（空格分隔）, min, max, dive（校验数组元素）
+*
+* param  key       配置节点，如redis、dbs
+* param  schema    节点结构（struct或struct指针）
+* param  required  节点是否必须配置，false时未配置的节点不校验
+ */
+func RegisterSection(key string, schema interface{}, required bool) {
+	t := reflect.TypeOf(schema)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Errorf("配置节点%s结构必须为struct", key))
+	}
+
+	sectionLock.Lock()
+	defer sectionLock.Unlock()
+	sections[strings.ToLower(key)] = section{key: key, schema: t, required: required}
+}
+
+/*
+* 按已注册的节点结构校验当前配置，一次返回全部问题
+*
+* return 校验通过返回nil，否则返回ValidationErrors
+ */
+func Validate() error {
+	return validateConfig(current())
+}
+
+/*
+* 按加载选项读取配置并校验，不替换当前配置，也不通知订阅者
+*
+* param  opts  加载选项，同Load
+* return 校验通过返回nil，否则返回读取错误或ValidationErrors
+ */
+func Check(opts ...Option) error {
+	cv, err := read(newOptions(opts))
+	if err != nil {
+		return err
+	}
+	return validateConfig(cv)
+}
+
+//内部方法：校验配置
+func validateConfig(cv *viper.Viper) error {
+	sectionLock.RLock()
+	list := make([]section, 0, len(sections))
+	for _, s := range sections {
+		list = append(list, s)
+	}
+	sectionLock.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].key < list[j].key })
+
+	var errs ValidationErrors
+	for _, s := range list {
+		errs = append(errs, validateSection(cv, s)...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+//内部方法：校验单个节点
+func validateSection(cv *viper.Viper, s section) ValidationErrors {
+	if !cv.IsSet(s.key) {
+		if s.required {
+			return ValidationErrors{{Key: s.key, Message: "未配置"}}
+		}
+		return nil
+	}
+
+	val := reflect.New(s.schema)
+	if err := cv.UnmarshalKey(s.key, val.Interface()); err != nil {
+		return ValidationErrors{{Key: s.key, Message: err.Error()}}
+	}
+
+	err := validate.Struct(val.Interface())
+	if err == nil {
+		return nil
+	}
+	fes, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return ValidationErrors{{Key: s.key, Message: err.Error()}}
+	}
+
+	errs := make(ValidationErrors, 0, len(fes))
+	for _, fe := range fes {
+		//Namespace格式为 结构名.字段路径，替换结构名为配置节点
+		path := fe.Namespace()
+		if idx := strings.Index(path, "."); idx >= 0 {
+			path = s.key + path[idx:]
+		}
+		errs = append(errs, ValidationError{Key: path, Message: ruleMessage(fe)})
+	}
+	return errs
+}
+
+//内部方法：校验规则说明
+func ruleMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "必须配置"
+	case "oneof":
+		return fmt.Sprintf("值%v无效，可选值:%s", fe.Value(), fe.Param())
+	case "min", "max":
+		cmp := "小于"
+		if fe.Tag() == "max" {
+			cmp = "大于"
+		}
+		switch fe.Kind() {
+		case reflect.Slice, reflect.Map, reflect.Array:
+			return fmt.Sprintf("数量不能%s%s", cmp, fe.Param())
+		case reflect.String:
+			return fmt.Sprintf("长度不能%s%s", cmp, fe.Param())
+		}
+		return fmt.Sprintf("值%v不能%s%s", fe.Value(), cmp, fe.Param())
+	case "url":
+		return fmt.Sprintf("值%v不是有效的URL", fe.Value())
+	}
+	if fe.Param() != "" {
+		return fmt.Sprintf("值%v不满足规则%s=%s", fe.Value(), fe.Tag(), fe.Param())
+	}
+	return fmt.Sprintf("值%v不满足规则%s", fe.Value(), fe.Tag())
+}
+
+//注册自定义校验规则，供节点结构的validate标签使用
+func RegisterValidation(tag string, fn validator.Func) error {
+	return validate.RegisterValidation(tag, fn)
+}
@@ -0,0 +1,283 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//环境变量：配置加密主密钥（32位字符串，或32字节的base64编码）
+const EnvMasterKey = "GOLANGLIB_MASTER_KEY"
+
+//加密配置值前缀，格式：enc:AES256:<base64>
+const EncryptedPrefix = "enc:AES256:"
+
+//密钥引用，格式：${scheme:ref}，如${env:DB_PASS}、${file:/run/secrets/db}
+var secretRef = regexp.MustCompile(`\$\{([a-zA-Z][a-zA-Z0-9_-]*):([^}]*)\}`)
+
+//密钥来源，按引用名称获取密钥内容
+type SecretProvider interface {
+	Resolve(ref string) (string, error)
+}
+
+//函数形式的密钥来源
+type SecretProviderFunc func(ref string) (string, error)
+
+func (f SecretProviderFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+var (
+	secretProviders = map[string]SecretProvider{
+		"env":  SecretProviderFunc(envSecret),
+		"file": SecretProviderFunc(fileSecret),
+	}
+	secretLock sync.RWMutex
+)
+
+/*
+* 注册密钥来源，注册后配置值中的${scheme:ref}由该来源解析
+* 需在加载配置前注册，已加载的配置可调用config.Reload()重新解析
+*
+* param  scheme    引用类型，如vault、kms
+* param  provider  密钥来源
+ */
+func RegisterSecretProvider(scheme string, provider SecretProvider) {
+	secretLock.Lock()
+	defer secretLock.Unlock()
+	secretProviders[strings.ToLower(scheme)] = provider
+}
+
+//内部方法：从环境变量读取密钥
+func envSecret(ref string) (string, error) {
+	val, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("环境变量未设置:%s", ref)
+	}
+	return val, nil
+}
+
+//内部方法：从文件读取密钥（去除末尾换行）
+func fileSecret(ref string) (string, error) {
+	data, err := ioutil.ReadFile(ref)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+/*
+* 解析配置值中的密钥引用和加密内容
+*
+* param  val  配置值
+* return 解析后的配置值
+ */
+func ResolveSecret(val string) (string, error) {
+	if strings.HasPrefix(val, EncryptedPrefix) {
+		return DecryptSecret(val)
+	}
+	if !strings.Contains(val, "${") {
+		return val, nil
+	}
+
+	var rerr error
+	res := secretRef.ReplaceAllStringFunc(val, func(m string) string {
+		sub := secretRef.FindStringSubmatch(m)
+		secretLock.RLock()
+		p, ok := secretProviders[strings.ToLower(sub[1])]
+		secretLock.RUnlock()
+		if !ok {
+			if rerr == nil {
+				rerr = fmt.Errorf("未注册的密钥来源:%s", sub[1])
+			}
+			return m
+		}
+
+		s, err := p.Resolve(sub[2])
+		if err != nil && rerr == nil {
+			rerr = fmt.Errorf("解析密钥%s失败:%s", m, err)
+		}
+		return s
+	})
+	if rerr != nil {
+		return "", rerr
+	}
+	return res, nil
+}
+
+/*
+* 加密配置值，返回enc:AES256:<base64>格式，主密钥取自环境变量GOLANGLIB_MASTER_KEY
+*
+* param  plain  明文
+* return 密文
+ */
+func EncryptSecret(plain string) (string, error) {
+	gcm, err := masterCipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return EncryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+/*
+* 解密enc:AES256:<base64>格式的配置值
+*
+* param  val  密文
+* return 明文
+ */
+func DecryptSecret(val string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(val, EncryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("加密配置格式错误:%s", err)
+	}
+
+	gcm, err := masterCipher()
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("加密配置内容长度错误")
+	}
+
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("解密配置失败:%s", err)
+	}
+	return string(plain), nil
+}
+
+//内部方法：根据主密钥构建AES256-GCM
+func masterCipher() (cipher.AEAD, error) {
+	key := os.Getenv(EnvMasterKey)
+	if key == "" {
+		return nil, fmt.Errorf("未设置配置主密钥:%s", EnvMasterKey)
+	}
+
+	raw := []byte(key)
+	if len(raw) != 32 {
+		if b, err := base64.StdEncoding.DecodeString(key); err == nil && len(b) == 32 {
+			raw = b
+		} else {
+			return nil, errors.New("配置主密钥长度必须为32位")
+		}
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//密钥解析失败的配置项，解析失败的配置项保留原值，其余配置项正常加载
+type SecretError struct {
+	Keys   []string //解析失败的配置项，如redis.password、dbs.db[0].str
+	Errors []error  //对应的错误
+}
+
+func (e *SecretError) Error() string {
+	msgs := make([]string, len(e.Keys))
+	for i, key := range e.Keys {
+		msgs[i] = fmt.Sprintf("配置项%s:%s", key, e.Errors[i])
+	}
+	return strings.Join(msgs, "; ")
+}
+
+//内部方法：记录解析失败的配置项
+func (e *SecretError) add(key string, err error) {
+	e.Keys = append(e.Keys, key)
+	e.Errors = append(e.Errors, err)
+}
+
+func (e *SecretError) Len() int           { return len(e.Keys) }
+func (e *SecretError) Less(i, j int) bool { return e.Keys[i] < e.Keys[j] }
+func (e *SecretError) Swap(i, j int) {
+	e.Keys[i], e.Keys[j] = e.Keys[j], e.Keys[i]
+	e.Errors[i], e.Errors[j] = e.Errors[j], e.Errors[i]
+}
+
+//内部方法：解析全部配置中的密钥引用，部分配置项解析失败时仍返回配置和*SecretError
+func resolveSecrets(nv *viper.Viper) (*viper.Viper, error) {
+	settings := nv.AllSettings()
+	serr := &SecretError{}
+	if resolveNode("", settings, serr) {
+		var err error
+		if nv, err = rebuild(nv, settings); err != nil {
+			return nil, err
+		}
+	}
+	if len(serr.Keys) > 0 {
+		sort.Sort(serr)
+		return nv, serr
+	}
+	return nv, nil
+}
+
+//内部方法：递归解析节点，返回是否有变化，解析失败的配置项保留原值并记录到serr
+func resolveNode(key string, node interface{}, serr *SecretError) bool {
+	changed := false
+	switch t := node.(type) {
+	case map[string]interface{}:
+		for k, item := range t {
+			path := k
+			if key != "" {
+				path = key + "." + k
+			}
+			if s, ok := item.(string); ok {
+				res, err := ResolveSecret(s)
+				if err != nil {
+					serr.add(path, err)
+					continue
+				}
+				if res != s {
+					t[k] = res
+					changed = true
+				}
+				continue
+			}
+			changed = resolveNode(path, item, serr) || changed
+		}
+		return changed
+	}
+
+	rv := reflect.ValueOf(node)
+	if node == nil || rv.Kind() != reflect.Slice {
+		return false
+	}
+	for i := 0; i < rv.Len(); i++ {
+		path := fmt.Sprintf("%s[%d]", key, i)
+		item := rv.Index(i)
+		if s, ok := item.Interface().(string); ok {
+			res, err := ResolveSecret(s)
+			if err != nil {
+				serr.add(path, err)
+				continue
+			}
+			if res != s {
+				item.Set(reflect.ValueOf(res))
+				changed = true
+			}
+			continue
+		}
+		changed = resolveNode(path, item.Interface(), serr) || changed
+	}
+	return changed
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	syslog "log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+//配置变更回调函数，old/new为变更前后的子节点配置（节点不存在时为nil）
+type ChangeFunc func(old, new *viper.Viper)
+
+type subscriber struct {
+	key string
+	fn  ChangeFunc
+}
+
+var (
+	lastOpts    *loadOptions
+	subscribers []subscriber
+	subLock     sync.Mutex
+
+	watcher   *fsnotify.Watcher
+	watchLock sync.Mutex
+)
+
+//监听事件合并的时间窗口，编辑器保存文件时通常会连续触发多个事件
+var watchDelay = 200 * time.Millisecond
+
+/*
+* 订阅配置节点变更，重新加载后节点内容有变化时回调
+*
+* param  key  配置节点，如redis、dbs、http，传空值时订阅全部配置
+* param  fn   回调函数
+ */
+func OnChange(key string, fn ChangeFunc) {
+	subLock.Lock()
+	defer subLock.Unlock()
+	subscribers = append(subscribers, subscriber{key: strings.ToLower(key), fn: fn})
+}
+
+/*
+* 按上次加载的选项重新加载配置
+*
+* return 是否异常
+ */
+func Reload() error {
+	mu.RLock()
+	o := lastOpts
+	mu.RUnlock()
+
+	if o == nil {
+		return Load()
+	}
+	if o.reader != nil {
+		return errors.New("从内存加载的配置不支持重新加载")
+	}
+
+	//固定为首次加载时找到的文件，避免搜索路径下文件变化后切换了配置来源
+	ro := *o
+	if ro.file == "" {
+		ro.file = ConfigFileUsed()
+	}
+	return load(&ro)
+}
+
+/*
+* 监听配置文件（含环境配置文件）变更，变更后自动重新加载并通知订阅者
+* 重复调用时只监听一次
+*
+* return 是否异常
+ */
+func Watch() error {
+	watchLock.Lock()
+	defer watchLock.Unlock()
+
+	if watcher != nil {
+		return nil
+	}
+
+	file := ConfigFileUsed()
+	if file == "" {
+		return errors.New("未从文件加载配置，无法监听")
+	}
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	//监听目录，兼容编辑器先删除再创建文件的保存方式
+	dir := filepath.Dir(file)
+	if err = w.Add(dir); err != nil {
+		_ = w.Close()
+		return err
+	}
+	watcher = w
+
+	ext := filepath.Ext(file)
+	prefix := strings.TrimSuffix(filepath.Base(file), ext)
+	go func() {
+		var timer *time.Timer
+		for {
+			select {
+			case event, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				name := filepath.Base(event.Name)
+				if filepath.Dir(filepath.Clean(event.Name)) != dir || filepath.Ext(name) != ext || !strings.HasPrefix(name, prefix) {
+					continue
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(watchDelay, func() {
+					if err := Reload(); err != nil {
+						syslog.Printf("config: 重新加载配置失败:%s", err)
+					}
+				})
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				syslog.Printf("config: 监听配置文件错误:%s", err)
+			}
+		}
+	}()
+	return nil
+}
+
+//停止监听配置文件
+func StopWatch() {
+	watchLock.Lock()
+	defer watchLock.Unlock()
+
+	if watcher != nil {
+		_ = watcher.Close()
+		watcher = nil
+	}
+}
+
+//内部方法：通知订阅者配置变更
+func notify(old, nv *viper.Viper) {
+	subLock.Lock()
+	subs := make([]subscriber, len(subscribers))
+	copy(subs, subscribers)
+	subLock.Unlock()
+
+	for _, s := range subs {
+		if sectionEqual(old, nv, s.key) {
+			continue
+		}
+		callSubscriber(s, subView(old, s.key), subView(nv, s.key))
+	}
+}
+
+//内部方法：执行回调，避免单个订阅者异常影响其他订阅者
+func callSubscriber(s subscriber, old, nv *viper.Viper) {
+	defer func() {
+		if err := recover(); err != nil {
+			syslog.Printf("config: 配置变更回调(%s)异常:%v", s.key, err)
+		}
+	}()
+	s.fn(old, nv)
+}
+
+//内部方法：获取节点配置
+func subView(cv *viper.Viper, key string) *viper.Viper {
+	if cv == nil {
+		return nil
+	}
+	if key == "" {
+		return cv
+	}
+	return cv.Sub(key)
+}
+
+//内部方法：比较节点配置是否一致
+func sectionEqual(old, nv *viper.Viper, key string) bool {
+	return sectionString(old, key) == sectionString(nv, key)
+}
+
+//内部方法：节点配置序列化（键有序）
+func sectionString(cv *viper.Viper, key string) string {
+	if cv == nil {
+		return ""
+	}
+	var val interface{}
+	if key == "" {
+		val = cv.AllSettings()
+	} else {
+		val = cv.Get(key)
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Sprintf("%v", val)
+	}
+	return string(data)
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/maclon-lee/golanglib/lib/config"
+	_ "github.com/maclon-lee/golanglib/lib/elastic_v6/schema"
 	httpclient "github.com/maclon-lee/golanglib/lib/httpd/client"
 	"github.com/maclon-lee/golanglib/lib/json"
 	"net"
@@ -22,6 +23,9 @@ import (
 	logger "github.com/maclon-lee/golanglib/lib/log"
 )
 
+//ES模块日志
+var log = logger.Named("es6")
+
 //批量存储参数（增、删、改）
 var (
 	TInsert = 1
@@ -38,8 +42,8 @@ type TypeBatchData struct {
 type EsContext struct {
 	es *elasticsearch6.Client
 
-	Name     string   `mapstructure:"name"`
-	Address  []string `mapstructure:"address"`
+	Name     string   `mapstructure:"name" validate:"required"`
+	Address  []string `mapstructure:"address" validate:"required,dive,url"`
 	Username string   `mapstructure:"username"`
 	Password string   `mapstructure:"password"`
 }
@@ -98,7 +102,7 @@ func init() {
 		for i, ctx := range cfgList {
 			es, err := newEngine(ctx.Address, ctx.Username, ctx.Password)
 			if err != nil {
-				logger.Errorf("Error creating Elasticsearch client: %s", err)
+				log.Errorf("Error creating Elasticsearch client: %s", err)
 				continue
 			}
 
@@ -773,7 +777,7 @@ func (etx EsContext) BatchStoreData(index string, documentType interface{}, data
 							}
 						}
 						if err, ok := inret["error"]; ok {
-							logger.Warnf("eserror data:%v err:%v", datas[_i].Data, err)
+							log.Warnf("eserror data:%v err:%v", datas[_i].Data, err)
 						}
 
 						if inret["result"] == "created" {
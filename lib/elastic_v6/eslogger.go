@@ -7,8 +7,6 @@ import (
 	"io/ioutil"
 	"net/http"
 	"time"
-
-	logger "github.com/maclon-lee/golanglib/lib/log"
 )
 
 // ESLogger implements the estransport.Logger interface.
@@ -45,15 +43,15 @@ func (l *ESLogger) LogRoundTrip(
 	//
 	switch {
 	case err != nil:
-		logger.Errorf(loginfo)
+		log.Errorf(loginfo)
 	case res != nil && res.StatusCode > 0 && res.StatusCode < 400:
-		logger.Infof(loginfo)
+		log.Infof(loginfo)
 	case res != nil && res.StatusCode > 399 && res.StatusCode < 500:
-		logger.Warnf(loginfo)
+		log.Warnf(loginfo)
 	case res != nil && res.StatusCode > 499:
-		logger.Errorf(loginfo)
+		log.Errorf(loginfo)
 	default:
-		logger.Warnf(loginfo)
+		log.Warnf(loginfo)
 	}
 
 	return nil
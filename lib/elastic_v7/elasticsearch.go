@@ -6,11 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"github.com/maclon-lee/golanglib/lib/config"
+	_ "github.com/maclon-lee/golanglib/lib/elastic_v7/schema"
 	httpclient "github.com/maclon-lee/golanglib/lib/httpd/client"
 	"github.com/maclon-lee/golanglib/lib/json"
+	"github.com/spf13/viper"
 	"net"
 	"net/http"
 	"strconv"
+	"sync"
 
 	//"reflect"
 	"strings"
@@ -22,6 +25,9 @@ import (
 	logger "github.com/maclon-lee/golanglib/lib/log"
 )
 
+//ES模块日志
+var log = logger.Named("es7")
+
 //批量存储参数（增、删、改）
 var (
 	TInsert = 1
@@ -38,14 +44,15 @@ type TypeBatchData struct {
 type EsContext struct {
 	es *elasticsearch7.Client
 
-	Name     string   `mapstructure:"name"`
-	Address  []string `mapstructure:"address"`
+	Name     string   `mapstructure:"name" validate:"required"`
+	Address  []string `mapstructure:"address" validate:"required,dive,url"`
 	Username string   `mapstructure:"username"`
 	Password string   `mapstructure:"password"`
 }
 
 //ES对象集合
 var etxs map[string]*EsContext
+var etxLock sync.RWMutex
 var isInit = false
 
 //构造ElasticSearch引擎
@@ -85,28 +92,45 @@ func init() {
 	}
 	isInit = true
 
-	if config.IsSet("es7") {
-		var cfgList []EsContext
-		dbConf := config.GetSubConfig("es7")
+	if err := loadContexts(config.GetSubConfig("es7")); err != nil {
+		panic(err)
+	}
+
+	//配置变更时重建客户端
+	config.OnChange("es7", func(_, nv *viper.Viper) {
+		if err := loadContexts(nv); err != nil {
+			log.Errorf("%s", err)
+		}
+	})
+}
+
+//内部方法：按配置构建ES客户端
+func loadContexts(dbConf *viper.Viper) error {
+	var cfgList []EsContext
+	if dbConf != nil {
 		err := dbConf.UnmarshalKey("db", &cfgList)
 		if err != nil {
-			panic(fmt.Errorf("ES配置错误:%s", err))
+			return fmt.Errorf("ES配置错误:%s", err)
 		}
+	}
 
-		etxs = make(map[string]*EsContext, 0)
-
-		for i, ctx := range cfgList {
-			es, err := newEngine(ctx.Address, ctx.Username, ctx.Password)
-			if err != nil {
-				logger.Errorf("Error creating Elasticsearch client: %s", err)
-				continue
-			}
-
-			c := &cfgList[i]
-			c.es = es
-			etxs[ctx.Name] = c
+	news := make(map[string]*EsContext, 0)
+	for i, ctx := range cfgList {
+		es, err := newEngine(ctx.Address, ctx.Username, ctx.Password)
+		if err != nil {
+			log.Errorf("Error creating Elasticsearch client: %s", err)
+			continue
 		}
+
+		c := &cfgList[i]
+		c.es = es
+		news[ctx.Name] = c
 	}
+
+	etxLock.Lock()
+	etxs = news
+	etxLock.Unlock()
+	return nil
 }
 
 /*
@@ -114,6 +138,9 @@ func init() {
 * 参数esKey：对应为config.toml中es.db的name值
  */
 func GetContext(esKey string) (*EsContext, error) {
+	etxLock.RLock()
+	defer etxLock.RUnlock()
+
 	if etx, ok := etxs[esKey]; ok {
 		return etx, nil
 	}
@@ -783,7 +810,7 @@ func (etx EsContext) BatchStoreData(index string, documentType interface{}, data
 							}
 						}
 						if err, ok := inret["error"]; ok {
-							logger.Warnf("eserror data:%v err:%v", datas[_i].Data, err)
+							log.Warnf("eserror data:%v err:%v", datas[_i].Data, err)
 						}
 
 						if inret["result"] == "created" {
@@ -0,0 +1,68 @@
+package elastic_v7
+
+import (
+	"errors"
+	"fmt"
+	logger "github.com/maclon-lee/golanglib/lib/log"
+	"github.com/spf13/viper"
+)
+
+//日志输出目标：批量写入ES，在log.sinks中以type="es7"引用
+type logSink struct {
+	name  string
+	index string
+}
+
+func init() {
+	logger.RegisterSink("es7", newLogSink)
+}
+
+/*
+* 内部方法：构建ES日志输出目标
+* 配置项：name对应es7.db的name值，index为索引前缀（默认log），按天写入索引 前缀-YYYY.MM.DD
+ */
+func newLogSink(cnf *viper.Viper) (logger.Sink, error) {
+	name := cnf.GetString("name")
+	if name == "" {
+		return nil, errors.New("es7 name not config")
+	}
+	if _, err := GetContext(name); err != nil {
+		return nil, err
+	}
+
+	index := cnf.GetString("index")
+	if index == "" {
+		index = "log"
+	}
+	return &logSink{name: name, index: index}, nil
+}
+
+//批量写入，按日志日期分索引
+func (s *logSink) Write(entries []*logger.Entry) error {
+	etx, err := GetContext(s.name)
+	if err != nil {
+		return err
+	}
+
+	groups := make(map[string][]interface{})
+	for _, e := range entries {
+		index := fmt.Sprintf("%s-%s", s.index, e.Time.Format("2006.01.02"))
+		groups[index] = append(groups[index], e)
+	}
+	for index, datas := range groups {
+		result, err := etx.BatchInsertData(index, nil, make([]string, len(datas)), datas...)
+		if err != nil {
+			return err
+		}
+		if ret, ok := result.(map[string][]int); ok && len(ret["fails"]) > 0 {
+			return fmt.Errorf("索引%s写入失败%d条", index, len(ret["fails"]))
+		}
+	}
+	return nil
+}
+
+//无需关闭，ES客户端由配置统一管理
+func (s *logSink) Close() error {
+	return nil
+}
+
@@ -0,0 +1,21 @@
+//es7配置节点结构，仅注册校验规则，不建立连接，可单独引入用于配置校验
+package schema
+
+import "github.com/maclon-lee/golanglib/lib/config"
+
+//ES连接配置，与elastic_v7.EsContext的配置字段一致
+type Db struct {
+	Name     string   `mapstructure:"name" validate:"required"`
+	Address  []string `mapstructure:"address" validate:"required,dive,url"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+}
+
+//ES配置结构
+type Conf struct {
+	Db []Db `mapstructure:"db" validate:"dive"`
+}
+
+func init() {
+	config.RegisterSection("es7", Conf{}, false)
+}
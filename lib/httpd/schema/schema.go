@@ -0,0 +1,27 @@
+//http配置节点结构，lib/httpd按此结构读取配置，可单独引入用于配置校验
+package schema
+
+import "github.com/maclon-lee/golanglib/lib/config"
+
+//HTTP API帐号
+type User struct {
+	Username string `mapstructure:"basicAuthUsername"`
+	Password string `mapstructure:"basicAuthUserPassword"`
+
+	ShaAuthKey    string `mapstructure:"shaAuthKey"`
+	ShaAuthSecret string `mapstructure:"shaAuthSecret"`
+	ShaExpiration int    `mapstructure:"shaExpiration" validate:"min=0"`
+}
+
+//HTTP API鉴权配置结构
+type Conf struct {
+	AuthType  int     `mapstructure:"authType" validate:"oneof=0 1"`
+	IsEncrypt bool    `mapstructure:"isEncrypt"`
+	User      []*User `mapstructure:"user" validate:"dive"`
+
+	LogLevelApi bool `mapstructure:"logLevelApi"` //开启日志级别接口，需配置鉴权账号
+}
+
+func init() {
+	config.RegisterSection("http", Conf{}, false)
+}
@@ -6,23 +6,32 @@ import (
 	"github.com/gin-contrib/pprof"
 	"github.com/gin-gonic/gin"
 	"github.com/maclon-lee/golanglib/lib/config"
+	"github.com/maclon-lee/golanglib/lib/httpd/schema"
 	signer "github.com/maclon-lee/golanglib/lib/httpd/auth"
 	logger "github.com/maclon-lee/golanglib/lib/log"
 	"net/http"
 	"os"
 	"os/signal"
+	"github.com/spf13/viper"
 	"strings"
+	"sync"
 	"time"
 )
 
+//httpd模块日志
+var log = logger.Named("httpd")
+
 const (
 	WebApiPort       = 80
 	HttpReadTimeout  = 30
 	HttpWriteTimeout = 60
+	HeaderRequestId  = "X-Request-Id"
+	LogLevelPath     = "/log/level" //日志级别接口，GET查询，PUT修改（请求体：{"level":"info"}），配置http.logLevelApi=true时开启
 )
 var apiAuthUsers []*apiAuthUser
 var authType = 0       // 0为basic验证(默认), 1为sha256验证
 var isEncrypt = false  // 是否传输内容AES256加密，true为针对Body内容加密，false为不加密
+var authLock sync.RWMutex
 
 // Httpd服务
 type server struct {
@@ -33,14 +42,7 @@ type server struct {
 	Throttle func() gin.HandlerFunc                // 限流(频率限制、协程数限制和超时限制)
 }
 //HTTP API帐号
-type apiAuthUser struct {
-	Username string `mapstructure:"basicAuthUsername"`
-	Password string `mapstructure:"basicAuthUserPassword"`
-
-	ShaAuthKey    string `mapstructure:"shaAuthKey"`
-	ShaAuthSecret string `mapstructure:"shaAuthSecret"`
-	ShaExpiration int    `mapstructure:"shaExpiration"`
-}
+type apiAuthUser = schema.User
 
 /*
 * 创建HTTP API服务
@@ -67,33 +69,19 @@ func NewHttpServer(appName string, port int, router func(*gin.Engine), stats fun
 
 //启动http server的监听
 func (this server) Start() {
-	//加载鉴权配置
-	if config.IsSet("http") {
-		cnf := config.GetSubConfig("http")
-
-		if cnf.IsSet("authType") {
-			authType = cnf.GetInt("authType")
-		}
-		if cnf.IsSet("isEncrypt") {
-			isEncrypt = cnf.GetBool("isEncrypt")
-		}
-
-		if cnf.IsSet("user") {
-			err := cnf.UnmarshalKey("user", &apiAuthUsers)
-			if err != nil {
-				logger.Errorf("读取HTTP API鉴权账号失败")
-			}
-		}
-		if cnf.IsSet("basicAuthUsername") && cnf.IsSet("basicAuthUserPassword") {
-			apiAuthUsers = append(apiAuthUsers, &apiAuthUser{
-				Username: cnf.GetString("basicAuthUsername"),
-				Password: cnf.GetString("basicAuthUserPassword"),
-			})
-		}
-	}
+	//加载鉴权配置，配置变更时重新加载
+	loadAuthConfig(config.GetSubConfig("http"))
+	config.OnChange("http", func(_, nv *viper.Viper) {
+		loadAuthConfig(nv)
+	})
 
 	// 构建GIN引擎;
 	r := this.engine()
+	// 日志级别接口(配置http.logLevelApi开启, 需鉴权账号);
+	if cnf := config.GetSubConfig("http"); cnf != nil && cnf.GetBool("logLevelApi") {
+		r.GET(LogLevelPath, authRequired(), gin.WrapH(logger.LevelHandler()))
+		r.PUT(LogLevelPath, authRequired(), gin.WrapH(logger.LevelHandler()))
+	}
 	// URL路由注册;
 	this.Router(r)
 
@@ -112,9 +100,9 @@ func (this server) Start() {
 	// 启动服务;
 	go func() {
 		if err := s.ListenAndServe(); err != nil {
-			logger.Errorf("启动服务:%v失败(:%v), err:%v.", this.Name, this.Port, err)
+			log.Errorf("启动服务:%v失败(:%v), err:%v.", this.Name, this.Port, err)
 		} else {
-			logger.Infof("启动服务:%v成功(:%v).", this.Name, this.Port)
+			log.Infof("启动服务:%v成功(:%v).", this.Name, this.Port)
 		}
 	}()
 
@@ -128,10 +116,54 @@ func (this server) Start() {
 	defer cancel()
 	// 热重启;
 	if err := s.Shutdown(ctx); err != nil {
-		logger.Errorf("关闭服务:%v失败(:%v), err:%v.", this.Name, this.Port, err)
+		log.Errorf("关闭服务:%v失败(:%v), err:%v.", this.Name, this.Port, err)
 	} else {
-		logger.Infof("关闭服务:%v成功(:%v).", this.Name, this.Port)
+		log.Infof("关闭服务:%v成功(:%v).", this.Name, this.Port)
 	}
+	// 发送缓冲中的日志;
+	logger.Close()
+}
+
+//内部方法：加载鉴权配置
+func loadAuthConfig(cnf *viper.Viper) {
+	var users []*apiAuthUser
+	_authType := 0
+	_isEncrypt := false
+
+	if cnf != nil {
+		if cnf.IsSet("authType") {
+			_authType = cnf.GetInt("authType")
+		}
+		if cnf.IsSet("isEncrypt") {
+			_isEncrypt = cnf.GetBool("isEncrypt")
+		}
+
+		if cnf.IsSet("user") {
+			err := cnf.UnmarshalKey("user", &users)
+			if err != nil {
+				log.Errorf("读取HTTP API鉴权账号失败")
+			}
+		}
+		if cnf.IsSet("basicAuthUsername") && cnf.IsSet("basicAuthUserPassword") {
+			users = append(users, &apiAuthUser{
+				Username: cnf.GetString("basicAuthUsername"),
+				Password: cnf.GetString("basicAuthUserPassword"),
+			})
+		}
+	}
+
+	authLock.Lock()
+	apiAuthUsers = users
+	authType = _authType
+	isEncrypt = _isEncrypt
+	authLock.Unlock()
+}
+
+//内部方法：获取当前鉴权配置
+func authSetting() ([]*apiAuthUser, int, bool) {
+	authLock.RLock()
+	defer authLock.RUnlock()
+	return apiAuthUsers, authType, isEncrypt
 }
 
 // 构建GIN引擎;
@@ -149,6 +181,8 @@ func (this server) engine() *gin.Engine {
 	e := gin.New()
 	// K8S检测心跳(URL);
 	e.Use(heartbeat())
+	// 链路ID;
+	e.Use(trace())
 	// CORS跨域;
 	e.Use(cors())
 	//接口校验
@@ -174,6 +208,7 @@ func (this server) engine() *gin.Engine {
 //接口调用基本验证
 func auth() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		apiAuthUsers, authType, isEncrypt := authSetting()
 		authPass := false
 		if len(apiAuthUsers) > 0 {
 			if authType == 0 {
@@ -242,12 +277,39 @@ func auth() gin.HandlerFunc {
 	}
 }
 
+//必须通过账号鉴权，未配置鉴权账号时拒绝访问
+func authRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("AuthUserName") == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  "unauthorized",
+				"message": "接口需要鉴权账号",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+//链路ID，优先使用请求头X-Request-Id，可通过 logger.Ctx(c) 输出带链路ID的日志
+func trace() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := logger.ContextWithTraceID(c.Request.Context(), c.GetHeader(HeaderRequestId))
+		id := logger.TraceID(ctx)
+		c.Request = c.Request.WithContext(ctx)
+		c.Set(logger.TraceIDKey, id)
+		c.Header(HeaderRequestId, id)
+		c.Next()
+	}
+}
+
 //日志
 func logging() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		stamp := time.Now()
 		c.Next()
-		logger.Infof("调用结束(APIs %s), 耗时: %v.", c.Request.URL.Path, time.Since(stamp))
+		log.Ctx(c).Infof("调用结束(APIs %s), 耗时: %v.", c.Request.URL.Path, time.Since(stamp))
 	}
 }
 
@@ -259,9 +321,9 @@ func _recover() gin.HandlerFunc {
 			if err := recover(); err != nil {
 				errMsg := fmt.Sprintf("%s", err)
 				if strings.Index(errMsg, "i/o timeout. Response") != -1 || strings.Index(errMsg, "broken pipe. Response") != -1 {
-					logger.Warnf("API请求错误, URL:%s, Error:%s.", c.FullPath(), errMsg)
+					log.Ctx(c).Warnf("API请求错误, URL:%s, Error:%s.", c.FullPath(), errMsg)
 				} else {
-					logger.Errorf("API请求错误, URL:%s, Error:%s.", c.FullPath(), errMsg)
+					log.Ctx(c).Errorf("API请求错误, URL:%s, Error:%s.", c.FullPath(), errMsg)
 				}
 
 				c.AbortWithStatus(http.StatusInternalServerError)
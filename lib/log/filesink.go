@@ -0,0 +1,54 @@
+package logger
+
+import (
+	"github.com/maclon-lee/golanglib/lib/json"
+	"github.com/maclon-lee/golanglib/lib/utility"
+	"github.com/spf13/viper"
+	"path/filepath"
+)
+
+//本地JSON行文件输出目标，每行一条日志，按天切割
+type fileSink struct {
+	writer *RotateWriter
+}
+
+/*
+* 内部方法：构建本地JSON行文件输出目标
+* 配置项：dir目录（默认为日志目录下的json），maxSize、maxAge、maxBackups、compress同log节点
+ */
+func newFileSink(cnf *viper.Viper) (Sink, error) {
+	dir := cnf.GetString("dir")
+	if dir == "" {
+		path, _ := utility.GetPathValid("./log/", "../log/", "../../log/")
+		dir = filepath.Join(path, "json")
+	}
+
+	return &fileSink{
+		writer: &RotateWriter{
+			Dir:        dir,
+			MaxSize:    cnf.GetInt64("maxSize") * 1024 * 1024,
+			MaxAge:     cnf.GetInt("maxAge"),
+			MaxBackups: cnf.GetInt("maxBackups"),
+			Compress:   cnf.GetBool("compress"),
+		},
+	}, nil
+}
+
+//写入文件，按行写入，切割时不会截断
+func (s *fileSink) Write(entries []*Entry) error {
+	for _, e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if _, err = s.writer.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//关闭文件
+func (s *fileSink) Close() error {
+	return s.writer.Close()
+}
@@ -1,41 +1,252 @@
 package logger
 
 import (
+	"errors"
 	"fmt"
+	"github.com/maclon-lee/golanglib/lib/alert"
 	"github.com/maclon-lee/golanglib/lib/config"
+	"github.com/maclon-lee/golanglib/lib/log/schema"
 	"github.com/maclon-lee/golanglib/lib/utility"
+	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	syslog "log"
+	"net/http"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var log *zap.SugaredLogger
 
+//日志级别，可运行时调整
+var level = zap.NewAtomicLevel()
+
+//日志输出，配置变更时整体替换，已创建的子模块日志对象同步生效
+var output atomic.Value
+var outputLock sync.Mutex
+var fileWriter *RotateWriter
+
+//当前日志输出：本地输出和远程日志输出目标
+type logOutput struct {
+	core  zapcore.Core
+	sinks *sinkCore
+}
+
+//日志配置结构（config.toml中的log节点）
+type logConf = schema.Conf
+
 //初始化
 func init() {
-	var cfg zap.Config
+	if err := setup(config.GetSubConfig("log")); err != nil {
+		syslog.Panic(err)
+	}
+
+	//记录调用位置供远程日志使用，本地输出不显示
+	opts := []zap.Option{zap.AddCaller(), zap.AddCallerSkip(1), zap.ErrorOutput(zapcore.Lock(os.Stderr))}
 	if config.Env == "prod" {
-		cfg = zap.NewProductionConfig()
-		cfg.Level = zap.NewAtomicLevelAt(zapcore.WarnLevel)
+		opts = append(opts, zap.AddStacktrace(zapcore.ErrorLevel))
 	} else {
-		cfg = zap.NewDevelopmentConfig()
+		opts = append(opts, zap.Development(), zap.AddStacktrace(zapcore.WarnLevel))
 	}
-	cfg.EncoderConfig.EncodeTime = zapcore.TimeEncoderOfLayout(utility.FORMATSQLTIME)
+	log = zap.New(&swapCore{}, opts...).Sugar()
 
-	path, _ := utility.GetPathValid("./log/", "../log/", "../../log/")
+	//配置变更时重建日志输出
+	config.OnChange("log", func(_, nv *viper.Viper) {
+		if err := setup(nv); err != nil {
+			log.Errorf("日志配置错误:%s", err)
+		}
+	})
+	config.OnChange("aliyunlog", func(_, _ *viper.Viper) {
+		if err := setup(config.GetSubConfig("log")); err != nil {
+			log.Errorf("日志配置错误:%s", err)
+		}
+	})
+}
+
+//内部方法：按配置构建日志输出
+func setup(cnf *viper.Viper) error {
+	var c logConf
+	if cnf != nil {
+		if err := cnf.Unmarshal(&c); err != nil {
+			return err
+		}
+	}
 
-	filename := fmt.Sprintf("%s%s.log", path, time.Now().Format("20060102"))
-	cfg.OutputPaths = []string{"stdout", filename}
-	cfg.ErrorOutputPaths = []string{"stderr", filename}
-	cfg.DisableCaller = true
+	lvl := zapcore.DebugLevel
+	if config.Env == "prod" {
+		lvl = zapcore.WarnLevel
+	}
+	if c.Level != "" {
+		if err := lvl.Set(c.Level); err != nil {
+			return err
+		}
+	}
 
-	opt := zap.AddCallerSkip(1)
-	zablog, err := cfg.Build(opt)
+	var encoder zapcore.Encoder
+	encCfg := zap.NewDevelopmentEncoderConfig()
+	if config.Env == "prod" {
+		encCfg = zap.NewProductionEncoderConfig()
+	}
+	encCfg.EncodeTime = zapcore.TimeEncoderOfLayout(utility.FORMATSQLTIME)
+	encCfg.CallerKey = ""
+	format := c.Format
+	if format == "" {
+		format = "console"
+		if config.Env == "prod" {
+			format = "json"
+		}
+	}
+	if format == "json" {
+		encoder = zapcore.NewJSONEncoder(encCfg)
+	} else {
+		encoder = zapcore.NewConsoleEncoder(encCfg)
+	}
+
+	outputs := c.Outputs
+	if len(outputs) == 0 {
+		outputs = []string{"stdout", "file"}
+	}
+	var writer *RotateWriter
+	var syncers []zapcore.WriteSyncer
+	for _, o := range outputs {
+		switch o {
+		case "stdout":
+			syncers = append(syncers, zapcore.Lock(os.Stdout))
+		case "stderr":
+			syncers = append(syncers, zapcore.Lock(os.Stderr))
+		case "file":
+			dir := c.Dir
+			if dir == "" {
+				dir, _ = utility.GetPathValid("./log/", "../log/", "../../log/")
+			}
+			writer = &RotateWriter{
+				Dir:        dir,
+				MaxSize:    int64(c.MaxSize) * 1024 * 1024,
+				MaxAge:     c.MaxAge,
+				MaxBackups: c.MaxBackups,
+				Compress:   c.Compress,
+			}
+			syncers = append(syncers, writer)
+		default:
+			return errors.New("不支持的日志输出:" + o)
+		}
+	}
+
+	var core zapcore.Core = zapcore.NewCore(encoder, zapcore.NewMultiWriteSyncer(syncers...), level)
+	if config.Env == "prod" {
+		core = zapcore.NewSampler(core, time.Second, 100, 100)
+	}
+
+	sinks, err := buildSinks(cnf, c.Sinks)
 	if err != nil {
-		syslog.Panic(err)
+		if writer != nil {
+			_ = writer.Close()
+		}
+		return err
+	}
+
+	outputLock.Lock()
+	old, oldWriter := currentOutput(), fileWriter
+	fileWriter = writer
+	output.Store(&logOutput{core: core, sinks: sinks})
+	outputLock.Unlock()
+
+	level.SetLevel(lvl)
+	if oldWriter != nil {
+		_ = oldWriter.Close()
+	}
+	if old != nil && old.sinks != nil {
+		go old.sinks.close()
 	}
-	log = zablog.Sugar()
+	return nil
+}
+
+/*
+* 设置日志级别（运行时生效）
+*
+* param  lvl  日志级别：debug, info, warn, error
+* return 是否异常
+ */
+func SetLevel(lvl string) error {
+	var l zapcore.Level
+	if err := l.Set(lvl); err != nil {
+		return err
+	}
+	level.SetLevel(l)
+	return nil
+}
+
+//获取当前日志级别
+func GetLevel() string {
+	return level.Level().String()
+}
+
+/*
+* 日志级别HTTP接口
+* GET返回当前级别，PUT设置级别，请求体格式：{"level":"info"}
+ */
+func LevelHandler() http.Handler {
+	return level
+}
+
+//刷新日志缓冲
+func Sync() error {
+	return log.Sync()
+}
+
+//内部方法：当前日志输出
+func currentOutput() *logOutput {
+	o, _ := output.Load().(*logOutput)
+	return o
+}
+
+//内部方法：当前日志核心，本地输出与远程日志输出目标合并
+func currentCore() zapcore.Core {
+	o := currentOutput()
+	if o.sinks == nil {
+		return o.core
+	}
+	return zapcore.NewTee(o.core, o.sinks)
+}
+
+//可替换输出的日志核心，本地输出级别由level控制，远程日志按各输出目标的级别
+type swapCore struct {
+	fields []zapcore.Field
+}
+
+func (c *swapCore) Enabled(l zapcore.Level) bool {
+	o := currentOutput()
+	return level.Enabled(l) || (o.sinks != nil && o.sinks.Enabled(l))
+}
+
+func (c *swapCore) With(fields []zapcore.Field) zapcore.Core {
+	fs := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	fs = append(fs, c.fields...)
+	fs = append(fs, fields...)
+	return &swapCore{fields: fs}
+}
+
+func (c *swapCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(ent.Level) {
+		return ce
+	}
+	core := currentCore()
+	if len(c.fields) > 0 {
+		core = core.With(c.fields)
+	}
+	return core.Check(ent, ce)
+}
+
+func (c *swapCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	fs := append(append([]zapcore.Field{}, c.fields...), fields...)
+	return currentCore().Write(ent, fs)
+}
+
+func (c *swapCore) Sync() error {
+	return currentCore().Sync()
 }
 
 //调试日志
@@ -51,12 +262,19 @@ func Infof(format string, a ...interface{}) {
 //警告日志
 func Warnf(format string, a ...interface{}) {
 	log.Warnf(format, a...)
-	sendAliLog("Warn", format, a...)
 }
 
 //错误日志
 func Errorf(format string, a ...interface{}) {
 	log.Errorf(format, a...)
-	sendAliLog("Error", format, a...)
-	alarmByDingtalk(format, a...)
+	alarm(fmt.Sprintf(format, a...))
+}
+
+//内部方法：发送报警，报警位置为调用日志方法处
+func alarm(content string) {
+	source := ""
+	if _, file, line, ok := runtime.Caller(2); ok {
+		source = fmt.Sprintf("%s:%d", file, line)
+	}
+	alert.Send(alert.Message{Content: content, Source: source})
 }
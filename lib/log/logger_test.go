@@ -0,0 +1,100 @@
+package logger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+//内部方法：按配置重建日志输出，测试结束后恢复为只输出到标准输出
+func setupLog(t *testing.T, settings map[string]interface{}) {
+	t.Helper()
+	cnf := viper.New()
+	if err := cnf.MergeConfigMap(settings); err != nil {
+		t.Fatal(err)
+	}
+	if err := setup(cnf); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		Close()
+		std := viper.New()
+		_ = std.MergeConfigMap(map[string]interface{}{"outputs": []interface{}{"stdout"}})
+		_ = setup(std)
+	})
+}
+
+//内部方法：当前日志文件内容
+func logContent(t *testing.T) string {
+	t.Helper()
+	_ = Sync()
+	outputLock.Lock()
+	name := fileWriter.Filename()
+	outputLock.Unlock()
+	return readFile(t, name)
+}
+
+func TestSetLevel(t *testing.T) {
+	setupLog(t, map[string]interface{}{
+		"dir":     t.TempDir(),
+		"level":   "warn",
+		"format":  "json",
+		"outputs": []interface{}{"file"},
+	})
+	if l := GetLevel(); l != "warn" {
+		t.Errorf("level = %s", l)
+	}
+
+	Infof("info-1")
+	Warnf("warn-1")
+	if err := SetLevel("debug"); err != nil {
+		t.Fatal(err)
+	}
+	//子模块日志对象同样生效
+	Named("sql").Debugf("debug-1")
+	if err := SetLevel("verbose"); err == nil {
+		t.Error("expected error for invalid level")
+	}
+	if l := GetLevel(); l != "debug" {
+		t.Errorf("level after invalid = %s", l)
+	}
+
+	s := logContent(t)
+	if strings.Contains(s, "info-1") || !strings.Contains(s, "warn-1") || !strings.Contains(s, "debug-1") {
+		t.Errorf("log content = %s", s)
+	}
+
+	//HTTP接口查询和设置级别
+	h := LevelHandler()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/log/level", strings.NewReader(`{"level":"error"}`)))
+	if rec.Code != http.StatusOK || GetLevel() != "error" {
+		t.Errorf("PUT = %d %s, level = %s", rec.Code, rec.Body, GetLevel())
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/log/level", nil))
+	if !strings.Contains(rec.Body.String(), `"error"`) {
+		t.Errorf("GET = %s", rec.Body)
+	}
+	Warnf("warn-2")
+	if s = logContent(t); strings.Contains(s, "warn-2") {
+		t.Errorf("warn logged at error level: %s", s)
+	}
+
+	//重新加载配置时按配置的级别
+	setupLog(t, map[string]interface{}{"dir": t.TempDir(), "level": "info", "outputs": []interface{}{"file"}})
+	if l := GetLevel(); l != "info" {
+		t.Errorf("level after reload = %s", l)
+	}
+}
+
+func TestSetupInvalidOutput(t *testing.T) {
+	cnf := viper.New()
+	_ = cnf.MergeConfigMap(map[string]interface{}{"outputs": []interface{}{"syslog"}})
+	if err := setup(cnf); err == nil {
+		t.Error("expected error for unsupported output")
+	}
+}
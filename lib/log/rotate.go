@@ -0,0 +1,233 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//日志文件名格式：YYYYMMDD.log，按大小切割后为YYYYMMDD.N.log，压缩后追加.gz
+var rotateFileName = regexp.MustCompile(`^(\d{8})(?:\.(\d+))?\.log(\.gz)?$`)
+
+//按日期和大小切割的日志文件，实现zapcore.WriteSyncer
+type RotateWriter struct {
+	Dir        string //日志目录
+	MaxSize    int64  //单个文件最大字节数，0为不按大小切割
+	MaxAge     int    //保留天数，0为不限
+	MaxBackups int    //保留的历史文件数量，0为不限
+	Compress   bool   //是否gzip压缩历史文件
+
+	mu     sync.Mutex
+	file   *os.File
+	date   string
+	size   int64
+	closed bool
+	clean  sync.Mutex
+}
+
+//写入日志，跨天或超过大小时自动切割
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	today := time.Now().Format("20060102")
+	if w.file == nil || w.date != today {
+		if err := w.openDate(today); err != nil {
+			return 0, err
+		}
+	} else if w.MaxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.MaxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+//刷新到磁盘
+func (w *RotateWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+//关闭日志文件
+func (w *RotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.closed = true
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+//当前日志文件路径
+func (w *RotateWriter) Filename() string {
+	return w.filename(time.Now().Format("20060102"))
+}
+
+//内部方法：日志目录，未设置时为当前目录
+func (w *RotateWriter) dir() string {
+	if w.Dir == "" {
+		return "."
+	}
+	return w.Dir
+}
+
+//内部方法：日志文件路径
+func (w *RotateWriter) filename(date string) string {
+	return filepath.Join(w.Dir, date+".log")
+}
+
+//内部方法：打开指定日期的日志文件，跨天时处理前一天的文件
+func (w *RotateWriter) openDate(date string) error {
+	var prev string
+	if w.file != nil {
+		prev = w.file.Name()
+		_ = w.file.Close()
+		w.file = nil
+	}
+
+	if w.Dir != "" {
+		if err := os.MkdirAll(w.Dir, 0755); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(w.filename(date), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	w.file = f
+	w.date = date
+	w.size = info.Size()
+	go w.cleanup(prev)
+	return nil
+}
+
+//内部方法：按大小切割，当前文件重命名为YYYYMMDD.N.log
+func (w *RotateWriter) rotate() error {
+	name := w.file.Name()
+	_ = w.file.Close()
+	w.file = nil
+
+	backup := filepath.Join(w.Dir, fmt.Sprintf("%s.%d.log", w.date, w.nextIndex(w.date)))
+	if err := os.Rename(name, backup); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	w.file = f
+	w.size = 0
+	go w.cleanup(backup)
+	return nil
+}
+
+//内部方法：同一日期下一个切割序号
+func (w *RotateWriter) nextIndex(date string) int {
+	idx := 0
+	files, _ := ioutil.ReadDir(w.dir())
+	for _, f := range files {
+		m := rotateFileName.FindStringSubmatch(f.Name())
+		if m == nil || m[1] != date || m[2] == "" {
+			continue
+		}
+		if n, _ := strconv.Atoi(m[2]); n > idx {
+			idx = n
+		}
+	}
+	return idx + 1
+}
+
+//内部方法：压缩历史文件，按保留天数和数量清理
+func (w *RotateWriter) cleanup(backup string) {
+	w.clean.Lock()
+	defer w.clean.Unlock()
+
+	if backup != "" && w.Compress {
+		if err := gzipFile(backup); err != nil {
+			fmt.Fprintf(os.Stderr, "logger: 压缩日志文件%s失败:%s\n", backup, err)
+		}
+	}
+	if w.MaxAge <= 0 && w.MaxBackups <= 0 {
+		return
+	}
+
+	files, err := ioutil.ReadDir(w.dir())
+	if err != nil {
+		return
+	}
+	current := filepath.Base(w.Filename())
+	var backups []os.FileInfo
+	for _, f := range files {
+		if f.IsDir() || f.Name() == current || !rotateFileName.MatchString(f.Name()) {
+			continue
+		}
+		backups = append(backups, f)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].ModTime().After(backups[j].ModTime()) })
+
+	cutoff := time.Now().AddDate(0, 0, -w.MaxAge)
+	for i, f := range backups {
+		if (w.MaxBackups > 0 && i >= w.MaxBackups) || (w.MaxAge > 0 && f.ModTime().Before(cutoff)) {
+			_ = os.Remove(filepath.Join(w.Dir, f.Name()))
+		}
+	}
+}
+
+//内部方法：gzip压缩文件并删除原文件
+func gzipFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err = gz.Close(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	_ = src.Close()
+	return os.Remove(name)
+}
@@ -0,0 +1,226 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+//内部方法：目录中的文件名，按名称排序
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+//内部方法：等待后台压缩和清理完成
+func waitFiles(t *testing.T, dir string, want []string) {
+	t.Helper()
+	sort.Strings(want)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got := listFiles(t, dir)
+		if reflect.DeepEqual(got, want) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("files = %v, want %v", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+//内部方法：排序后的文件名
+func sorted(names []string) []string {
+	sort.Strings(names)
+	return names
+}
+
+//内部方法：读取文件内容，.gz文件解压
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if filepath.Ext(name) != ".gz" {
+		data, _ := ioutil.ReadAll(f)
+		return string(data)
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(gz)
+	return string(data)
+}
+
+func TestRotateWriterSize(t *testing.T) {
+	dir := t.TempDir()
+	today := time.Now().Format("20060102")
+	w := &RotateWriter{Dir: dir, MaxSize: 10}
+	defer w.Close()
+
+	for _, line := range []string{"line-1\n", "line-2\n", "line-3\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFiles(t, dir, []string{today + ".1.log", today + ".2.log", today + ".log"})
+	if s := readFile(t, filepath.Join(dir, today+".1.log")); s != "line-1\n" {
+		t.Errorf("first backup = %q", s)
+	}
+	if s := readFile(t, filepath.Join(dir, today+".2.log")); s != "line-2\n" {
+		t.Errorf("second backup = %q", s)
+	}
+	if s := readFile(t, w.Filename()); s != "line-3\n" {
+		t.Errorf("current = %q", s)
+	}
+
+	//超过大小的单条日志不切割空文件
+	big := make([]byte, 20)
+	w.MaxSize = 30
+	if _, err := w.Write(big); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	waitFiles(t, dir, []string{today + ".1.log", today + ".2.log", today + ".log"})
+}
+
+//切割序号跳过已有的历史文件，包括压缩后的.gz
+func TestRotateWriterNextIndex(t *testing.T) {
+	dir := t.TempDir()
+	today := time.Now().Format("20060102")
+	for _, name := range []string{today + ".1.log", today + ".3.log.gz", "20000101.7.log", "other.9.log"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := &RotateWriter{Dir: dir, MaxSize: 5, Compress: true}
+	defer w.Close()
+	if n := w.nextIndex(today); n != 4 {
+		t.Errorf("nextIndex = %d, want 4", n)
+	}
+	if n := w.nextIndex("20000101"); n != 8 {
+		t.Errorf("nextIndex 20000101 = %d, want 8", n)
+	}
+
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFiles(t, dir, []string{"20000101.7.log", "other.9.log", today + ".1.log", today + ".3.log.gz", today + ".4.log.gz", today + ".5.log.gz", today + ".log"})
+	if s := readFile(t, filepath.Join(dir, today+".4.log.gz")); s != "aaaa\n" {
+		t.Errorf("compressed backup = %q", s)
+	}
+}
+
+//跨天时切换到当天的文件，前一天的文件压缩
+func TestRotateWriterDate(t *testing.T) {
+	dir := t.TempDir()
+	today := time.Now().Format("20060102")
+	w := &RotateWriter{Dir: dir, Compress: true}
+	defer w.Close()
+
+	//模拟前一天打开的文件
+	if err := w.openDate("20000101"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.file.Write([]byte("old\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+	waitFiles(t, dir, []string{"20000101.log.gz", today + ".log"})
+	if s := readFile(t, filepath.Join(dir, "20000101.log.gz")); s != "old\n" {
+		t.Errorf("previous day = %q", s)
+	}
+	if s := readFile(t, filepath.Join(dir, today+".log")); s != "new\n" {
+		t.Errorf("today = %q", s)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("closed\n")); err != os.ErrClosed {
+		t.Errorf("write after close = %v", err)
+	}
+}
+
+func TestRotateWriterCleanup(t *testing.T) {
+	today := time.Now().Format("20060102")
+	//历史文件及距今天数
+	backups := map[string]int{
+		"20000101.log":      10,
+		"20000102.1.log.gz": 9,
+		"20000102.log.gz":   8,
+		"20000103.log":      2,
+		"20000104.1.log":    1,
+		"20000104.log":      0,
+		"notes.txt":         30,
+	}
+	setup := func(t *testing.T) string {
+		dir := t.TempDir()
+		for name, days := range backups {
+			path := filepath.Join(dir, name)
+			if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			mt := time.Now().AddDate(0, 0, -days).Add(-time.Minute)
+			if err := os.Chtimes(path, mt, mt); err != nil {
+				t.Fatal(err)
+			}
+		}
+		//当前文件最旧也不删除
+		current := filepath.Join(dir, today+".log")
+		_ = ioutil.WriteFile(current, nil, 0644)
+		_ = os.Chtimes(current, time.Unix(0, 0), time.Unix(0, 0))
+		return dir
+	}
+
+	dir := setup(t)
+	(&RotateWriter{Dir: dir, MaxBackups: 3}).cleanup("")
+	want := []string{"20000103.log", "20000104.1.log", "20000104.log", "notes.txt", today + ".log"}
+	if got := listFiles(t, dir); !reflect.DeepEqual(got, sorted(want)) {
+		t.Errorf("MaxBackups: files = %v, want %v", got, want)
+	}
+
+	dir = setup(t)
+	(&RotateWriter{Dir: dir, MaxAge: 5}).cleanup("")
+	want = []string{"20000103.log", "20000104.1.log", "20000104.log", "notes.txt", today + ".log"}
+	if got := listFiles(t, dir); !reflect.DeepEqual(got, sorted(want)) {
+		t.Errorf("MaxAge: files = %v, want %v", got, want)
+	}
+
+	dir = setup(t)
+	(&RotateWriter{Dir: dir, MaxAge: 9, MaxBackups: 5}).cleanup("")
+	want = []string{"20000102.log.gz", "20000103.log", "20000104.1.log", "20000104.log", "notes.txt", today + ".log"}
+	if got := listFiles(t, dir); !reflect.DeepEqual(got, sorted(want)) {
+		t.Errorf("MaxAge+MaxBackups: files = %v, want %v", got, want)
+	}
+
+	dir = setup(t)
+	(&RotateWriter{Dir: dir}).cleanup("")
+	if got := listFiles(t, dir); len(got) != len(backups)+1 {
+		t.Errorf("no limit: files = %v", got)
+	}
+}
@@ -0,0 +1,41 @@
+//日志配置节点（log、aliyunlog）结构，lib/log按此结构读取配置，可单独引入用于配置校验
+package schema
+
+import "github.com/maclon-lee/golanglib/lib/config"
+
+//日志配置结构（config.toml中的log节点）
+type Conf struct {
+	Dir        string   `mapstructure:"dir"`                                                    //日志目录，默认为./log/、../log/、../../log/中存在的目录
+	Level      string   `mapstructure:"level" validate:"omitempty,oneof=debug info warn error"` //日志级别，默认prod为warn，其他为debug
+	Format     string   `mapstructure:"format" validate:"omitempty,oneof=console json"`         //输出格式，默认prod为json，其他为console
+	Outputs    []string `mapstructure:"outputs" validate:"dive,oneof=stdout stderr file"`       //输出位置，默认为stdout和file
+	MaxSize    int      `mapstructure:"maxSize" validate:"min=0"`                               //单个文件最大MB，0为不按大小切割
+	MaxAge     int      `mapstructure:"maxAge" validate:"min=0"`                                //保留天数，0为不限
+	MaxBackups int      `mapstructure:"maxBackups" validate:"min=0"`                            //保留历史文件数量，0为不限
+	Compress   bool     `mapstructure:"compress"`                                               //是否gzip压缩历史文件
+	Sinks      []Sink   `mapstructure:"sinks" validate:"dive"`                                  //远程日志输出目标
+}
+
+//远程日志配置结构（log.sinks）
+type Sink struct {
+	Type          string `mapstructure:"type" validate:"required"`                               //类型：aliyunlog, file, es7, kafka
+	Level         string `mapstructure:"level" validate:"omitempty,oneof=debug info warn error"` //最低级别，默认warn
+	BatchSize     int    `mapstructure:"batchSize" validate:"min=0"`                             //每批条数，默认100
+	FlushInterval int    `mapstructure:"flushInterval" validate:"min=0"`                         //发送间隔，默认1000，单位：毫秒
+	BufferSize    int    `mapstructure:"bufferSize" validate:"min=0"`                            //缓冲条数，默认10000
+	Overflow      string `mapstructure:"overflow" validate:"omitempty,oneof=drop block"`         //缓冲满时：drop丢弃（默认），block阻塞等待
+}
+
+//阿里云日志配置结构
+type Aliyunlog struct {
+	Endpoint        string `mapstructure:"endpoint" validate:"required"`
+	AccessKeyID     string `mapstructure:"accessKeyID" validate:"required"`
+	AccessKeySecret string `mapstructure:"accessKeySecret" validate:"required"`
+	ProjectName     string `mapstructure:"projectName" validate:"required"`
+	StoreName       string `mapstructure:"storeName" validate:"required"`
+}
+
+func init() {
+	config.RegisterSection("log", Conf{}, false)
+	config.RegisterSection("aliyunlog", Aliyunlog{}, false)
+}
@@ -0,0 +1,415 @@
+package logger
+
+import (
+	stdjson "encoding/json"
+	"fmt"
+	"github.com/maclon-lee/golanglib/lib/config"
+	"github.com/maclon-lee/golanglib/lib/log/schema"
+	"github.com/spf13/viper"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//远程日志记录
+type Entry struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Logger  string                 `json:"logger,omitempty"` //子模块名称
+	Message string                 `json:"message"`
+	Caller  string                 `json:"caller,omitempty"` //调用位置，file:line
+	Stack   string                 `json:"stack,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+	Env     string                 `json:"env"`
+	Host    string                 `json:"host"`
+}
+
+//序列化为JSON，时间为RFC3339格式（带毫秒和时区），便于ES等按日期类型识别
+func (e *Entry) MarshalJSON() ([]byte, error) {
+	type entry Entry
+	return stdjson.Marshal(&struct {
+		Time string `json:"time"`
+		*entry
+	}{
+		Time:  e.Time.Format("2006-01-02T15:04:05.000Z07:00"),
+		entry: (*entry)(e),
+	})
+}
+
+//日志输出目标，由后台协程按批调用，无需自行处理并发
+type Sink interface {
+	Write(entries []*Entry) error
+	Close() error
+}
+
+//日志输出目标构造函数，cnf为log.sinks中对应的配置项
+type SinkFactory func(cnf *viper.Viper) (Sink, error)
+
+//远程日志配置结构（log.sinks）
+type sinkConf = schema.Sink
+
+var (
+	sinkFactories = map[string]SinkFactory{
+		"aliyunlog": newAliyunSink,
+		"file":      newFileSink,
+	}
+	sinkLock sync.RWMutex
+	hostname string
+)
+
+func init() {
+	hostname, _ = os.Hostname()
+}
+
+/*
+* 注册日志输出目标类型，注册后可在log.sinks中以type引用
+* 类型名称与子模块日志名称相同时（如es7、kafka），该模块自身的日志不发送到此目标，避免循环
+*
+* param  typ      类型名称
+* param  factory  构造函数
+ */
+func RegisterSink(typ string, factory SinkFactory) {
+	sinkLock.Lock()
+	sinkFactories[strings.ToLower(typ)] = factory
+	sinkLock.Unlock()
+
+	//日志初始化早于各模块，注册后按配置重建引用该类型的输出目标
+	cnf := config.GetSubConfig("log")
+	if cnf == nil {
+		return
+	}
+	var c logConf
+	if err := cnf.Unmarshal(&c); err != nil {
+		return
+	}
+	for _, sc := range c.Sinks {
+		if strings.EqualFold(sc.Type, typ) {
+			if err := setup(cnf); err != nil {
+				fmt.Fprintf(os.Stderr, "logger: 日志配置错误:%s\n", err)
+			}
+			return
+		}
+	}
+}
+
+//关闭全部日志输出目标，发送缓冲中的日志，程序退出前调用（httpd.Start在收到中断信号后调用）
+func Close() {
+	outputLock.Lock()
+	o := currentOutput()
+	output.Store(&logOutput{core: o.core})
+	outputLock.Unlock()
+
+	if o.sinks != nil {
+		o.sinks.close()
+	}
+}
+
+//内部方法：按配置构建日志输出目标
+func buildSinks(cnf *viper.Viper, confs []sinkConf) (*sinkCore, error) {
+	//未配置时兼容原有方式：生产环境配置了aliyunlog则发送warn及以上日志
+	if len(confs) == 0 {
+		if config.Env != "prod" || !config.IsSet("aliyunlog") {
+			return nil, nil
+		}
+		confs = []sinkConf{{Type: "aliyunlog"}}
+	}
+
+	var items []interface{}
+	if cnf != nil {
+		items, _ = cnf.Get("sinks").([]interface{})
+	}
+
+	core := &sinkCore{min: zapcore.FatalLevel}
+	for i, c := range confs {
+		sinkLock.RLock()
+		factory, ok := sinkFactories[strings.ToLower(c.Type)]
+		sinkLock.RUnlock()
+		if !ok {
+			//es7、kafka等类型在对应的包初始化时注册，注册后重建
+			continue
+		}
+
+		sv := viper.New()
+		if i < len(items) {
+			if m, ok := items[i].(map[string]interface{}); ok {
+				_ = sv.MergeConfigMap(m)
+			}
+		}
+		sink, err := factory(sv)
+		if err != nil {
+			core.close()
+			return nil, fmt.Errorf("日志输出%s配置错误:%s", c.Type, err)
+		}
+
+		w, err := newSinkWorker(strings.ToLower(c.Type), sink, c)
+		if err != nil {
+			_ = sink.Close()
+			core.close()
+			return nil, err
+		}
+		core.workers = append(core.workers, w)
+		if w.level < core.min {
+			core.min = w.level
+		}
+	}
+	if len(core.workers) == 0 {
+		return nil, nil
+	}
+	return core, nil
+}
+
+//日志输出目标的后台发送协程
+type sinkWorker struct {
+	dropped  int64 //丢弃条数，首字段保证64位对齐
+	typ      string
+	sink     Sink
+	level    zapcore.Level
+	batch    int
+	interval time.Duration
+	block    bool
+	ch       chan *Entry
+	quit     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+//内部方法：构建发送协程
+func newSinkWorker(typ string, sink Sink, c sinkConf) (*sinkWorker, error) {
+	w := &sinkWorker{
+		typ:      typ,
+		sink:     sink,
+		level:    zapcore.WarnLevel,
+		batch:    c.BatchSize,
+		interval: time.Duration(c.FlushInterval) * time.Millisecond,
+		block:    c.Overflow == "block",
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if c.Level != "" {
+		if err := w.level.Set(c.Level); err != nil {
+			return nil, err
+		}
+	}
+	if w.batch <= 0 {
+		w.batch = 100
+	}
+	if w.interval <= 0 {
+		w.interval = time.Second
+	}
+	size := c.BufferSize
+	if size <= 0 {
+		size = 10000
+	}
+	w.ch = make(chan *Entry, size)
+
+	go w.run()
+	return w, nil
+}
+
+//内部方法：放入缓冲，缓冲满时按配置丢弃或阻塞
+func (w *sinkWorker) put(e *Entry) {
+	if w.block {
+		select {
+		case w.ch <- e:
+		case <-w.quit:
+		}
+		return
+	}
+	select {
+	case w.ch <- e:
+	default:
+		atomic.AddInt64(&w.dropped, 1)
+	}
+}
+
+//内部方法：按批量或间隔发送
+func (w *sinkWorker) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	batch := make([]*Entry, 0, w.batch)
+	for {
+		select {
+		case e := <-w.ch:
+			batch = append(batch, e)
+			if len(batch) >= w.batch {
+				batch = w.flush(batch)
+			}
+		case <-ticker.C:
+			batch = w.flush(batch)
+		case <-w.quit:
+			for {
+				select {
+				case e := <-w.ch:
+					batch = append(batch, e)
+					if len(batch) >= w.batch {
+						batch = w.flush(batch)
+					}
+				default:
+					w.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+//内部方法：发送一批日志，错误输出到标准错误，避免循环记录
+func (w *sinkWorker) flush(batch []*Entry) []*Entry {
+	if n := atomic.SwapInt64(&w.dropped, 0); n > 0 {
+		fmt.Fprintf(os.Stderr, "logger: 日志输出%s缓冲已满，丢弃%d条日志\n", w.typ, n)
+	}
+	if len(batch) == 0 {
+		return batch
+	}
+
+	if err := w.write(batch); err != nil {
+		fmt.Fprintf(os.Stderr, "logger: 日志输出%s发送%d条日志失败:%s\n", w.typ, len(batch), err)
+	}
+	return batch[:0]
+}
+
+//内部方法：调用输出目标，捕获异常
+func (w *sinkWorker) write(batch []*Entry) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return w.sink.Write(batch)
+}
+
+//内部方法：停止发送协程并关闭输出目标，最多等待10秒
+func (w *sinkWorker) close() {
+	w.once.Do(func() {
+		close(w.quit)
+		select {
+		case <-w.done:
+		case <-time.After(10 * time.Second):
+			fmt.Fprintf(os.Stderr, "logger: 日志输出%s关闭超时\n", w.typ)
+		}
+		if err := w.sink.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "logger: 日志输出%s关闭失败:%s\n", w.typ, err)
+		}
+	})
+}
+
+//内部方法：是否接收该子模块的日志，类型与模块同名时不接收
+func (w *sinkWorker) accept(ent zapcore.Entry) bool {
+	if ent.Level < w.level {
+		return false
+	}
+	name := ent.LoggerName
+	return name != w.typ && !strings.HasPrefix(name, w.typ+".")
+}
+
+//分发日志到各输出目标的zap核心
+type sinkCore struct {
+	workers []*sinkWorker
+	min     zapcore.Level
+	fields  []zapcore.Field
+}
+
+func (c *sinkCore) Enabled(l zapcore.Level) bool {
+	return l >= c.min
+}
+
+func (c *sinkCore) With(fields []zapcore.Field) zapcore.Core {
+	fs := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	fs = append(fs, c.fields...)
+	fs = append(fs, fields...)
+	return &sinkCore{workers: c.workers, min: c.min, fields: fs}
+}
+
+func (c *sinkCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *sinkCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	var e *Entry
+	for _, w := range c.workers {
+		if !w.accept(ent) {
+			continue
+		}
+		if e == nil {
+			e = newEntry(ent, c.fields, fields)
+		}
+		w.put(e)
+	}
+	return nil
+}
+
+func (c *sinkCore) Sync() error {
+	return nil
+}
+
+//内部方法：关闭全部发送协程
+func (c *sinkCore) close() {
+	var wg sync.WaitGroup
+	for _, w := range c.workers {
+		wg.Add(1)
+		go func(w *sinkWorker) {
+			defer wg.Done()
+			w.close()
+		}(w)
+	}
+	wg.Wait()
+}
+
+//内部方法：构建日志记录
+func newEntry(ent zapcore.Entry, base, fields []zapcore.Field) *Entry {
+	e := &Entry{
+		Time:    ent.Time,
+		Level:   ent.Level.String(),
+		Logger:  ent.LoggerName,
+		Message: ent.Message,
+		Stack:   ent.Stack,
+		Env:     config.Env,
+		Host:    hostname,
+	}
+	if ent.Caller.Defined {
+		e.Caller = fmt.Sprintf("%s:%d", ent.Caller.File, ent.Caller.Line)
+	}
+	if len(base)+len(fields) > 0 {
+		enc := zapcore.NewMapObjectEncoder()
+		for _, f := range base {
+			f.AddTo(enc)
+		}
+		for _, f := range fields {
+			f.AddTo(enc)
+		}
+		e.Fields = enc.Fields
+	}
+	return e
+}
+
+//内部方法：日志记录转为文本，字段以key=value追加
+func (e *Entry) text() string {
+	msg := e.Message
+	if e.Logger != "" {
+		msg = "[" + e.Logger + "] " + msg
+	}
+	if len(e.Fields) == 0 {
+		return msg
+	}
+
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%v", k, e.Fields[k])
+	}
+	return msg + " " + strings.Join(parts, " ")
+}
@@ -0,0 +1,120 @@
+package logger
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+//内存输出目标，记录收到的日志
+type memSink struct {
+	mu      sync.Mutex
+	entries []*Entry
+	batches int
+	closed  bool
+}
+
+func (s *memSink) Write(entries []*Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entries...)
+	s.batches++
+	return nil
+}
+
+func (s *memSink) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	return nil
+}
+
+//内部方法：收到的日志内容
+func (s *memSink) messages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var msgs []string
+	for _, e := range s.entries {
+		msgs = append(msgs, e.Message)
+	}
+	return msgs
+}
+
+//内部方法：注册内存输出目标，返回按类型记录的目标
+func registerMemSinks(types ...string) map[string]*memSink {
+	sinks := make(map[string]*memSink)
+	for _, typ := range types {
+		s := &memSink{}
+		sinks[typ] = s
+		RegisterSink(typ, func(cnf *viper.Viper) (Sink, error) {
+			return s, nil
+		})
+	}
+	return sinks
+}
+
+func TestSinkFanOut(t *testing.T) {
+	sinks := registerMemSinks("mema", "memb")
+	setupLog(t, map[string]interface{}{
+		"level":   "error",
+		"outputs": []interface{}{"stderr"},
+		"sinks": []interface{}{
+			map[string]interface{}{"type": "mema", "level": "debug", "batchSize": 2},
+			map[string]interface{}{"type": "memb"},
+			map[string]interface{}{"type": "notregistered"},
+		},
+	})
+
+	//本地输出级别不影响远程输出目标
+	Debugf("debug-1")
+	Infof("info-1")
+	Warnf("warn-1")
+	//与类型同名的子模块日志不发送到该目标
+	Named("memb").Warnf("memb-1")
+	Named("mema").Named("conn").Warnf("mema-1")
+	Named("memc").Warnf("memc-1")
+	Close()
+
+	a, b := sinks["mema"], sinks["memb"]
+	if got := a.messages(); !equalStrings(got, []string{"debug-1", "info-1", "warn-1", "memb-1", "memc-1"}) {
+		t.Errorf("mema = %v", got)
+	}
+	if got := b.messages(); !equalStrings(got, []string{"warn-1", "mema-1", "memc-1"}) {
+		t.Errorf("memb = %v", got)
+	}
+	if a.batches < 3 || !a.closed || !b.closed {
+		t.Errorf("mema batches = %d, closed = %v %v", a.batches, a.closed, b.closed)
+	}
+
+	//关闭后不再发送
+	Warnf("warn-2")
+	if got := b.messages(); len(got) != 3 {
+		t.Errorf("memb after close = %v", got)
+	}
+}
+
+func TestSinkInvalidLevel(t *testing.T) {
+	registerMemSinks("memd")
+	cnf := viper.New()
+	_ = cnf.MergeConfigMap(map[string]interface{}{
+		"outputs": []interface{}{"stderr"},
+		"sinks":   []interface{}{map[string]interface{}{"type": "memd", "level": "verbose"}},
+	})
+	if err := setup(cnf); err == nil {
+		t.Error("expected error for invalid sink level")
+	}
+}
+
+//内部方法：字符串切片是否相同
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
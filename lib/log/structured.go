@@ -0,0 +1,230 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"sort"
+	"strings"
+)
+
+//上下文中的链路ID键名，gin.Context可通过 c.Set(logger.TraceIDKey, id) 设置
+const TraceIDKey = "traceId"
+
+type traceIDCtxKey struct{}
+
+//结构化日志对象，支持附加字段、子模块命名和上下文链路ID
+type Logger struct {
+	log    *zap.SugaredLogger
+	name   string
+	fields []interface{}
+}
+
+/*
+* 获取子模块日志对象，日志中带logger字段，便于按模块过滤
+*
+* param  name  模块名称，如sql、kafka、httpd
+* return 日志对象
+ */
+func Named(name string) *Logger {
+	return &Logger{log: log.Named(name), name: name}
+}
+
+/*
+* 获取附加字段的日志对象
+*
+* param  args  字段，键值对形式（"key", value, ...）或zap.Field
+* return 日志对象
+ */
+func With(args ...interface{}) *Logger {
+	return (&Logger{log: log}).With(args...)
+}
+
+/*
+* 获取附加上下文链路ID的日志对象
+*
+* param  ctx  上下文，链路ID由ContextWithTraceID或gin的c.Set(logger.TraceIDKey, id)设置
+* return 日志对象
+ */
+func Ctx(ctx context.Context) *Logger {
+	return (&Logger{log: log}).Ctx(ctx)
+}
+
+//子模块日志对象，名称以.连接
+func (l *Logger) Named(name string) *Logger {
+	full := name
+	if l.name != "" {
+		full = l.name + "." + name
+	}
+	return &Logger{log: l.log.Named(name), name: full, fields: l.fields}
+}
+
+//附加字段，键值对形式（"key", value, ...）或zap.Field
+func (l *Logger) With(args ...interface{}) *Logger {
+	if len(args) == 0 {
+		return l
+	}
+	fields := make([]interface{}, 0, len(l.fields)+len(args))
+	fields = append(fields, l.fields...)
+	fields = append(fields, args...)
+	return &Logger{log: l.log.With(args...), name: l.name, fields: fields}
+}
+
+//附加上下文中的链路ID
+func (l *Logger) Ctx(ctx context.Context) *Logger {
+	if id := TraceID(ctx); id != "" {
+		return l.With(TraceIDKey, id)
+	}
+	return l
+}
+
+//调试日志
+func (l *Logger) Debugf(format string, a ...interface{}) {
+	l.log.Debugf(format, a...)
+}
+
+//信息日志
+func (l *Logger) Infof(format string, a ...interface{}) {
+	l.log.Infof(format, a...)
+}
+
+//警告日志
+func (l *Logger) Warnf(format string, a ...interface{}) {
+	l.log.Warnf(format, a...)
+}
+
+//错误日志
+func (l *Logger) Errorf(format string, a ...interface{}) {
+	l.log.Errorf(format, a...)
+	alarm(l.prefix() + fmt.Sprintf(format, a...) + l.suffix(nil))
+}
+
+//调试日志（键值对字段）
+func (l *Logger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.log.Debugw(msg, keysAndValues...)
+}
+
+//信息日志（键值对字段）
+func (l *Logger) Infow(msg string, keysAndValues ...interface{}) {
+	l.log.Infow(msg, keysAndValues...)
+}
+
+//警告日志（键值对字段）
+func (l *Logger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.log.Warnw(msg, keysAndValues...)
+}
+
+//错误日志（键值对字段）
+func (l *Logger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.log.Errorw(msg, keysAndValues...)
+	alarm(l.prefix() + msg + l.suffix(keysAndValues))
+}
+
+//内部方法：报警内容中的模块名前缀
+func (l *Logger) prefix() string {
+	if l.name == "" {
+		return ""
+	}
+	return "[" + l.name + "] "
+}
+
+//内部方法：报警内容中的字段后缀
+func (l *Logger) suffix(keysAndValues []interface{}) string {
+	return suffixOf(append(append([]interface{}{}, l.fields...), keysAndValues...))
+}
+
+//调试日志（键值对字段）
+func Debugw(msg string, keysAndValues ...interface{}) {
+	log.Debugw(msg, keysAndValues...)
+}
+
+//信息日志（键值对字段）
+func Infow(msg string, keysAndValues ...interface{}) {
+	log.Infow(msg, keysAndValues...)
+}
+
+//警告日志（键值对字段）
+func Warnw(msg string, keysAndValues ...interface{}) {
+	log.Warnw(msg, keysAndValues...)
+}
+
+//错误日志（键值对字段）
+func Errorw(msg string, keysAndValues ...interface{}) {
+	log.Errorw(msg, keysAndValues...)
+	alarm(msg + suffixOf(keysAndValues))
+}
+
+//内部方法：字段后缀
+func suffixOf(keysAndValues []interface{}) string {
+	s := fieldsString(keysAndValues)
+	if s == "" {
+		return ""
+	}
+	return " " + s
+}
+
+/*
+* 设置上下文链路ID
+*
+* param  ctx  上下文
+* param  id   链路ID，传空值时自动生成
+* return 新上下文
+ */
+func ContextWithTraceID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		id = NewTraceID()
+	}
+	return context.WithValue(ctx, traceIDCtxKey{}, id)
+}
+
+//获取上下文中的链路ID，未设置时返回空值
+func TraceID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if id, ok := ctx.Value(traceIDCtxKey{}).(string); ok {
+		return id
+	}
+	if id, ok := ctx.Value(TraceIDKey).(string); ok {
+		return id
+	}
+	return ""
+}
+
+//生成链路ID
+func NewTraceID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+//内部方法：字段转为key=value文本
+func fieldsString(args []interface{}) string {
+	var parts []string
+	for i := 0; i < len(args); i++ {
+		switch f := args[i].(type) {
+		case zap.Field:
+			enc := zapcore.NewMapObjectEncoder()
+			f.AddTo(enc)
+			var keys []string
+			for k := range enc.Fields {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				parts = append(parts, fmt.Sprintf("%s=%v", k, enc.Fields[k]))
+			}
+		default:
+			if i+1 < len(args) {
+				parts = append(parts, fmt.Sprintf("%v=%v", args[i], args[i+1]))
+				i++
+			} else {
+				parts = append(parts, fmt.Sprintf("%v", args[i]))
+			}
+		}
+	}
+	return strings.Join(parts, " ")
+}
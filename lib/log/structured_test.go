@@ -0,0 +1,64 @@
+package logger
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestStructuredFields(t *testing.T) {
+	sinks := registerMemSinks("memstruct")
+	setupLog(t, map[string]interface{}{
+		"outputs": []interface{}{"stderr"},
+		"level":   "error",
+		"sinks":   []interface{}{map[string]interface{}{"type": "memstruct", "level": "info"}},
+	})
+
+	ctx := ContextWithTraceID(context.Background(), "t-1")
+	Named("sql").With("db", "main").Ctx(ctx).Infow("query", "rows", 3)
+	With(zap.Int("shard", 2)).Named("conn").Warnf("slow %dms", 120)
+	Ctx(context.Background()).Infow("no trace")
+	Close()
+
+	entries := sinks["memstruct"].entries
+	if len(entries) != 3 {
+		t.Fatalf("entries = %d", len(entries))
+	}
+	e := entries[0]
+	if e.Logger != "sql" || e.Message != "query" || e.Fields["db"] != "main" || e.Fields[TraceIDKey] != "t-1" || e.Fields["rows"] != int64(3) {
+		t.Errorf("entry = %+v", e)
+	}
+	if s := e.text(); s != "[sql] query db=main rows=3 traceId=t-1" {
+		t.Errorf("text = %s", s)
+	}
+	e = entries[1]
+	if e.Logger != "conn" || e.Message != "slow 120ms" || e.Fields["shard"] != int64(2) {
+		t.Errorf("entry = %+v", e)
+	}
+	if e = entries[2]; len(e.Fields) != 0 {
+		t.Errorf("fields without trace = %v", e.Fields)
+	}
+}
+
+func TestTraceID(t *testing.T) {
+	if id := TraceID(context.Background()); id != "" {
+		t.Errorf("empty ctx trace = %s", id)
+	}
+	if id := TraceID(ContextWithTraceID(context.Background(), "")); len(id) != 32 {
+		t.Errorf("generated trace = %s", id)
+	}
+	//gin.Context等以TraceIDKey保存的值
+	ctx := context.WithValue(context.Background(), TraceIDKey, "t-2")
+	if id := TraceID(ctx); id != "t-2" {
+		t.Errorf("key trace = %s", id)
+	}
+
+	l := Named("a").Named("b").With("k", 1)
+	if l.name != "a.b" || l.prefix() != "[a.b] " || l.suffix([]interface{}{"x", "y"}) != " k=1 x=y" {
+		t.Errorf("name = %s, suffix = %s", l.name, l.suffix([]interface{}{"x", "y"}))
+	}
+	if s := fieldsString([]interface{}{zap.String("z", "1"), "odd"}); s != "z=1 odd" {
+		t.Errorf("fieldsString = %s", s)
+	}
+}
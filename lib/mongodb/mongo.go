@@ -5,26 +5,33 @@ import (
 	"errors"
 	"fmt"
 	"github.com/maclon-lee/golanglib/lib/config"
+	_ "github.com/maclon-lee/golanglib/lib/mongodb/schema"
 	logger "github.com/maclon-lee/golanglib/lib/log"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"github.com/spf13/viper"
 	"strings"
+	"sync"
 )
 
+//mongodb模块日志
+var log = logger.Named("mongodb")
+
 type MgoContext struct {
 	mdb *mongo.Client
 	ctx context.Context
 	db  *mongo.Database
 
 	dbName  string
-	Name    string `mapstructure:"name"`
-	Address string `mapstructure:"address"`
+	Name    string `mapstructure:"name" validate:"required"`
+	Address string `mapstructure:"address" validate:"required,startswith=mongodb"`
 }
 
 //mongo对象集合
 var mtxs map[string]*MgoContext
+var mtxLock sync.RWMutex
 var isInit = false
 
 //构造MongoDB引擎
@@ -60,29 +67,58 @@ func init() {
 	}
 	isInit = true
 
-	if config.IsSet("mongo") {
-		var cfgList []MgoContext
-		mConf := config.GetSubConfig("mongo")
+	if err := loadContexts(config.GetSubConfig("mongo")); err != nil {
+		panic(err)
+	}
+
+	//配置变更时重建连接
+	config.OnChange("mongo", func(_, nv *viper.Viper) {
+		if err := loadContexts(nv); err != nil {
+			log.Errorf("%s", err)
+		}
+	})
+}
+
+//内部方法：按配置构建mongo连接，连接地址未变化的继续复用
+func loadContexts(mConf *viper.Viper) error {
+	var cfgList []MgoContext
+	if mConf != nil {
 		err := mConf.UnmarshalKey("db", &cfgList)
 		if err != nil {
-			panic(fmt.Errorf("mongo配置错误:%s", err))
+			return fmt.Errorf("mongo配置错误:%s", err)
 		}
+	}
 
-		mtxs = make(map[string]*MgoContext, 0)
-		for i, mtx := range cfgList {
-			database, ctx, client, err := newEngine(mtx.Address)
-			if err != nil {
-				logger.Errorf("Error creating mongo client: %s", err)
-				continue
-			}
+	mtxLock.Lock()
+	olds := mtxs
+	news := make(map[string]*MgoContext, 0)
+	for i, mtx := range cfgList {
+		if old, ok := olds[mtx.Name]; ok && old.Address == mtx.Address {
+			news[mtx.Name] = old
+			continue
+		}
+
+		database, ctx, client, err := newEngine(mtx.Address)
+		if err != nil {
+			log.Errorf("Error creating mongo client: %s", err)
+			continue
+		}
 
-			c := &cfgList[i]
-			c.mdb = client
-			c.ctx = ctx
-			c.dbName = database
-			mtxs[mtx.Name] = c
+		c := &cfgList[i]
+		c.mdb = client
+		c.ctx = ctx
+		c.dbName = database
+		news[mtx.Name] = c
+	}
+	mtxs = news
+	mtxLock.Unlock()
+
+	for name, old := range olds {
+		if c, ok := news[name]; !ok || c != old {
+			_ = old.mdb.Disconnect(old.ctx)
 		}
 	}
+	return nil
 }
 
 /*
@@ -93,7 +129,11 @@ func init() {
 * return mongo操作对象
  */
 func GetContext(mKey string, dbName string) (*MgoContext, error) {
-	if mtx, ok := mtxs[mKey]; ok {
+	mtxLock.RLock()
+	mtx, ok := mtxs[mKey]
+	mtxLock.RUnlock()
+
+	if ok {
 		if dbName == "" {
 			dbName = mtx.dbName
 		}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"github.com/Shopify/sarama"
 	"github.com/maclon-lee/golanglib/lib/config"
-	logger "github.com/maclon-lee/golanglib/lib/log"
 	"os"
 	"os/signal"
 	"time"
@@ -107,7 +106,7 @@ func (kafkaConsumerGroupHandler) Cleanup(_ sarama.ConsumerGroupSession) error {
 func (h kafkaConsumerGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	for msg := range claim.Messages() {
 		left := len(claim.Messages())
-		//logger.Debugf("message left %d",left)
+		//log.Debugf("message left %d",left)
 		if c, ok := groupConsumers[h.GroupID+msg.Topic]; ok {
 			c.attach(msg, sess, left)
 		}
@@ -185,7 +184,7 @@ func ReceiveMessage(topic, groupId string, batchSize int32, batchInterval time.D
 		// Track errors
 		go func(gr sarama.ConsumerGroup) {
 			for err := range gr.Errors() {
-				logger.Warnf("ConsumerGroup ERROR:%s", err)
+				log.Warnf("ConsumerGroup ERROR:%s", err)
 			}
 		}(grouper)
 
@@ -0,0 +1,54 @@
+package kafka
+
+import (
+	"errors"
+	"github.com/maclon-lee/golanglib/lib/config"
+	"github.com/maclon-lee/golanglib/lib/json"
+	logger "github.com/maclon-lee/golanglib/lib/log"
+	"github.com/spf13/viper"
+)
+
+//日志输出目标：每条日志以JSON发送到Kafka，在log.sinks中以type="kafka"引用
+type logSink struct {
+	topic string
+}
+
+func init() {
+	logger.RegisterSink("kafka", newLogSink)
+}
+
+/*
+* 内部方法：构建Kafka日志输出目标
+* 配置项：topic主题，默认为kafka节点的topic
+ */
+func newLogSink(cnf *viper.Viper) (logger.Sink, error) {
+	topic := cnf.GetString("topic")
+	if topic == "" {
+		if kcnf := config.GetSubConfig("kafka"); kcnf != nil {
+			topic = kcnf.GetString("topic")
+		}
+	}
+	if topic == "" {
+		return nil, errors.New("kafka topic not config")
+	}
+	return &logSink{topic: topic}, nil
+}
+
+//发送日志
+func (s *logSink) Write(entries []*logger.Entry) error {
+	for _, e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if err = SendMessage(s.topic, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//无需关闭，生产者在中断时统一关闭
+func (s *logSink) Close() error {
+	return nil
+}
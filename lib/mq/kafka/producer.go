@@ -4,13 +4,18 @@ import (
 	"errors"
 	"github.com/Shopify/sarama"
 	"github.com/maclon-lee/golanglib/lib/config"
+	_ "github.com/maclon-lee/golanglib/lib/mq/kafka/schema"
 	logger "github.com/maclon-lee/golanglib/lib/log"
 	"os"
 	"os/signal"
 )
 
+//kafka模块日志
+var log = logger.Named("kafka")
+
 var producer sarama.AsyncProducer
 
+//kafka配置结构
 /*
 * 发送生产消息
 *
@@ -37,6 +42,12 @@ func SendMessage(topic string, text []byte) error {
 				return err
 			}
 
+			go func(p sarama.AsyncProducer) {
+				for err := range p.Errors() {
+					log.Warnf(err.Error())
+				}
+			}(producer)
+
 			signals := make(chan os.Signal, 1)
 			signal.Notify(signals, os.Interrupt)
 
@@ -55,12 +66,6 @@ func SendMessage(topic string, text []byte) error {
 		}
 	}
 
-	go func() {
-		for err := range producer.Errors() {
-			logger.Warnf(err.Error())
-		}
-	}()
-
 	producer.Input() <- &sarama.ProducerMessage{Topic: topic, Key: nil, Value: sarama.ByteEncoder(text)}
 
 	return nil
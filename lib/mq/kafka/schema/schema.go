@@ -0,0 +1,15 @@
+//kafka配置节点结构，仅注册校验规则，不建立连接，可单独引入用于配置校验
+package schema
+
+import "github.com/maclon-lee/golanglib/lib/config"
+
+//kafka配置结构
+type Conf struct {
+	Address []string `mapstructure:"address" validate:"required,dive,hostname_port"`
+	Topic   string   `mapstructure:"topic"`
+	Group   string   `mapstructure:"group"`
+}
+
+func init() {
+	config.RegisterSection("kafka", Conf{}, false)
+}
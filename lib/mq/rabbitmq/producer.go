@@ -3,6 +3,7 @@ package rabbitmq
 import (
 	"errors"
 	"github.com/maclon-lee/golanglib/lib/config"
+	_ "github.com/maclon-lee/golanglib/lib/mq/rabbitmq/schema"
 	"time"
 )
 
@@ -16,6 +17,7 @@ type Producer struct {
 	client *client
 }
 
+//rabbitmq配置结构
 const producerHeartbeat = time.Minute * 20
 
 func NewProducer(connName string) (*Producer, error) {
@@ -0,0 +1,14 @@
+//rabbitmq配置节点结构，仅注册校验规则，不建立连接，可单独引入用于配置校验
+package schema
+
+import "github.com/maclon-lee/golanglib/lib/config"
+
+//rabbitmq配置结构
+type Conf struct {
+	Amqp  string `mapstructure:"amqp" validate:"required,startswith=amqp"`
+	VHost string `mapstructure:"vHost"`
+}
+
+func init() {
+	config.RegisterSection("rabbitmq", Conf{}, false)
+}
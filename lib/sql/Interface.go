@@ -1,5 +1,24 @@
 package sql
 
+import "time"
+
+//软删除：实现此接口的实体须有xorm标签为deleted的删除时间字段（time.Time或时间戳整数）
+//Delete改为设置删除时间，Get、Update和查询构造器过滤已删除的记录，Unscoped()时包含已删除的记录
 type SoftDelete interface {
 	Delete()
 }
+
+//软删除状态：与SoftDelete相同，实现此接口的实体按软删除处理，可嵌入SoftDeleteModel
+type SoftDeleteState interface {
+	IsDeleted() bool
+}
+
+//软删除字段，以 sql.SoftDeleteModel `xorm:"extends"` 嵌入实体
+type SoftDeleteModel struct {
+	DeletedAt time.Time `xorm:"deleted index"`
+}
+
+//是否已删除
+func (m SoftDeleteModel) IsDeleted() bool {
+	return !m.DeletedAt.IsZero()
+}
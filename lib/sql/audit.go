@@ -0,0 +1,75 @@
+package sql
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type operatorKey struct{}
+
+/*
+* 设置操作人，插入和更新时填充实体的CreatedBy、UpdatedBy字段
+*
+* param  ctx       上下文
+* param  operator  操作人，类型须与实体字段一致，如用户名string或用户ID int64
+*
+* return 带操作人的上下文
+ */
+func WithOperator(ctx context.Context, operator interface{}) context.Context {
+	return context.WithValue(ctx, operatorKey{}, operator)
+}
+
+//返回上下文中的操作人，未设置时为nil
+func Operator(ctx context.Context) interface{} {
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Value(operatorKey{})
+}
+
+//内部方法：填充审计字段，插入时CreatedAt、UpdatedAt为零值时取当前时间，CreatedBy、UpdatedBy为零值时取操作人；
+//更新时UpdatedAt取当前时间，UpdatedBy取操作人。字段可选，实体须为struct指针
+func fillAudit(ctx context.Context, entity interface{}, insert bool) {
+	v := reflect.ValueOf(entity)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	v = v.Elem()
+
+	now := reflect.ValueOf(time.Now())
+	var operator reflect.Value
+	if op := Operator(ctx); op != nil {
+		operator = reflect.ValueOf(op)
+	}
+	set := func(name string, value reflect.Value, onlyZero bool) {
+		if !value.IsValid() {
+			return
+		}
+		f := v.FieldByName(name)
+		if !f.IsValid() || !f.CanSet() || !value.Type().AssignableTo(f.Type()) {
+			return
+		}
+		if onlyZero && !f.IsZero() {
+			return
+		}
+		f.Set(value)
+	}
+
+	if insert {
+		set("CreatedAt", now, true)
+		set("UpdatedAt", now, true)
+		set("CreatedBy", operator, true)
+		set("UpdatedBy", operator, true)
+		return
+	}
+	set("UpdatedAt", now, false)
+	set("UpdatedBy", operator, false)
+}
+
+//内部方法：是否为插入时填充、更新时不修改的审计字段
+func isCreatedField(fieldName string) bool {
+	name := fieldName[strings.LastIndex(fieldName, ".")+1:]
+	return name == "CreatedAt" || name == "CreatedBy"
+}
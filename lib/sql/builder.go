@@ -6,7 +6,7 @@ import (
 	"strings"
 )
 
-//获取select字段名列表（source为空值时，取entity中的键名作为字段名）
+//获取select字段名列表（source为空值时，取entity中的键名作为字段名，不读取xorm标签；按标签映射字段名请使用Select查询构造器）
 func BuildSelect(source []string, entity interface{}) string {
 	if len(source) == 0 {
 		if entity == nil {
@@ -45,8 +45,10 @@ func (w Where) Build() (string, []interface{}) {
 func (w *Where) AppendIf(cond bool, whereStr string, args ...interface{}) *Where {
 	if cond {
 		if w.Sql.Len() > 0 {
-			if !strings.HasPrefix(strings.ToUpper(strings.Trim(whereStr, " ")), "AND") {
+			if !hasAndPrefix(whereStr) {
 				w.Sql.WriteString(" AND ")
+			} else {
+				w.Sql.WriteString(" ")
 			}
 		} else {
 			w.Sql.WriteString(" WHERE ")
@@ -60,23 +62,7 @@ func (w *Where) AppendIf(cond bool, whereStr string, args ...interface{}) *Where
 //append in查询 数组
 func (w *Where) InIf(cond bool, col string, args ...interface{}) *Where {
 	if cond {
-		var _args []interface{}
-		if len(args) == 1 {
-			v := reflect.ValueOf(args[0])
-			if v.Kind() == reflect.Ptr {
-				v = v.Elem()
-			}
-			if v.Kind() == reflect.Slice {
-				_args = make([]interface{}, v.Len())
-				for i := 0; i < v.Len(); i++ {
-					_args[i] = v.Index(i).Interface()
-				}
-			} else {
-				_args = args
-			}
-		} else {
-			_args = args
-		}
+		_args := flattenArgs(args)
 
 		if w.Sql.Len() > 0 {
 			w.Sql.WriteString(" AND ")
@@ -112,3 +98,30 @@ func (w *Where) ExprIf(cond bool, col string, symbol string, args ...interface{}
 	}
 	return w
 }
+
+//内部方法：SQL短句是否以AND关键字开头（AND后须为空白或括号，Android=?等字段名不算）
+func hasAndPrefix(whereStr string) bool {
+	s := strings.TrimSpace(whereStr)
+	if len(s) <= 3 || !strings.EqualFold(s[:3], "AND") {
+		return false
+	}
+	return strings.ContainsRune(" \t\r\n(", rune(s[3]))
+}
+
+//内部方法：单个切片参数展开为参数列表
+func flattenArgs(args []interface{}) []interface{} {
+	if len(args) == 1 {
+		v := reflect.ValueOf(args[0])
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		if v.Kind() == reflect.Slice {
+			_args := make([]interface{}, v.Len())
+			for i := 0; i < v.Len(); i++ {
+				_args[i] = v.Index(i).Interface()
+			}
+			return _args
+		}
+	}
+	return args
+}
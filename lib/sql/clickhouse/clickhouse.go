@@ -0,0 +1,287 @@
+//clickhouse驱动，以 import _ "github.com/maclon-lee/golanglib/lib/sql/clickhouse" 引入后dbs.db的driver可使用clickhouse
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	_ "github.com/ClickHouse/clickhouse-go"
+	"github.com/maclon-lee/golanglib/lib/sql"
+	"net/url"
+	"reflect"
+	"strings"
+	"xorm.io/xorm"
+	"xorm.io/xorm/core"
+	"xorm.io/xorm/dialects"
+	"xorm.io/xorm/schemas"
+)
+
+//clickhouse：连接字符串如 tcp://127.0.0.1:9000?database=default&username=default&password=
+//插入须在批处理模式下执行，ImportData/Inserts按batchNum分批提交；不支持UPDATE/DELETE和事务
+func Open(dataSourceName string) (*xorm.Engine, error) {
+	return xorm.NewEngine("clickhouse", dataSourceName)
+}
+
+//clickhouse驱动，实现sql.BatchInserter
+type Driver struct{}
+
+func (Driver) Open(connectString string) (*xorm.Engine, error) {
+	return Open(connectString)
+}
+
+//批处理模式插入：Begin、Prepare后逐行Exec，Commit时作为一个数据块写入
+func (Driver) BatchInsert(ctx context.Context, db *xorm.Engine, tableName string, isIdentityInsert bool, beans []interface{}) (int64, error) {
+	table, err := db.TableInfo(beans[0])
+	if err != nil {
+		return 0, err
+	}
+	var cols []*schemas.Column
+	var names []string
+	for _, col := range table.Columns() {
+		if col.IsAutoIncrement && !isIdentityInsert {
+			continue
+		}
+		cols = append(cols, col)
+		names = append(names, db.Quote(col.Name))
+	}
+
+	tx, err := db.DB().BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", db.Quote(tableName), strings.Join(names, ","), strings.TrimSuffix(strings.Repeat("?,", len(cols)), ",")))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	args := make([]interface{}, len(cols))
+	for _, bean := range beans {
+		v := reflect.ValueOf(bean)
+		for v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		for i, col := range cols {
+			field, err := col.ValueOfV(&v)
+			if err != nil {
+				return 0, err
+			}
+			args[i] = field.Interface()
+		}
+		if _, err = stmt.ExecContext(ctx, args...); err != nil {
+			return 0, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int64(len(beans)), nil
+}
+
+//xorm的clickhouse连接字符串解析
+type clickhouseURIParser struct{}
+
+func (clickhouseURIParser) Parse(driverName, dataSourceName string) (*dialects.URI, error) {
+	u, err := url.Parse(dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	dbName := u.Query().Get("database")
+	if dbName == "" {
+		dbName = "default"
+	}
+	return &dialects.URI{
+		DBType: "clickhouse",
+		Proto:  u.Scheme,
+		Host:   u.Hostname(),
+		Port:   u.Port(),
+		DBName: dbName,
+		User:   u.Query().Get("username"),
+		Passwd: u.Query().Get("password"),
+	}, nil
+}
+
+//xorm的clickhouse方言，引号和语句沿用mysql，表结构取自system库
+type clickhouseDialect struct {
+	dialects.Dialect
+}
+
+//注册xorm方言和clickhouse驱动，重新加载使用clickhouse而未能连接的数据库上下文
+func init() {
+	dialects.RegisterDriver("clickhouse", clickhouseURIParser{})
+	dialects.RegisterDialect("clickhouse", func() dialects.Dialect {
+		return &clickhouseDialect{Dialect: dialects.QueryDialect(schemas.MYSQL)}
+	})
+	sql.RegisterDriver("clickhouse", Driver{})
+}
+
+func (db *clickhouseDialect) SQLType(c *schemas.Column) string {
+	var t string
+	switch strings.ToUpper(c.SQLType.Name) {
+	case schemas.Bool, schemas.Boolean:
+		t = "UInt8"
+	case schemas.TinyInt:
+		t = "Int8"
+	case schemas.SmallInt:
+		t = "Int16"
+	case schemas.MediumInt, schemas.Int, schemas.Integer, schemas.Serial:
+		t = "Int32"
+	case schemas.BigInt, schemas.BigSerial:
+		t = "Int64"
+	case schemas.Float, schemas.Real:
+		t = "Float32"
+	case schemas.Double:
+		t = "Float64"
+	case schemas.Decimal, schemas.Numeric, schemas.Money:
+		if c.Length > 0 {
+			t = fmt.Sprintf("Decimal(%d,%d)", c.Length, c.Length2)
+		} else {
+			t = "Decimal(18,4)"
+		}
+	case schemas.Date:
+		t = "Date"
+	case schemas.DateTime, schemas.TimeStamp, schemas.TimeStampz:
+		t = "DateTime"
+	case schemas.Uuid:
+		t = "UUID"
+	default:
+		t = "String"
+	}
+	if c.Nullable && !c.IsPrimaryKey {
+		t = "Nullable(" + t + ")"
+	}
+	return t
+}
+
+func (db *clickhouseDialect) AutoIncrStr() string {
+	return ""
+}
+
+func (db *clickhouseDialect) ForUpdateSQL(query string) string {
+	return query
+}
+
+func (db *clickhouseDialect) IsTableExist(queryer core.Queryer, ctx context.Context, tableName string) (bool, error) {
+	rows, err := queryer.QueryContext(ctx, "SELECT name FROM system.tables WHERE database=? AND name=?", db.URI().DBName, tableName)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	return rows.Next(), rows.Err()
+}
+
+func (db *clickhouseDialect) GetTables(queryer core.Queryer, ctx context.Context) ([]*schemas.Table, error) {
+	rows, err := queryer.QueryContext(ctx, "SELECT name, engine FROM system.tables WHERE database=? AND NOT is_temporary", db.URI().DBName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []*schemas.Table
+	for rows.Next() {
+		table := schemas.NewEmptyTable()
+		if err = rows.Scan(&table.Name, &table.StoreEngine); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+func (db *clickhouseDialect) GetColumns(queryer core.Queryer, ctx context.Context, tableName string) ([]string, map[string]*schemas.Column, error) {
+	rows, err := queryer.QueryContext(ctx, "SELECT name, type, default_expression, is_in_primary_key, comment FROM system.columns WHERE database=? AND table=? ORDER BY position", db.URI().DBName, tableName)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	cols := make(map[string]*schemas.Column)
+	var seq []string
+	for rows.Next() {
+		var name, colType, def, comment string
+		var pk uint8
+		if err = rows.Scan(&name, &colType, &def, &pk, &comment); err != nil {
+			return nil, nil, err
+		}
+		col := &schemas.Column{Name: name, Indexes: make(map[string]int), Comment: comment, IsPrimaryKey: pk == 1, Default: def, DefaultIsEmpty: def == ""}
+		if strings.HasPrefix(colType, "Nullable(") {
+			col.Nullable = true
+			colType = strings.TrimSuffix(strings.TrimPrefix(colType, "Nullable("), ")")
+		}
+		col.SQLType = clickhouseSQLType(colType)
+		cols[name] = col
+		seq = append(seq, name)
+	}
+	return seq, cols, rows.Err()
+}
+
+//clickhouse的数据跳过索引与普通索引不同，不做映射
+func (db *clickhouseDialect) GetIndexes(queryer core.Queryer, ctx context.Context, tableName string) (map[string]*schemas.Index, error) {
+	return map[string]*schemas.Index{}, nil
+}
+
+func (db *clickhouseDialect) CreateIndexSQL(tableName string, index *schemas.Index) string {
+	return ""
+}
+
+//建表使用MergeTree引擎，按主键排序
+func (db *clickhouseDialect) CreateTableSQL(table *schemas.Table, tableName string) ([]string, bool) {
+	if tableName == "" {
+		tableName = table.Name
+	}
+	quoter := db.Quoter()
+
+	var cols []string
+	for _, name := range table.ColumnsSeq() {
+		col := table.GetColumn(name)
+		s := quoter.Quote(col.Name) + " " + db.SQLType(col)
+		if col.Default != "" {
+			s += " DEFAULT " + col.Default
+		}
+		if col.Comment != "" {
+			s += " COMMENT '" + strings.Replace(col.Comment, "'", "''", -1) + "'"
+		}
+		cols = append(cols, s)
+	}
+
+	engine := table.StoreEngine
+	if engine == "" {
+		engine = "MergeTree()"
+	}
+	orderBy := "tuple()"
+	if len(table.PrimaryKeys) > 0 {
+		orderBy = "(" + quoter.Join(table.PrimaryKeys, ",") + ")"
+	}
+	return []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s) ENGINE = %s ORDER BY %s", quoter.Quote(tableName), strings.Join(cols, ", "), engine, orderBy)}, true
+}
+
+//内部方法：clickhouse类型转换为xorm类型
+func clickhouseSQLType(t string) schemas.SQLType {
+	if strings.HasPrefix(t, "LowCardinality(") {
+		t = strings.TrimSuffix(strings.TrimPrefix(t, "LowCardinality("), ")")
+	}
+	switch {
+	case t == "UInt8" || t == "Int8":
+		return schemas.SQLType{Name: schemas.TinyInt}
+	case t == "Int16" || t == "UInt16":
+		return schemas.SQLType{Name: schemas.SmallInt}
+	case t == "Int32" || t == "UInt32":
+		return schemas.SQLType{Name: schemas.Int}
+	case strings.HasPrefix(t, "Int") || strings.HasPrefix(t, "UInt"):
+		return schemas.SQLType{Name: schemas.BigInt}
+	case t == "Float32":
+		return schemas.SQLType{Name: schemas.Float}
+	case t == "Float64":
+		return schemas.SQLType{Name: schemas.Double}
+	case strings.HasPrefix(t, "Decimal"):
+		return schemas.SQLType{Name: schemas.Decimal}
+	case t == "Date" || t == "Date32":
+		return schemas.SQLType{Name: schemas.Date}
+	case strings.HasPrefix(t, "DateTime"):
+		return schemas.SQLType{Name: schemas.DateTime}
+	case t == "UUID":
+		return schemas.SQLType{Name: schemas.Uuid}
+	}
+	return schemas.SQLType{Name: schemas.Text}
+}
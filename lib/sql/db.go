@@ -1,38 +1,45 @@
 package sql
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/spf13/viper"
 	"github.com/maclon-lee/golanglib/lib/config"
+	"github.com/maclon-lee/golanglib/lib/sql/schema"
 	logger "github.com/maclon-lee/golanglib/lib/log"
-	"github.com/maclon-lee/golanglib/lib/utility"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 	"xorm.io/xorm"
 )
 
+//sql模块日志
+var log = logger.Named("sql")
+
 //数据库上下文
 type DbContext struct {
-	db            *xorm.Engine
-	TableConfs    []SplitTableConf `mapstructure:"splitTables"`
-	Name          string           `mapstructure:"name"`
-	Driver        string           `mapstructure:"driver"`
-	ConnectString string           `mapstructure:"str"`
-}
-type SplitTableConf struct {
-	TableName string   `mapstructure:"tableName"`
-	Policies  []Policy `mapstructure:"policy"`
-}
-type Policy struct {
-	Column string `mapstructure:"column"`
-	Count  int    `mapstructure:"count"`
+	db        *xorm.Engine
+	timeout   time.Duration
+	replicas  *replicaSet
+	primary   bool
+	unscoped  bool
+	hook      *queryHook
+	schema.Db `mapstructure:",squash"` //连接配置（dbs.db），字段定义见lib/sql/schema
 }
 
+//分表配置
+type SplitTableConf = schema.SplitTable
+
+//分表规则
+type Policy = schema.Policy
+
 //批量SQL请求参数列表
 type BatchSqlReq struct {
-	Mode int // 0为Exec(Sql和Args), 1为InsertOne(Bean), 2为Update（Bean和Condi）
+	Mode int // 0为Exec(Sql和Args), 1为InsertOne(Bean), 2为Update（Bean和Condi，带version字段时版本冲突返回ErrStaleObject并回滚）
 	Sql  string
 	Args []interface{}
 	Bean interface{}
@@ -41,7 +48,9 @@ type BatchSqlReq struct {
 
 var dtxs map[string]*DbContext
 var _default *DbContext
+var dtxLock sync.RWMutex
 var isInit = false
+var loadOnce sync.Once
 var dbConf *viper.Viper
 
 //构造数据库引擎
@@ -49,76 +58,143 @@ func newEngine(driver string, connectString string) (*xorm.Engine, error) {
 	var db *xorm.Engine
 	var err error
 
-	//支持的数据库引擎
-	switch driver {
-	case "mysql":
-		db, err = xorm.NewEngine("mysql", connectString)
-	case "mssql":
-		db, err = NewMssqlDriver(connectString)
-	case "postgres":
-		db, err = NewPostgresDriver(connectString)
-	default:
-		err = errors.New("不支持的数据库驱动:" + driver)
+	//支持的数据库引擎，可通过RegisterDriver扩展
+	d, err := lookupDriver(driver)
+	if err != nil {
+		return nil, err
 	}
-
+	db, err = d.Open(connectString)
 	if err != nil {
 		return nil, err
 	}
 
+	setPool(db, driver)
+	if config.Env == "dev" {
+		db.ShowSQL(true)
+	}
+
+	return db, nil
+}
+
+//内部方法：设置连接池参数
+func setPool(db *xorm.Engine, driver string) {
+	//sqlite内存数据库固定使用一个连接
+	if driver == "sqlite" && (strings.Contains(db.DataSourceName(), ":memory:") || strings.Contains(db.DataSourceName(), "mode=memory")) {
+		return
+	}
 	if dbConf != nil && dbConf.IsSet(driver) {
 		setting := dbConf.Sub(driver)
 		db.SetConnMaxLifetime(setting.GetDuration("maxLifetime") * time.Second)
 		db.SetMaxIdleConns(setting.GetInt("maxIdle"))
 		db.SetMaxOpenConns(setting.GetInt("maxOpen"))
 	}
-	if config.Env == "dev" {
-		db.ShowSQL(true)
-	}
+}
 
-	return db, nil
+//内部方法：默认语句超时，优先取dbs.db的timeout，其次取dbs.<driver>.timeout
+func defaultTimeout(driver string, timeout int) time.Duration {
+	if timeout <= 0 && dbConf != nil && dbConf.IsSet(driver+".timeout") {
+		timeout = dbConf.GetInt(driver + ".timeout")
+	}
+	return time.Duration(timeout) * time.Millisecond
 }
 
-//初始化数据库上下文
+//初始化数据库上下文，首次使用时才按配置构建连接，仅引入本包（如配置校验）时不连接数据库
 func init() {
 	if isInit {
 		return
 	}
 	isInit = true
 
-	if !config.IsSet("dbs") {
-		return
-	}
+	//配置变更时重建数据库上下文
+	config.OnChange("dbs", func(_, nv *viper.Viper) {
+		loadOnce.Do(func() {})
+		if err := loadContexts(nv); err != nil {
+			log.Errorf("%s", err)
+		}
+	})
+}
 
+//内部方法：首次使用时按当前配置构建数据库上下文，配置错误时panic
+func ensureContexts() {
+	loadOnce.Do(func() {
+		if err := loadContexts(config.GetSubConfig("dbs")); err != nil {
+			panic(err)
+		}
+	})
+}
+
+//内部方法：按配置构建数据库上下文，配置未变化的连接继续复用
+func loadContexts(conf *viper.Viper) error {
 	var cfgList []DbContext
-	dbConf = config.GetSubConfig("dbs")
-	err := dbConf.UnmarshalKey("db", &cfgList)
-	if err != nil {
-		panic(fmt.Errorf("数据库配置错误:%s", err))
+	if conf != nil {
+		err := conf.UnmarshalKey("db", &cfgList)
+		if err != nil {
+			return fmt.Errorf("数据库配置错误:%s", err)
+		}
 	}
 
-	dtxs = make(map[string]*DbContext, 0)
+	dtxLock.Lock()
+	dbConf = conf
+	olds := dtxs
+	news := make(map[string]*DbContext, 0)
+	var def *DbContext
 
 	for i, ctx := range cfgList {
-		db, err := newEngine(ctx.Driver, ctx.ConnectString)
-		if err != nil {
-			logger.Errorf("数据库连接:%s, 错误:%s", ctx.Name, err)
-			continue
+		c := &cfgList[i]
+		c.timeout = defaultTimeout(c.Driver, c.Timeout)
+		if old, ok := olds[ctx.Name]; ok && old.sameConf(c) {
+			old.hook.setSlow(defaultSlowQuery(c.Driver, c.SlowQuery))
+			c = old
+			setPool(c.db, c.Driver)
+		} else {
+			db, err := newEngine(ctx.Driver, ctx.ConnectString)
+			if err != nil {
+				log.Errorf("数据库连接:%s, 错误:%s", ctx.Name, err)
+				continue
+			}
+			c.db = db
+			c.hook = newQueryHook(c)
+			c.hook.attach(db)
+			if len(c.Replicas) > 0 {
+				c.replicas = newReplicaSet(c)
+			}
 		}
 
-		c := &cfgList[i]
-		c.db = db
-		dtxs[ctx.Name] = c
-		if _default == nil {
-			_default = c
+		news[ctx.Name] = c
+		if def == nil {
+			def = c
 		}
 	}
+
+	dtxs = news
+	_default = def
+	dtxLock.Unlock()
+
+	//关闭已移除或已变更的连接（已执行的查询会等待完成）
+	for name, old := range olds {
+		if c, ok := news[name]; !ok || c != old {
+			old.Close()
+		}
+	}
+	return nil
+}
+
+//内部方法：连接配置是否一致
+func (dtx *DbContext) sameConf(c *DbContext) bool {
+	return dtx.Driver == c.Driver && dtx.ConnectString == c.ConnectString && dtx.timeout == c.timeout && reflect.DeepEqual(dtx.TableConfs, c.TableConfs) &&
+		reflect.DeepEqual(dtx.Replicas, c.Replicas) && dtx.Balance == c.Balance && dtx.MaxLag == c.MaxLag && dtx.HealthInterval == c.HealthInterval
 }
 
 /*
 * 获取DB操作对象
 * 参数dbKey：对应为config.toml中dbs.db的name值
+* 配置热更新后连接可能被替换，不要长期持有返回的对象
 */
 func GetContext(dbKey string) (*DbContext, error) {
+	ensureContexts()
+	dtxLock.RLock()
+	defer dtxLock.RUnlock()
+
 	if db, ok := dtxs[dbKey]; ok {
 		return db, nil
 	}
@@ -130,6 +206,10 @@ func GetContext(dbKey string) (*DbContext, error) {
 * 对应为config.toml中第一个有效的dbs.db配置
 */
 func GetDefaultContext() *DbContext {
+	ensureContexts()
+	dtxLock.RLock()
+	defer dtxLock.RUnlock()
+
 	return _default
 }
 
@@ -141,17 +221,54 @@ func GetDefaultContext() *DbContext {
 * return DB操作对象
  */
 func NewContext(driver string, connectString string) (*DbContext, error) {
+	ensureContexts()
 	db, err := newEngine(driver, connectString)
 	if err != nil {
 		return nil, err
 	}
-	return &DbContext{
+	dtxLock.RLock()
+	timeout := defaultTimeout(driver, 0)
+	dtxLock.RUnlock()
+
+	dtx := &DbContext{
 		db:            db,
-		TableConfs:    nil,
-		Name:          "Custom",
-		Driver:        driver,
-		ConnectString: connectString,
-	}, nil
+		timeout:       timeout,
+		Db: schema.Db{
+			Name:          "Custom",
+			Driver:        driver,
+			ConnectString: connectString,
+		},
+	}
+	dtxLock.RLock()
+	dtx.hook = newQueryHook(dtx)
+	dtxLock.RUnlock()
+	dtx.hook.attach(db)
+	return dtx, nil
+}
+
+/*
+* 获取指定默认语句超时的DB操作对象，与原对象共用连接，不影响原对象
+*
+* param  timeout  默认语句超时，0为不限
+* return DB操作对象
+ */
+func (dtx DbContext) WithTimeout(timeout time.Duration) *DbContext {
+	dtx.timeout = timeout
+	return &dtx
+}
+
+//内部方法：附加默认语句超时，ctx已有更早的截止时间时保持不变
+func (dtx DbContext) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if dtx.timeout <= 0 {
+		return ctx, func() {}
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= dtx.timeout {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, dtx.timeout)
 }
 
 /*
@@ -164,26 +281,22 @@ func NewContext(driver string, connectString string) (*DbContext, error) {
 * return 返回分表序号
  */
 func (dtx DbContext) GetTableIdx(tbname string, field string, value interface{}) (int32, error) {
-DoneLoop:
 	for _, c := range dtx.TableConfs {
 		if c.TableName == tbname {
 			for _, p := range c.Policies {
 				if p.Column == field {
-					hashValue := utility.GetHashcode(value)
-					if hashValue == 0 {
-						return -1, fmt.Errorf("必须提供字段值:%s", p.Column)
-					} else {
-						if p.Count > 1 {
-							hashValue = hashValue % int32(p.Count)
-						}
-
-						return hashValue, nil
+					suffix, err := policySuffix(p, value)
+					if err != nil {
+						return -1, err
 					}
-
-					break DoneLoop
+					idx, err := strconv.ParseInt(suffix, 10, 32)
+					if err != nil {
+						return -1, fmt.Errorf("分表后缀%s不是序号", suffix)
+					}
+					return int32(idx), nil
 				}
 			}
-			break DoneLoop
+			break
 		}
 	}
 
@@ -209,15 +322,11 @@ func (dtx DbContext) GetTableName(entity interface{}) (string, error) {
 				if v.Kind() == reflect.Ptr {
 					v = v.Elem()
 				}
-				hashValue := utility.GetHashcode(v.FieldByName(p.Column))
-				if hashValue == 0 {
-					return "", fmt.Errorf("必须提供字段参数:%v", p.Column)
-				} else {
-					if p.Count > 1 {
-						hashValue = hashValue % int32(p.Count)
-					}
-					tableName = fmt.Sprintf("%v_%d", tableName, hashValue)
+				suffix, err := policySuffix(p, v.FieldByName(p.Column))
+				if err != nil {
+					return "", err
 				}
+				tableName = fmt.Sprintf("%v_%s", tableName, suffix)
 			}
 			break
 		}
@@ -243,21 +352,22 @@ func (dtx DbContext) GetAllTableName(entity interface{}) ([]string, error) {
 		if c.TableName == tableName {
 			for _, p := range c.Policies {
 				var temp []string
+				//无法列出全部后缀（如count为0的按值分表）时按entity的字段值计算
+				suffixes, ok := policySuffixes(p)
+				if !ok {
+					v := reflect.ValueOf(entity)
+					if v.Kind() == reflect.Ptr {
+						v = v.Elem()
+					}
+					suffix, err := policySuffix(p, v.FieldByName(p.Column))
+					if err != nil {
+						return nil, err
+					}
+					suffixes = []string{suffix}
+				}
 				for _, n := range tables[len(tables)-1] {
-					if p.Count == 0 {
-						v := reflect.ValueOf(entity)
-						if v.Kind() == reflect.Ptr {
-							v = v.Elem()
-						}
-						hashValue := utility.GetHashcode(v.FieldByName(p.Column))
-						if hashValue == 0 {
-							return nil, fmt.Errorf("必须提供字段参数:%v", p.Column)
-						}
-						temp = append(temp, fmt.Sprintf("%v_%v", n, hashValue))
-					} else {
-						for i := 0; i < p.Count; i++ {
-							temp = append(temp, fmt.Sprintf("%v_%v", n, i))
-						}
+					for _, suffix := range suffixes {
+						temp = append(temp, fmt.Sprintf("%v_%v", n, suffix))
 					}
 				}
 				tables = append(tables, temp)
@@ -281,9 +391,20 @@ func (dtx DbContext) GetAllTableName(entity interface{}) ([]string, error) {
 * return 是否异常
  */
 func (dtx DbContext) Get(entity interface{}, id ...interface{}) error {
+	return dtx.GetContext(context.Background(), entity, id...)
+}
+
+//根据ID查询数据记录，ctx取消或超时时中止查询
+func (dtx DbContext) GetContext(ctx context.Context, entity interface{}, id ...interface{}) error {
+	_, err := dtx.get(ctx, entity, id...)
+	return err
+}
+
+//内部方法：根据ID查询数据记录，返回记录是否存在
+func (dtx DbContext) get(ctx context.Context, entity interface{}, id ...interface{}) (bool, error) {
 	var (
 		tbName string
-		err error
+		err    error
 	)
 
 	switch entity.(type) {
@@ -292,12 +413,17 @@ func (dtx DbContext) Get(entity interface{}, id ...interface{}) error {
 	default:
 		tbName, err = dtx.GetTableName(entity)
 		if err != nil {
-			return err
+			return false, err
 		}
 	}
 
-	_, err = dtx.db.Table(tbName).ID(id).Get(entity)
-	return err
+	ctx, cancel := dtx.withTimeout(ctx)
+	defer cancel()
+
+	db, fail := dtx.reader()
+	has, err := dtx.scope(db.Context(ctx)).Table(tbName).ID(id).Get(entity)
+	fail(err)
+	return has, err
 }
 
 /*
@@ -311,7 +437,12 @@ func (dtx DbContext) Get(entity interface{}, id ...interface{}) error {
 * return 入库成功数量
 */
 func (dtx DbContext) Inserts(entities ...interface{}) (int64, error) {
-	return dtx.ImportData(false, 0, entities...)
+	return dtx.ImportDataContext(context.Background(), false, 0, entities...)
+}
+
+//插入数据，ctx取消或超时时中止并回滚
+func (dtx DbContext) InsertsContext(ctx context.Context, entities ...interface{}) (int64, error) {
+	return dtx.ImportDataContext(ctx, false, 0, entities...)
 }
 
 /*
@@ -327,48 +458,96 @@ func (dtx DbContext) Inserts(entities ...interface{}) (int64, error) {
 * return 入库成功数量
  */
 func (dtx DbContext) ImportData(isIdentityInsert bool, batchNum int, entities ...interface{}) (int64, error) {
+	return dtx.ImportDataContext(context.Background(), isIdentityInsert, batchNum, entities...)
+}
+
+//批量导入数据，ctx取消或超时时中止并回滚
+func (dtx DbContext) ImportDataContext(ctx context.Context, isIdentityInsert bool, batchNum int, entities ...interface{}) (int64, error) {
 	if len(entities) == 0 {
 		return 0, errors.New("参数不能为空")
 	}
 
+	for _, bean := range entities {
+		fillAudit(ctx, bean, true)
+	}
+
+	ctx, cancel := dtx.withTimeout(ctx)
+	defer cancel()
+
+	//双写时在事务中同时写入新分表
+	if dtx.dualWrite() {
+		var n int64
+		err := dtx.Transaction(ctx, func(tx *Tx) error {
+			var err error
+			n, err = tx.ImportData(isIdentityInsert, batchNum, entities...)
+			return err
+		})
+		return n, err
+	}
+
+	//驱动自定义的批量插入（如clickhouse）
+	if b := dtx.batchInserter(); b != nil {
+		return dtx.batchInsert(ctx, b, isIdentityInsert, batchNum, entities)
+	}
+
 	if len(entities) == 1 {
 		tbName, err := dtx.GetTableName(entities[0])
 		if err != nil {
 			return 0, errors.New("GetTableName err:" + err.Error())
 		}
 
-		return dtx.db.Table(tbName).InsertOne(entities[0])
+		return dtx.db.Context(ctx).Table(tbName).InsertOne(entities[0])
 	}
 
-	//先按分表规则分组
-	group := make(map[string][]interface{})
-	for _, bean := range entities {
-		if tbn, err := dtx.GetTableName(bean); err != nil {
-			return 0, errors.New("GetTableName err:" + err.Error())
-		} else {
-			var temp []interface{}
-			if _beans, ok := group[tbn]; ok {
-				temp = _beans
-			}
-			temp = append(temp, bean)
-			group[tbn] = temp
-		}
+	group, err := dtx.groupByTable(entities)
+	if err != nil {
+		return 0, err
 	}
 
-	var n int64 = 0
-	session := dtx.db.NewSession()
+	session := dtx.db.NewSession().Context(ctx)
 	defer session.Close()
 
-	err := session.Begin()
+	err = session.Begin()
 	if err != nil {
 		return 0, errors.New("session.Begin err:" + err.Error())
 	}
 
+	n, err := dtx.insertGroup(session, isIdentityInsert, batchNum, group)
+	if err != nil {
+		_ = session.Rollback()
+		return 0, err
+	}
+
+	err = session.Commit()
+	if err != nil {
+		_ = session.Rollback()
+		return 0, errors.New("session.Commit err:" + err.Error())
+	}
+
+	return n, nil
+}
+
+//内部方法：按分表规则分组
+func (dtx DbContext) groupByTable(entities []interface{}) (map[string][]interface{}, error) {
+	group := make(map[string][]interface{})
+	for _, bean := range entities {
+		tbn, err := dtx.GetTableName(bean)
+		if err != nil {
+			return nil, errors.New("GetTableName err:" + err.Error())
+		}
+		group[tbn] = append(group[tbn], bean)
+	}
+	return group, nil
+}
+
+//内部方法：在事务会话中按表分批插入
+func (dtx DbContext) insertGroup(session *xorm.Session, isIdentityInsert bool, batchNum int, group map[string][]interface{}) (int64, error) {
 	_bnum := 1000
 	if batchNum > 0 {
 		_bnum = batchNum
 	}
 
+	var n int64 = 0
 	for k, v := range group {
 		if isIdentityInsert && dtx.Driver == "mssql" {
 			session.Exec(fmt.Sprintf("SET IDENTITY_INSERT %s on", k))
@@ -377,26 +556,47 @@ func (dtx DbContext) ImportData(isIdentityInsert bool, batchNum int, entities ..
 
 		_vlen := len(v)
 		for j := 0; j < _vlen; j += _bnum {
-			if j+_bnum > _vlen {
-				_bnum = _vlen - j
+			end := j + _bnum
+			if end > _vlen {
+				end = _vlen
 			}
 
 			session.Table(k)
-			r, err := session.Insert(v[j : j+_bnum])
+			r, err := session.Insert(v[j:end])
 			if err != nil {
-				_ = session.Rollback()
 				return 0, errors.New("session.Insert err:" + err.Error())
 			}
 			n += r
 		}
 	}
+	return n, nil
+}
 
-	err = session.Commit()
-	if err != nil {
-		_ = session.Rollback()
-		return 0, errors.New("session.Commit err:" + err.Error())
+//内部方法：按表分批调用驱动的批量插入，各批次单独提交
+func (dtx DbContext) batchInsert(ctx context.Context, b BatchInserter, isIdentityInsert bool, batchNum int, entities []interface{}) (int64, error) {
+	_bnum := 1000
+	if batchNum > 0 {
+		_bnum = batchNum
 	}
 
+	group, err := dtx.groupByTable(entities)
+	if err != nil {
+		return 0, err
+	}
+	var n int64 = 0
+	for k, v := range group {
+		for j := 0; j < len(v); j += _bnum {
+			end := j + _bnum
+			if end > len(v) {
+				end = len(v)
+			}
+			r, err := b.BatchInsert(ctx, dtx.db, k, isIdentityInsert, v[j:end])
+			if err != nil {
+				return n, errors.New("BatchInsert err:" + err.Error())
+			}
+			n += r
+		}
+	}
 	return n, nil
 }
 
@@ -410,9 +610,14 @@ func (dtx DbContext) ImportData(isIdentityInsert bool, batchNum int, entities ..
 *   }
 * param  condi          更新条件，支持map或struct类型
 *
-* return 入库成功数量
+* return 入库成功数量，实体定义了version字段时追加版本条件并加1，未匹配到记录时返回ErrStaleObject
  */
 func (dtx DbContext) Update(fullTableName string, entity interface{}, condi ...interface{}) (int64, error) {
+	return dtx.UpdateContext(context.Background(), fullTableName, entity, condi...)
+}
+
+//更新数据，ctx取消或超时时中止
+func (dtx DbContext) UpdateContext(ctx context.Context, fullTableName string, entity interface{}, condi ...interface{}) (int64, error) {
 	var err error
 	tbName := fullTableName
 	if tbName == "" {
@@ -421,8 +626,23 @@ func (dtx DbContext) Update(fullTableName string, entity interface{}, condi ...i
 			return 0, err
 		}
 	}
+	fillAudit(ctx, entity, false)
+
+	if dtx.dualWrite() {
+		var n int64
+		err = dtx.Transaction(ctx, func(tx *Tx) error {
+			n, err = tx.Update(fullTableName, entity, condi...)
+			return err
+		})
+		return n, err
+	}
+
+	ctx, cancel := dtx.withTimeout(ctx)
+	defer cancel()
 
-	return dtx.db.Table(tbName).Update(entity, condi...)
+	lock := dtx.versionLock(entity)
+	n, err := dtx.scope(dtx.db.Context(ctx)).Table(tbName).Update(entity, condi...)
+	return lock.check(tbName, n, err)
 }
 
 /*
@@ -433,19 +653,38 @@ func (dtx DbContext) Update(fullTableName string, entity interface{}, condi ...i
 * return 入库成功数量
  */
 func (dtx DbContext) BatchExec(req []BatchSqlReq) (int64, error) {
+	return dtx.BatchExecContext(context.Background(), req)
+}
+
+//批量执行SQL，ctx取消或超时时中止并回滚
+func (dtx DbContext) BatchExecContext(ctx context.Context, req []BatchSqlReq) (int64, error) {
 	if len(req) == 0 {
 		return 0, errors.New("参数不能为空")
 	}
 
+	ctx, cancel := dtx.withTimeout(ctx)
+	defer cancel()
+
 	var n int64 = 0
-	session := dtx.db.NewSession()
+	session := dtx.db.NewSession().Context(ctx)
 	defer session.Close()
 
 	err := session.Begin()
 	if err != nil {
-		return 0, errors.New("session.Begin err:"+err.Error())
+		return 0, errors.New("session.Begin err:" + err.Error())
 	}
 
+	//未提交时恢复已更新实体的版本值
+	var locks []*versionLock
+	committed := false
+	defer func() {
+		if !committed {
+			for _, l := range locks {
+				l.restore()
+			}
+		}
+	}()
+
 	for _, _sql := range req {
 		if _sql.Mode == 0 {
 			var sqlOrArgs []interface{}
@@ -455,7 +694,7 @@ func (dtx DbContext) BatchExec(req []BatchSqlReq) (int64, error) {
 			res, err := session.Exec(sqlOrArgs...)
 			if err != nil {
 				_ = session.Rollback()
-				return 0, errors.New("session.Exec err:"+err.Error())
+				return 0, errors.New("session.Exec err:" + err.Error())
 			}
 
 			_n, _ := res.RowsAffected()
@@ -464,28 +703,36 @@ func (dtx DbContext) BatchExec(req []BatchSqlReq) (int64, error) {
 			tbName, err := dtx.GetTableName(_sql.Bean)
 			if err != nil {
 				_ = session.Rollback()
-				return 0, errors.New("GetTableName err:"+err.Error())
+				return 0, errors.New("GetTableName err:" + err.Error())
 			}
 
+			fillAudit(ctx, _sql.Bean, true)
 			session.Table(tbName)
 			_n, err := session.InsertOne(_sql.Bean)
 			if err != nil {
 				_ = session.Rollback()
-				return 0, errors.New("session.InsertOne err:"+err.Error())
+				return 0, errors.New("session.InsertOne err:" + err.Error())
 			}
 			n += _n
 		} else if _sql.Mode == 2 {
 			tbName, err := dtx.GetTableName(_sql.Bean)
 			if err != nil {
 				_ = session.Rollback()
-				return 0, errors.New("GetTableName err:"+err.Error())
+				return 0, errors.New("GetTableName err:" + err.Error())
 			}
 
+			fillAudit(ctx, _sql.Bean, false)
+			lock := dtx.versionLock(_sql.Bean)
+			locks = append(locks, lock)
 			session.Table(tbName)
 			_n, err := session.Update(_sql.Bean, _sql.Condi)
 			if err != nil {
 				_ = session.Rollback()
-				return 0, errors.New("session.Update err:"+err.Error())
+				return 0, errors.New("session.Update err:" + err.Error())
+			}
+			if _n, err = lock.check(tbName, _n, nil); err != nil {
+				_ = session.Rollback()
+				return 0, err
 			}
 			n += _n
 		}
@@ -494,8 +741,9 @@ func (dtx DbContext) BatchExec(req []BatchSqlReq) (int64, error) {
 	err = session.Commit()
 	if err != nil {
 		_ = session.Rollback()
-		return 0, errors.New("session.Commit err:"+err.Error())
+		return 0, errors.New("session.Commit err:" + err.Error())
 	}
+	committed = true
 
 	return n, nil
 }
@@ -509,6 +757,11 @@ func (dtx DbContext) BatchExec(req []BatchSqlReq) (int64, error) {
 * return 删除成功数量
  */
 func (dtx DbContext) Delete(fullTableName string, entity interface{}) (int64, error) {
+	return dtx.DeleteContext(context.Background(), fullTableName, entity)
+}
+
+//删除数据，ctx取消或超时时中止
+func (dtx DbContext) DeleteContext(ctx context.Context, fullTableName string, entity interface{}) (int64, error) {
 	var err error
 	tbName := fullTableName
 	if tbName == "" {
@@ -517,8 +770,23 @@ func (dtx DbContext) Delete(fullTableName string, entity interface{}) (int64, er
 			return 0, nil
 		}
 	}
+	if _, err = dtx.deletedColumn(entity); err != nil {
+		return 0, err
+	}
+
+	if dtx.dualWrite() {
+		var n int64
+		err = dtx.Transaction(ctx, func(tx *Tx) error {
+			n, err = tx.Delete(fullTableName, entity)
+			return err
+		})
+		return n, err
+	}
 
-	return dtx.db.Table(tbName).Delete(entity)
+	ctx, cancel := dtx.withTimeout(ctx)
+	defer cancel()
+
+	return dtx.scope(dtx.db.Context(ctx)).Table(tbName).Delete(entity)
 }
 
 /*
@@ -534,7 +802,18 @@ func (dtx DbContext) Delete(fullTableName string, entity interface{}) (int64, er
 * return 入库成功数量
  */
 func (dtx DbContext) Query(rowsSlicePtr interface{}, sql string, args ...interface{}) error {
-	return dtx.db.SQL(sql, args...).Find(rowsSlicePtr)
+	return dtx.QueryContext(context.Background(), rowsSlicePtr, sql, args...)
+}
+
+//自定义SQL查询，ctx取消或超时时中止查询
+func (dtx DbContext) QueryContext(ctx context.Context, rowsSlicePtr interface{}, sql string, args ...interface{}) error {
+	ctx, cancel := dtx.withTimeout(ctx)
+	defer cancel()
+
+	db, fail := dtx.reader()
+	err := db.Context(ctx).SQL(sql, args...).Find(rowsSlicePtr)
+	fail(err)
+	return err
 }
 
 /*
@@ -546,11 +825,21 @@ func (dtx DbContext) Query(rowsSlicePtr interface{}, sql string, args ...interfa
 * return 执行成功数量
  */
 func (dtx DbContext) Exec(sql string, args ...interface{}) (int64, error) {
+	return dtx.ExecContext(context.Background(), sql, args...)
+}
+
+//执行自定义SQL，ctx取消或超时时中止
+func (dtx DbContext) ExecContext(ctx context.Context, sql string, args ...interface{}) (int64, error) {
 	var sqlOrArgs []interface{}
 	sqlOrArgs = append(sqlOrArgs, sql)
 	sqlOrArgs = append(sqlOrArgs, args...)
 
-	res, err := dtx.db.Exec(sqlOrArgs...)
+	ctx, cancel := dtx.withTimeout(ctx)
+	defer cancel()
+
+	session := dtx.db.NewSession().Context(ctx)
+	defer session.Close()
+	res, err := session.Exec(sqlOrArgs...)
 	if err == nil {
 		_n, _ := res.RowsAffected()
 		return _n, nil
@@ -566,4 +855,7 @@ func (dtx DbContext) Engine() *xorm.Engine {
 //关闭连接
 func (dtx DbContext) Close() {
 	dtx.db.Close()
+	if dtx.replicas != nil {
+		dtx.replicas.close()
+	}
 }
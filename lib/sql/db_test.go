@@ -0,0 +1,62 @@
+package sql_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maclon-lee/golanglib/lib/config"
+	"github.com/maclon-lee/golanglib/lib/sql"
+	_ "github.com/maclon-lee/golanglib/lib/sql/sqlite"
+	"xorm.io/xorm"
+)
+
+//内部方法：sqlite内存数据库上下文，按beans建表，分表配置的表建全部分表
+func newSqlite(t *testing.T, confs []sql.SplitTableConf, beans ...interface{}) *sql.DbContext {
+	t.Helper()
+	dtx, err := sql.NewContext("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(dtx.Close)
+	dtx.TableConfs = confs
+
+	for _, bean := range beans {
+		tables, err := dtx.GetAllTableName(bean)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, table := range tables {
+			if err = dtx.Engine().Table(table).CreateTable(bean); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return dtx
+}
+
+//内部方法：按Id分表的规则
+func splitById(table string, count int) []sql.SplitTableConf {
+	return []sql.SplitTableConf{{TableName: table, Policies: []sql.Policy{{Column: "Id", Count: count, Hash: "mod"}}}}
+}
+
+//dbs.db.driver须为已注册的驱动
+func TestDriverValidation(t *testing.T) {
+	check := func(driver string) error {
+		toml := "[dbs]\n[[dbs.db]]\nname=\"a\"\nstr=\"x\"\ndriver=\"" + driver + "\"\n"
+		return config.Check(config.WithReader(strings.NewReader(toml)))
+	}
+	for _, driver := range []string{"mysql", "postgres", "sqlite"} {
+		if err := check(driver); err != nil {
+			t.Errorf("%s: %v", driver, err)
+		}
+	}
+	err := check("testdb")
+	if errs, ok := err.(config.ValidationErrors); !ok || len(errs) != 1 || errs[0].Key != "dbs.db[0].driver" {
+		t.Fatalf("unregistered driver: %v", err)
+	}
+
+	sql.RegisterDriver("testdb", sql.DriverFunc(func(string) (*xorm.Engine, error) { return nil, nil }))
+	if err = check("testdb"); err != nil {
+		t.Errorf("registered driver: %v", err)
+	}
+}
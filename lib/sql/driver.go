@@ -0,0 +1,79 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"github.com/maclon-lee/golanglib/lib/sql/schema"
+	"sync"
+	"xorm.io/xorm"
+)
+
+//数据库驱动，按连接字符串构造引擎，配置中dbs.db.driver使用注册的名称
+//sqlite和clickhouse驱动在lib/sql/sqlite、lib/sql/clickhouse中，引入后注册
+type Driver interface {
+	Open(connectString string) (*xorm.Engine, error)
+}
+
+//函数形式的数据库驱动
+type DriverFunc func(connectString string) (*xorm.Engine, error)
+
+func (f DriverFunc) Open(connectString string) (*xorm.Engine, error) {
+	return f(connectString)
+}
+
+//批量插入，驱动实现此接口时ImportData/Inserts按表调用，用于不支持多行VALUES的数据库（如clickhouse）
+type BatchInserter interface {
+	BatchInsert(ctx context.Context, db *xorm.Engine, tableName string, isIdentityInsert bool, beans []interface{}) (int64, error)
+}
+
+var driverLock sync.RWMutex
+var drivers = map[string]Driver{
+	"mysql": DriverFunc(func(connectString string) (*xorm.Engine, error) {
+		return xorm.NewEngine("mysql", connectString)
+	}),
+	"mssql":    DriverFunc(NewMssqlDriver),
+	"postgres": DriverFunc(NewPostgresDriver),
+}
+
+/*
+* 注册数据库驱动，注册后重新加载使用该驱动而未能连接的数据库上下文
+*
+* param  name    驱动名称，对应dbs.db的driver和连接池配置dbs.<name>
+* param  driver  数据库驱动，实现BatchInserter时批量插入使用该方法
+ */
+func RegisterDriver(name string, driver Driver) {
+	driverLock.Lock()
+	drivers[name] = driver
+	driverLock.Unlock()
+	schema.RegisterDriver(name)
+
+	dtxLock.RLock()
+	conf := dbConf
+	dtxLock.RUnlock()
+	if conf != nil {
+		if err := loadContexts(conf); err != nil {
+			log.Errorf("%s", err)
+		}
+	}
+}
+
+//内部方法：查找数据库驱动
+func lookupDriver(name string) (Driver, error) {
+	driverLock.RLock()
+	defer driverLock.RUnlock()
+	d, ok := drivers[name]
+	if !ok {
+		return nil, errors.New("不支持的数据库驱动:" + name)
+	}
+	return d, nil
+}
+
+//内部方法：驱动的批量插入方法，未实现时为nil
+func (dtx DbContext) batchInserter() BatchInserter {
+	d, err := lookupDriver(dtx.Driver)
+	if err != nil {
+		return nil
+	}
+	b, _ := d.(BatchInserter)
+	return b
+}
@@ -0,0 +1,291 @@
+package sql
+
+import (
+	"errors"
+	"fmt"
+	"github.com/maclon-lee/golanglib/lib/utility"
+	"hash/crc32"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//分表策略，根据分表字段值计算表名后缀
+type HashStrategy interface {
+	//计算字段值对应的表名后缀，value为nil（未提供）时返回错误，零值为有效值
+	Suffix(p Policy, value interface{}) (string, error)
+	//全部表名后缀，无法列出（如count为0的按值分表）时ok为false
+	Suffixes(p Policy) (suffixes []string, ok bool)
+}
+
+var hashLock sync.RWMutex
+var hashStrategies = map[string]HashStrategy{
+	"":        legacyHash{},
+	"legacy":  legacyHash{},
+	"crc32":   bytesHash{sum: crc32.ChecksumIEEE},
+	"murmur3": bytesHash{sum: func(data []byte) uint32 { return utility.Murmur3(data, 0) }},
+	"mod":     modHash{},
+	"range":   rangeHash{},
+	"date":    dateHash{},
+}
+
+/*
+* 注册分表策略，配置中policy.hash使用此名称
+*
+* param  name      策略名称
+* param  strategy  分表策略
+ */
+func RegisterHash(name string, strategy HashStrategy) {
+	hashLock.Lock()
+	defer hashLock.Unlock()
+	hashStrategies[name] = strategy
+}
+
+//内部方法：分表规则使用的策略
+func policyStrategy(p Policy) (HashStrategy, error) {
+	hashLock.RLock()
+	defer hashLock.RUnlock()
+	s, ok := hashStrategies[p.Hash]
+	if !ok {
+		return nil, fmt.Errorf("不支持的分表策略:%s", p.Hash)
+	}
+	return s, nil
+}
+
+//内部方法：按分表规则计算字段值对应的表名后缀
+func policySuffix(p Policy, value interface{}) (string, error) {
+	s, err := policyStrategy(p)
+	if err != nil {
+		return "", err
+	}
+	return s.Suffix(p, value)
+}
+
+//内部方法：分表规则的全部表名后缀
+func policySuffixes(p Policy) ([]string, bool) {
+	s, err := policyStrategy(p)
+	if err != nil {
+		return nil, false
+	}
+	return s.Suffixes(p)
+}
+
+//内部方法：取出字段值，未提供时返回错误
+func policyValue(p Policy, value interface{}) (interface{}, error) {
+	v, ok := utility.HashValue(value)
+	if !ok {
+		return nil, fmt.Errorf("必须提供字段参数:%v", p.Column)
+	}
+	return v, nil
+}
+
+//内部方法：0到count-1的后缀
+func countSuffixes(count int) ([]string, bool) {
+	if count <= 1 {
+		return nil, false
+	}
+	list := make([]string, count)
+	for i := range list {
+		list[i] = strconv.Itoa(i)
+	}
+	return list, true
+}
+
+//兼容原有分表的策略（hash为空）：utility.GetHashcode按count取余
+//与原有实现一致，直接对字段值（reflect.Value）计算，不取出driver.Valuer的值，哈希值为0时返回错误
+type legacyHash struct{}
+
+func (legacyHash) Suffix(p Policy, value interface{}) (string, error) {
+	hashValue := utility.GetHashcode(value)
+	if hashValue == 0 {
+		return "", fmt.Errorf("必须提供字段参数:%v", p.Column)
+	}
+	if p.Count > 1 {
+		hashValue = hashValue % int32(p.Count)
+	}
+	return strconv.Itoa(int(hashValue)), nil
+}
+
+func (legacyHash) Suffixes(p Policy) ([]string, bool) {
+	return countSuffixes(p.Count)
+}
+
+//crc32、murmur3：按值的规范字节表示计算哈希后按count取余，count为0时后缀为哈希值
+type bytesHash struct {
+	sum func(data []byte) uint32
+}
+
+func (h bytesHash) Suffix(p Policy, value interface{}) (string, error) {
+	data, ok := utility.HashBytes(value)
+	if !ok {
+		return "", fmt.Errorf("必须提供字段参数:%v", p.Column)
+	}
+	sum := h.sum(data)
+	if p.Count > 1 {
+		sum = sum % uint32(p.Count)
+	}
+	return strconv.FormatUint(uint64(sum), 10), nil
+}
+
+func (bytesHash) Suffixes(p Policy) ([]string, bool) {
+	return countSuffixes(p.Count)
+}
+
+//mod：整数值按count取余（负数取非负余数），count为0时后缀为值本身
+type modHash struct{}
+
+func (modHash) Suffix(p Policy, value interface{}) (string, error) {
+	v, err := policyValue(p, value)
+	if err != nil {
+		return "", err
+	}
+	n, err := toInt64(v)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", p.Column, err)
+	}
+	if p.Count > 1 {
+		n = n % int64(p.Count)
+		if n < 0 {
+			n += int64(p.Count)
+		}
+	}
+	return strconv.FormatInt(n, 10), nil
+}
+
+func (modHash) Suffixes(p Policy) ([]string, bool) {
+	return countSuffixes(p.Count)
+}
+
+//range：按step等宽分段（值/step），或按ranges分界值分段（小于ranges[i]的为第i段，其余为最后一段）
+type rangeHash struct{}
+
+func (rangeHash) Suffix(p Policy, value interface{}) (string, error) {
+	v, err := policyValue(p, value)
+	if err != nil {
+		return "", err
+	}
+	n, err := toInt64(v)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", p.Column, err)
+	}
+
+	if p.Step > 0 {
+		idx := int64(math.Floor(float64(n) / float64(p.Step)))
+		if p.Count > 0 && (idx < 0 || idx >= int64(p.Count)) {
+			return "", fmt.Errorf("%s的值%d超出分表范围", p.Column, n)
+		}
+		return strconv.FormatInt(idx, 10), nil
+	}
+	if len(p.Ranges) == 0 {
+		return "", fmt.Errorf("分表规则%s未配置step或ranges", p.Column)
+	}
+	idx := sort.Search(len(p.Ranges), func(i int) bool { return n < p.Ranges[i] })
+	return strconv.Itoa(idx), nil
+}
+
+func (rangeHash) Suffixes(p Policy) ([]string, bool) {
+	if p.Step > 0 {
+		return countSuffixes(p.Count)
+	}
+	if len(p.Ranges) == 0 {
+		return nil, false
+	}
+	return countSuffixes(len(p.Ranges) + 1)
+}
+
+//date：时间按format格式化为后缀，如format="200601"时为按月分表 order_202610
+type dateHash struct{}
+
+func (dateHash) Suffix(p Policy, value interface{}) (string, error) {
+	v, err := policyValue(p, value)
+	if err != nil {
+		return "", err
+	}
+	t, err := toTime(v)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", p.Column, err)
+	}
+	return t.Format(policyDateFormat(p)), nil
+}
+
+//按format的粒度列出start到当前时间的全部后缀，未配置start时ok为false
+func (dateHash) Suffixes(p Policy) ([]string, bool) {
+	if p.Start == "" {
+		return nil, false
+	}
+	start, err := toTime(p.Start)
+	if err != nil {
+		return nil, false
+	}
+
+	format := policyDateFormat(p)
+	next := func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }
+	if strings.Contains(format, "02") {
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	} else if strings.Contains(format, "01") {
+		start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location())
+		next = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	} else {
+		start = time.Date(start.Year(), 1, 1, 0, 0, 0, 0, start.Location())
+	}
+
+	var list []string
+	end := time.Now()
+	for t := start; !t.After(end); t = next(t) {
+		s := t.Format(format)
+		if len(list) == 0 || list[len(list)-1] != s {
+			list = append(list, s)
+		}
+	}
+	return list, true
+}
+
+func policyDateFormat(p Policy) string {
+	if p.Format == "" {
+		return "200601"
+	}
+	return p.Format
+}
+
+//内部方法：转换为整数
+func toInt64(v interface{}) (int64, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return 0, fmt.Errorf("值%d超出范围", rv.Uint())
+		}
+		return int64(rv.Uint()), nil
+	case reflect.String:
+		return strconv.ParseInt(rv.String(), 10, 64)
+	}
+	if b, ok := v.([]byte); ok {
+		return strconv.ParseInt(string(b), 10, 64)
+	}
+	return 0, fmt.Errorf("不支持的整数类型:%T", v)
+}
+
+//内部方法：转换为时间，字符串支持 2006-01-02 15:04:05、2006-01-02、2006-01 格式
+func toTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case []byte:
+		v = string(t)
+	}
+	if s, ok := v.(string); ok {
+		for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339Nano, "2006-01-02", "2006-01"} {
+			if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, errors.New("无法解析的时间:" + s)
+	}
+	return time.Time{}, fmt.Errorf("不支持的时间类型:%T", v)
+}
@@ -0,0 +1,65 @@
+package sql_test
+
+import (
+	"testing"
+
+	"github.com/maclon-lee/golanglib/lib/sql"
+	"gopkg.in/guregu/null.v3"
+)
+
+type legacyOrder struct {
+	Id     int64
+	UserId int64
+	Code   string
+	Shop   null.Int
+	Region null.String
+}
+
+func (legacyOrder) TableName() string {
+	return "legacy_order"
+}
+
+//原有分表（hash为空）的路由结果不能改变，期望值取自改造前的GetHashcode实现
+func TestLegacyHashStable(t *testing.T) {
+	dtx, err := sql.NewContext("mysql", "root@tcp(127.0.0.1:3306)/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dtx.Close()
+
+	cases := []struct {
+		column string
+		order  legacyOrder
+		want   string
+	}{
+		{"UserId", legacyOrder{UserId: 12345}, "legacy_order_1"},
+		{"UserId", legacyOrder{UserId: 7}, "legacy_order_7"},
+		{"Code", legacyOrder{Code: "abc"}, "legacy_order_2"},
+		{"Code", legacyOrder{Code: "order-20260101"}, "legacy_order_6"},
+		{"Shop", legacyOrder{Shop: null.IntFrom(5)}, "legacy_order_3"},
+		{"Shop", legacyOrder{Shop: null.IntFrom(-3)}, "legacy_order_3"},
+		{"Shop", legacyOrder{}, "legacy_order_1"},
+		{"Region", legacyOrder{Region: null.StringFrom("east")}, "legacy_order_6"},
+		{"Region", legacyOrder{Region: null.StringFrom("")}, "legacy_order_3"},
+	}
+	for _, c := range cases {
+		dtx.TableConfs = []sql.SplitTableConf{{TableName: "legacy_order", Policies: []sql.Policy{{Column: c.column, Count: 8}}}}
+		got, err := dtx.GetTableName(c.order)
+		if err != nil {
+			t.Fatalf("%s %+v: %s", c.column, c.order, err)
+		}
+		if got != c.want {
+			t.Errorf("%s %+v: got %s, want %s", c.column, c.order, got, c.want)
+		}
+	}
+
+	//GetTableIdx按原值计算
+	dtx.TableConfs = []sql.SplitTableConf{{TableName: "legacy_order", Policies: []sql.Policy{{Column: "UserId", Count: 8}}}}
+	if idx, err := dtx.GetTableIdx("legacy_order", "UserId", int64(12345)); err != nil || idx != 1 {
+		t.Errorf("GetTableIdx: got %d, %v, want 1", idx, err)
+	}
+	//哈希值为0时返回错误
+	if _, err = dtx.GetTableName(legacyOrder{}); err == nil {
+		t.Error("zero value should fail")
+	}
+}
@@ -0,0 +1,238 @@
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+//游标分页参数：WHERE key > ? ORDER BY key LIMIT n，多个分表依次遍历
+type Keyset struct {
+	Tables  []string      //指定表名，为空时为entity的全部分表
+	Key     string        //游标字段（表字段名），需唯一且有索引，默认为主键
+	Columns string        //查询字段，默认为*
+	Where   string        //附加条件（不含WHERE），如 Status=?
+	Args    []interface{} //附加条件的参数
+	After   interface{}   //起始游标（不含），nil时从头开始，只用于第一个表
+	Size    int           //每页行数，默认1000
+}
+
+/*
+* 逐行遍历查询结果，不会一次性加载全部数据，适用于大量数据导出
+* 不使用默认语句超时，由ctx控制中止
+*
+* param  ctx   上下文
+* param  sql   SQL语句
+* param  args  SQL参数
+* param  fn    每行调用一次，返回错误时停止遍历并返回该错误
+*
+* return 是否异常
+ */
+func (dtx DbContext) Iterate(ctx context.Context, sql string, args []interface{}, fn func(row map[string]interface{}) error) error {
+	db, fail := dtx.reader()
+	for _, f := range db.Dialect().Filters() {
+		sql = f.Do(sql)
+	}
+	rows, err := db.DB().QueryContext(ctx, sql, args...)
+	if err != nil {
+		fail(err)
+		return err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		row := make(map[string]interface{}, len(cols))
+		for i, c := range cols {
+			if b, ok := values[i].([]byte); ok {
+				row[c] = string(b)
+			} else {
+				row[c] = values[i]
+			}
+		}
+		if err = fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+/*
+* 查询结果逐行写入通道，通道类型为 chan T 或 chan *T（T为struct），完成或出错后关闭通道
+* 调用方须读完通道或取消ctx，不使用默认语句超时
+*
+*   ch := make(chan *Order, 100)
+*   go func() { errc <- dtx.Stream(ctx, ch, "select * from orders where Status=?", 1) }()
+*   for o := range ch { ... }
+*
+* param  ctx   上下文，取消时停止写入
+* param  ch    写入的通道
+* param  sql   SQL语句
+* param  args  SQL参数
+*
+* return 是否异常
+ */
+func (dtx DbContext) Stream(ctx context.Context, ch interface{}, sql string, args ...interface{}) error {
+	cv := reflect.ValueOf(ch)
+	if cv.Kind() != reflect.Chan || cv.Type().ChanDir()&reflect.SendDir == 0 {
+		return errors.New("ch必须为chan T或chan *T")
+	}
+	defer cv.Close()
+
+	elemType := cv.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return fmt.Errorf("不支持的记录类型:%s", cv.Type().Elem())
+	}
+
+	db, fail := dtx.reader()
+	session := db.NewSession().Context(ctx)
+	defer session.Close()
+	rows, err := session.SQL(sql, args...).Rows(reflect.New(elemType).Interface())
+	if err != nil {
+		fail(err)
+		return err
+	}
+	defer rows.Close()
+
+	done := reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}
+	for rows.Next() {
+		bean := reflect.New(elemType)
+		if err = rows.Scan(bean.Interface()); err != nil {
+			return err
+		}
+		if !isPtr {
+			bean = bean.Elem()
+		}
+		send := reflect.SelectCase{Dir: reflect.SelectSend, Chan: cv, Send: bean}
+		if chosen, _, _ := reflect.Select([]reflect.SelectCase{send, done}); chosen == 1 {
+			return ctx.Err()
+		}
+	}
+	//xorm的Rows遍历结束时Err为ErrNoRows
+	if err = rows.Err(); err != nil && err != stdsql.ErrNoRows {
+		return err
+	}
+	return nil
+}
+
+/*
+* 按游标分页遍历，多个分表按表名依次遍历，每页调用一次fn
+*
+* param  ctx     上下文，每页查询使用默认语句超时
+* param  entity  数据对象，用于获取表名、主键和记录类型
+* param  k       分页参数
+* param  fn      每页调用一次，page为*[]T（T为entity的类型），返回错误时停止遍历并返回该错误
+*
+* return 是否异常
+ */
+func (dtx DbContext) IterateKeyset(ctx context.Context, entity interface{}, k Keyset, fn func(table string, page interface{}) error) error {
+	elemType := reflect.TypeOf(entity)
+	for elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return fmt.Errorf("不支持的记录类型:%s", elemType)
+	}
+
+	if k.Key == "" {
+		table, err := dtx.db.TableInfo(entity)
+		if err != nil {
+			return err
+		}
+		if len(table.PrimaryKeys) != 1 {
+			return fmt.Errorf("%s不是单列主键，需指定Key", table.Name)
+		}
+		k.Key = table.PrimaryKeys[0]
+	}
+	if k.Size <= 0 {
+		k.Size = 1000
+	}
+	if k.Columns == "" {
+		k.Columns = "*"
+	}
+	//软删除的实体只遍历未删除的记录
+	where, err := dtx.scopeWhere(k.Where, entity)
+	if err != nil {
+		return err
+	}
+	k.Where = strings.TrimPrefix(where, " WHERE ")
+
+	tables, err := dtx.shardTables(entity, k.Tables)
+	if err != nil {
+		return err
+	}
+	getter, err := dtx.columnGetter(elemType)
+	if err != nil {
+		return err
+	}
+
+	after := k.After
+	for _, table := range tables {
+		for {
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			page := reflect.New(reflect.SliceOf(elemType))
+			sql, args := dtx.keysetSql(table, k, after)
+			if err = dtx.QueryContext(ctx, page.Interface(), sql, args...); err != nil {
+				return fmt.Errorf("%s: %s", table, err)
+			}
+
+			n := page.Elem().Len()
+			if n == 0 {
+				break
+			}
+			if err = fn(table, page.Interface()); err != nil {
+				return err
+			}
+			if n < k.Size {
+				break
+			}
+			after = plainValue(getter(page.Elem().Index(n-1), k.Key))
+		}
+		after = nil
+	}
+	return nil
+}
+
+//内部方法：游标分页SQL
+func (dtx DbContext) keysetSql(table string, k Keyset, after interface{}) (string, []interface{}) {
+	key := dtx.db.Quote(k.Key)
+	var conds []string
+	var args []interface{}
+	if after != nil {
+		conds = append(conds, key+">?")
+		args = append(args, after)
+	}
+	if k.Where != "" {
+		conds = append(conds, "("+k.Where+")")
+		args = append(args, k.Args...)
+	}
+
+	var where string
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	if dtx.Driver == "mssql" {
+		return fmt.Sprintf("SELECT TOP %d %s FROM %s%s ORDER BY %s", k.Size, k.Columns, table, where, key), args
+	}
+	return fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s LIMIT %d", k.Columns, table, where, key, k.Size), args
+}
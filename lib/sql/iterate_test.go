@@ -0,0 +1,146 @@
+package sql_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/maclon-lee/golanglib/lib/sql"
+)
+
+//内部方法：遍历结束后连接应已归还连接池
+func checkConnReleased(t *testing.T, dtx *sql.DbContext) {
+	t.Helper()
+	if n := dtx.Engine().DB().Stats().InUse; n != 0 {
+		t.Errorf("connections in use = %d, rows not closed", n)
+	}
+}
+
+func TestIterate(t *testing.T) {
+	dtx := newShardItems(t)
+	ctx := context.Background()
+
+	var ids []int64
+	var codes []interface{}
+	err := dtx.Iterate(ctx, "SELECT Id, Code FROM shard_item_1 WHERE Id>? ORDER BY Id", []interface{}{0}, func(row map[string]interface{}) error {
+		ids = append(ids, row["Id"].(int64))
+		codes = append(codes, row["Code"])
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []int64{1, 3, 5}) || !reflect.DeepEqual(codes, []interface{}{"9", "2", "a"}) {
+		t.Errorf("ids = %v, codes = %v", ids, codes)
+	}
+	checkConnReleased(t, dtx)
+
+	//回调返回错误时停止遍历并关闭游标
+	errStop := errors.New("stop")
+	n := 0
+	err = dtx.Iterate(ctx, "SELECT * FROM shard_item_1", nil, func(row map[string]interface{}) error {
+		n++
+		return errStop
+	})
+	if err != errStop || n != 1 {
+		t.Errorf("stop: err = %v, rows = %d", err, n)
+	}
+	checkConnReleased(t, dtx)
+
+	if err = dtx.Iterate(ctx, "SELECT * FROM not_exist", nil, func(map[string]interface{}) error { return nil }); err == nil {
+		t.Error("expected error for missing table")
+	}
+	checkConnReleased(t, dtx)
+}
+
+func TestStream(t *testing.T) {
+	dtx := newShardItems(t)
+	ctx := context.Background()
+
+	ch := make(chan *shardItem, 10)
+	if err := dtx.Stream(ctx, ch, "SELECT * FROM shard_item_1 ORDER BY Id"); err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for item := range ch {
+		ids = append(ids, item.Id)
+	}
+	if !reflect.DeepEqual(ids, []int64{1, 3, 5}) {
+		t.Errorf("ids = %v", ids)
+	}
+
+	values := make(chan shardItem, 10)
+	if err := dtx.Stream(ctx, values, "SELECT * FROM shard_item_0 WHERE Id=?", 4); err != nil {
+		t.Fatal(err)
+	}
+	if item, ok := <-values; !ok || item.Amount != 7 {
+		t.Errorf("value item = %+v, %v", item, ok)
+	}
+	if _, ok := <-values; ok {
+		t.Error("channel not closed")
+	}
+
+	if err := dtx.Stream(ctx, make(chan int), "SELECT 1"); err == nil {
+		t.Error("expected error for chan int")
+	}
+
+	//取消ctx时停止写入，关闭通道和游标
+	cctx, cancel := context.WithCancel(ctx)
+	unbuffered := make(chan *shardItem)
+	errc := make(chan error, 1)
+	go func() { errc <- dtx.Stream(cctx, unbuffered, "SELECT * FROM shard_item_1 ORDER BY Id") }()
+	<-unbuffered
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("cancel err = %v", err)
+	}
+	for range unbuffered {
+	}
+	checkConnReleased(t, dtx)
+}
+
+func TestIterateKeyset(t *testing.T) {
+	dtx := newShardItems(t)
+	ctx := context.Background()
+
+	var pages []string
+	collect := func(table string, page interface{}) error {
+		var ids []int64
+		for _, item := range *page.(*[]shardItem) {
+			ids = append(ids, item.Id)
+		}
+		pages = append(pages, fmt.Sprint(table, ids))
+		return nil
+	}
+	if err := dtx.IterateKeyset(ctx, &shardItem{}, sql.Keyset{Size: 2}, collect); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"shard_item_0[2 4]", "shard_item_1[1 3]", "shard_item_1[5]"}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("pages = %v, want %v", pages, want)
+	}
+
+	//After只用于第一个表，附加条件用于全部表
+	pages = nil
+	k := sql.Keyset{Size: 2, After: 2, Where: "Amount<?", Args: []interface{}{50}}
+	if err := dtx.IterateKeyset(ctx, &shardItem{}, k, collect); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"shard_item_0[4]", "shard_item_1[1 5]"}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("pages = %v, want %v", pages, want)
+	}
+
+	errStop := errors.New("stop")
+	n := 0
+	err := dtx.IterateKeyset(ctx, &shardItem{}, sql.Keyset{Size: 1}, func(string, interface{}) error {
+		n++
+		return errStop
+	})
+	if err != errStop || n != 1 {
+		t.Errorf("stop: err = %v, pages = %d", err, n)
+	}
+	checkConnReleased(t, dtx)
+}
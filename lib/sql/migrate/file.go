@@ -0,0 +1,98 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//迁移文件名：版本_名称.up.sql、版本_名称.down.sql
+var filePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+/*
+* 加载目录中的SQL迁移文件，文件名格式为 版本_名称.up.sql 和 版本_名称.down.sql
+*
+* param  dir  迁移文件目录
+*
+* return 是否异常
+ */
+func (m *Migrator) LoadDir(dir string) error {
+	list, err := LoadDir(dir)
+	if err != nil {
+		return err
+	}
+	m.Add(list...)
+	return nil
+}
+
+/*
+* 读取目录中的SQL迁移文件
+*
+* param  dir  迁移文件目录
+*
+* return 迁移列表，按版本升序
+ */
+func LoadDir(dir string) ([]Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	var list []*Migration
+	for _, f := range files {
+		m := filePattern.FindStringSubmatch(f.Name())
+		if f.IsDir() || m == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", f.Name(), err)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mg, ok := byVersion[version]
+		if !ok {
+			mg = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mg
+			list = append(list, mg)
+		} else if mg.Name != m[2] {
+			return nil, fmt.Errorf("迁移版本号重复:%s", f.Name())
+		}
+		if m[3] == "up" {
+			mg.Up = strings.TrimSpace(string(data))
+			mg.Checksum = Checksum(mg.Up)
+		} else {
+			mg.Down = strings.TrimSpace(string(data))
+		}
+	}
+
+	result := make([]Migration, len(list))
+	for i, mg := range list {
+		result[i] = *mg
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+/*
+* 计算迁移SQL的校验和（sha256），忽略行尾的\r和首尾空白
+*
+* param  script  迁移SQL
+*
+* return 十六进制校验和
+ */
+func Checksum(script string) string {
+	script = strings.TrimSpace(strings.ReplaceAll(script, "\r\n", "\n"))
+	sum := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
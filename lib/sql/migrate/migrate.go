@@ -0,0 +1,525 @@
+/**数据库结构迁移：按版本执行up/down迁移，记录在schema_migration表中**/
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	logger "github.com/maclon-lee/golanglib/lib/log"
+	"github.com/maclon-lee/golanglib/lib/sql"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//migrate模块日志
+var log = logger.Named("migrate")
+
+//{shard:表名}：语句按该表的全部分表逐个执行
+var shardPattern = regexp.MustCompile(`\{shard:(\w+)\}`)
+
+//DELIMITER指令，独占一行，如DELIMITER $$，之后的语句以$$结束，DELIMITER ;恢复
+var delimiterPattern = regexp.MustCompile(`(?i)^[ \t]*DELIMITER[ \t]+(\S+)[ \t]*(?:\r?\n|$)`)
+
+//postgres美元引号：$$或$tag$
+var dollarPattern = regexp.MustCompile(`^\$(?:[A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+//迁移，SQL和Go函数二选一，mysql的DDL会隐式提交，失败时需手工处理已执行的语句
+type Migration struct {
+	Version  int64                  //版本号，按升序执行，如20261016120000
+	Name     string                 //名称
+	Up       string                 //升级SQL，多条语句以分号分隔（可用DELIMITER修改），{shard:表名}按分表展开
+	Down     string                 //回滚SQL
+	UpFunc   func(tx *sql.Tx) error //升级函数，分表可用Shards获取全部分表
+	DownFunc func(tx *sql.Tx) error //回滚函数
+	Checksum string                 //升级SQL的校验和，LoadDir自动计算，执行时记录，用于发现已执行后被修改的迁移
+}
+
+//迁移状态
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool      //是否已执行
+	AppliedAt time.Time //执行时间
+	Missing   bool      //已执行但找不到迁移定义
+	Changed   bool      //已执行后迁移内容被修改（校验和不一致）
+}
+
+//迁移记录
+type history struct {
+	Version   int64     `xorm:"pk notnull"`
+	Name      string    `xorm:"varchar(255)"`
+	AppliedAt time.Time `xorm:"notnull"`
+	Checksum  string    `xorm:"varchar(64)"`
+}
+
+func (history) TableName() string {
+	return "schema_migration"
+}
+
+//迁移锁，同一时间只允许一个进程执行迁移
+type lock struct {
+	Id       int       `xorm:"pk notnull"`
+	Owner    string    `xorm:"varchar(255)"`
+	ExpireAt time.Time `xorm:"notnull"`
+}
+
+func (lock) TableName() string {
+	return "schema_migration_lock"
+}
+
+var regLock sync.Mutex
+var registry = map[string][]Migration{}
+
+/*
+* 注册Go迁移，New时按数据库名称加入
+*
+* param  db          数据库名称，对应config.toml中dbs.db的name值
+* param  migrations  迁移列表
+ */
+func Register(db string, migrations ...Migration) {
+	regLock.Lock()
+	defer regLock.Unlock()
+	registry[db] = append(registry[db], migrations...)
+}
+
+//迁移执行器
+type Migrator struct {
+	LockTTL time.Duration                         //迁移锁的有效期，进程异常退出后超过有效期可重新执行，默认10分钟
+	Logf    func(format string, a ...interface{}) //进度输出，默认写入migrate日志
+
+	dtx        *sql.DbContext
+	migrations []Migration
+	owner      string
+}
+
+/*
+* 构建迁移执行器，包含Register注册的迁移
+*
+* param  dtx  数据库上下文
+*
+* return 迁移执行器
+ */
+func New(dtx *sql.DbContext) *Migrator {
+	host, _ := os.Hostname()
+	m := &Migrator{
+		LockTTL: 10 * time.Minute,
+		Logf:    log.Infof,
+		dtx:     dtx,
+		owner:   fmt.Sprintf("%s:%d:%d", host, os.Getpid(), time.Now().UnixNano()),
+	}
+	regLock.Lock()
+	m.migrations = append(m.migrations, registry[dtx.Name]...)
+	regLock.Unlock()
+	return m
+}
+
+//添加迁移
+func (m *Migrator) Add(migrations ...Migration) *Migrator {
+	m.migrations = append(m.migrations, migrations...)
+	return m
+}
+
+/*
+* 迁移状态，按版本升序
+*
+* param  ctx  上下文
+*
+* return 状态列表
+ */
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	list, err := m.sorted()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var status []Status
+	for _, mg := range list {
+		s := Status{Version: mg.Version, Name: mg.Name}
+		if h, ok := applied[mg.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = h.AppliedAt
+			s.Changed = h.Checksum != "" && mg.Checksum != "" && h.Checksum != mg.Checksum
+			delete(applied, mg.Version)
+		}
+		status = append(status, s)
+	}
+	for _, h := range applied {
+		status = append(status, Status{Version: h.Version, Name: h.Name, Applied: true, AppliedAt: h.AppliedAt, Missing: true})
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Version < status[j].Version })
+	return status, nil
+}
+
+/*
+* 按版本升序执行未执行的迁移
+*
+* param  ctx    上下文，取消时在当前迁移完成后停止
+* param  steps  最多执行的数量，0为全部
+*
+* return 执行的数量
+ */
+func (m *Migrator) Up(ctx context.Context, steps int) (int, error) {
+	n := 0
+	err := m.locked(ctx, func() error {
+		list, err := m.sorted()
+		if err != nil {
+			return err
+		}
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for _, mg := range list {
+			if steps > 0 && n >= steps {
+				break
+			}
+			if _, ok := applied[mg.Version]; ok {
+				continue
+			}
+			if err := m.run(ctx, mg, true); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+/*
+* 按版本降序回滚已执行的迁移
+*
+* param  ctx    上下文，取消时在当前迁移完成后停止
+* param  steps  回滚的数量，0时为1
+*
+* return 回滚的数量
+ */
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	if steps <= 0 {
+		steps = 1
+	}
+	n := 0
+	err := m.locked(ctx, func() error {
+		list, err := m.latest(ctx, steps)
+		if err != nil {
+			return err
+		}
+		for _, mg := range list {
+			if err := m.run(ctx, mg, false); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+/*
+* 回滚并重新执行最后一个已执行的迁移
+*
+* param  ctx  上下文
+*
+* return 是否异常
+ */
+func (m *Migrator) Redo(ctx context.Context) error {
+	return m.locked(ctx, func() error {
+		list, err := m.latest(ctx, 1)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			return errors.New("没有已执行的迁移")
+		}
+		if err := m.run(ctx, list[0], false); err != nil {
+			return err
+		}
+		return m.run(ctx, list[0], true)
+	})
+}
+
+/*
+* 获取表的全部分表，用于Go迁移中按分表执行
+*
+* param  tx         事务
+* param  tableName  分表配置的表名
+*
+* return 表名列表，未配置分表时为表名本身
+ */
+func Shards(tx *sql.Tx, tableName string) ([]string, error) {
+	return tx.Context().ShardTables(tableName)
+}
+
+//内部方法：检查版本并按升序排列
+func (m *Migrator) sorted() ([]Migration, error) {
+	list := make([]Migration, len(m.migrations))
+	copy(list, m.migrations)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	for i, mg := range list {
+		if mg.Version <= 0 {
+			return nil, fmt.Errorf("迁移%s的版本号必须大于0", mg.Name)
+		}
+		if i > 0 && list[i-1].Version == mg.Version {
+			return nil, fmt.Errorf("迁移版本号重复:%d", mg.Version)
+		}
+	}
+	return list, nil
+}
+
+//内部方法：已执行的迁移
+func (m *Migrator) applied(ctx context.Context) (map[int64]history, error) {
+	db := m.dtx.Engine()
+	if err := db.Context(ctx).Sync2(new(history)); err != nil {
+		return nil, err
+	}
+	var rows []history
+	if err := db.Context(ctx).Find(&rows); err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]history, len(rows))
+	for _, h := range rows {
+		applied[h.Version] = h
+	}
+	return applied, nil
+}
+
+//内部方法：最后执行的n个迁移，按版本降序
+func (m *Migrator) latest(ctx context.Context, n int) ([]Migration, error) {
+	list, err := m.sorted()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]int64, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+	if len(versions) > n {
+		versions = versions[:n]
+	}
+
+	byVersion := make(map[int64]Migration, len(list))
+	for _, mg := range list {
+		byVersion[mg.Version] = mg
+	}
+	var result []Migration
+	for _, v := range versions {
+		mg, ok := byVersion[v]
+		if !ok {
+			return nil, fmt.Errorf("找不到已执行的迁移%d(%s)，无法回滚", v, applied[v].Name)
+		}
+		result = append(result, mg)
+	}
+	return result, nil
+}
+
+//内部方法：在事务中执行一个迁移并更新迁移记录
+func (m *Migrator) run(ctx context.Context, mg Migration, up bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := m.refresh(ctx); err != nil {
+		return err
+	}
+
+	script, fn, op := mg.Up, mg.UpFunc, "up"
+	if !up {
+		script, fn, op = mg.Down, mg.DownFunc, "down"
+	}
+	if script == "" && fn == nil {
+		return fmt.Errorf("迁移%d(%s)没有%s定义", mg.Version, mg.Name, op)
+	}
+
+	start := time.Now()
+	err := m.dtx.Transaction(ctx, func(tx *sql.Tx) error {
+		if fn != nil {
+			if err := fn(tx); err != nil {
+				return err
+			}
+		} else {
+			for _, stmt := range splitStatements(script) {
+				if err := m.exec(tx, stmt); err != nil {
+					return err
+				}
+			}
+		}
+
+		session := tx.Session()
+		if up {
+			_, err := session.Insert(&history{Version: mg.Version, Name: mg.Name, AppliedAt: time.Now(), Checksum: mg.Checksum})
+			return err
+		}
+		_, err := session.Where("version=?", mg.Version).Delete(new(history))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("迁移%d(%s) %s失败: %s", mg.Version, mg.Name, op, err)
+	}
+	m.Logf("migrate: %d(%s) %s完成，耗时%s", mg.Version, mg.Name, op, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+//内部方法：执行一条语句，含{shard:表名}时按全部分表逐个执行
+func (m *Migrator) exec(tx *sql.Tx, stmt string) error {
+	matches := shardPattern.FindAllStringSubmatch(stmt, -1)
+	if len(matches) == 0 {
+		_, err := tx.Exec(stmt)
+		return err
+	}
+	tableName := matches[0][1]
+	for _, mt := range matches[1:] {
+		if mt[1] != tableName {
+			return fmt.Errorf("一条语句只能展开一个分表:%s", stmt)
+		}
+	}
+
+	tables, err := Shards(tx, tableName)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if _, err := tx.Exec(shardPattern.ReplaceAllLiteralString(stmt, table)); err != nil {
+			return fmt.Errorf("%s: %s", table, err)
+		}
+	}
+	return nil
+}
+
+//内部方法：持有迁移锁执行，锁已被其他进程持有且未过期时返回错误
+func (m *Migrator) locked(ctx context.Context, fn func() error) error {
+	db := m.dtx.Engine()
+	if err := db.Context(ctx).Sync2(new(lock)); err != nil {
+		return err
+	}
+	//清理过期的锁，再以主键冲突保证只有一个进程插入成功
+	if _, err := db.Context(ctx).Where("id=1 AND expire_at<?", time.Now()).Delete(new(lock)); err != nil {
+		return err
+	}
+	if _, err := db.Context(ctx).Insert(&lock{Id: 1, Owner: m.owner, ExpireAt: time.Now().Add(m.lockTTL())}); err != nil {
+		cur := new(lock)
+		if has, _ := db.Context(ctx).ID(1).Get(cur); has {
+			return fmt.Errorf("迁移正在执行:%s，锁过期时间%s", cur.Owner, cur.ExpireAt.Format("2006-01-02 15:04:05"))
+		}
+		return err
+	}
+	defer func() {
+		//ctx取消时仍需释放锁
+		if _, err := db.Where("id=1 AND owner=?", m.owner).Delete(new(lock)); err != nil {
+			log.Errorf("释放迁移锁失败:%s", err)
+		}
+	}()
+	return fn()
+}
+
+//内部方法：延长迁移锁的有效期
+func (m *Migrator) refresh(ctx context.Context) error {
+	n, err := m.dtx.Engine().Context(ctx).Where("id=1 AND owner=?", m.owner).Cols("expire_at").Update(&lock{ExpireAt: time.Now().Add(m.lockTTL())})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("迁移锁已失效")
+	}
+	return nil
+}
+
+func (m *Migrator) lockTTL() time.Duration {
+	if m.LockTTL <= 0 {
+		return 10 * time.Minute
+	}
+	return m.LockTTL
+}
+
+//内部方法：拆分SQL语句并去掉--和/* */注释（保留/*!...*/和/*+...*/），忽略引号和$$美元引号中的分隔符
+//DELIMITER指令修改分隔符，用于mysql存储过程、触发器等含分号的BEGIN...END语句
+func splitStatements(script string) []string {
+	var (
+		list      []string
+		buf       strings.Builder
+		quote     byte
+		delim     = ";"
+		lineStart = true
+	)
+	flush := func() {
+		if s := strings.TrimSpace(buf.String()); s != "" {
+			list = append(list, s)
+		}
+		buf.Reset()
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		if quote != 0 {
+			buf.WriteByte(c)
+			if c == '\\' && quote != '`' && i+1 < len(script) {
+				i++
+				buf.WriteByte(script[i])
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		if lineStart {
+			if m := delimiterPattern.FindStringSubmatch(script[i:]); m != nil {
+				flush()
+				delim = m[1]
+				i += len(m[0]) - 1
+				continue
+			}
+		}
+		lineStart = c == '\n'
+
+		rest := script[i:]
+		switch {
+		case strings.HasPrefix(rest, delim):
+			flush()
+			i += len(delim) - 1
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '$' && dollarPattern.MatchString(rest):
+			tag := dollarPattern.FindString(rest)
+			n := len(rest)
+			if end := strings.Index(rest[len(tag):], tag); end >= 0 {
+				n = len(tag) + end + len(tag)
+			}
+			buf.WriteString(rest[:n])
+			i += n - 1
+			continue
+		case strings.HasPrefix(rest, "--"):
+			n := strings.IndexByte(rest, '\n')
+			if n < 0 {
+				n = len(rest)
+			}
+			i += n - 1
+			continue
+		case strings.HasPrefix(rest, "/*"):
+			n := len(rest)
+			if end := strings.Index(rest[2:], "*/"); end >= 0 {
+				n = end + 4
+			}
+			if strings.HasPrefix(rest, "/*!") || strings.HasPrefix(rest, "/*+") {
+				buf.WriteString(rest[:n])
+			} else {
+				buf.WriteByte(' ')
+			}
+			i += n - 1
+			continue
+		}
+		buf.WriteByte(c)
+	}
+	flush()
+	return list
+}
@@ -0,0 +1,141 @@
+package migrate
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/maclon-lee/golanglib/lib/sql"
+	_ "github.com/maclon-lee/golanglib/lib/sql/sqlite"
+)
+
+func TestSplitStatements(t *testing.T) {
+	cases := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"semicolon", "CREATE TABLE a(id int);\nINSERT INTO a VALUES(1);", []string{"CREATE TABLE a(id int)", "INSERT INTO a VALUES(1)"}},
+		{"quotes", "INSERT INTO a VALUES('x;y', \"z;\", `c;`);INSERT INTO a VALUES('it''s;');INSERT INTO a VALUES('a\\';b')",
+			[]string{"INSERT INTO a VALUES('x;y', \"z;\", `c;`)", "INSERT INTO a VALUES('it''s;')", "INSERT INTO a VALUES('a\\';b')"}},
+		{"line comment", "-- first; comment\nSELECT 1; -- trailing;\nSELECT 2;\n-- only comment", []string{"SELECT 1", "SELECT 2"}},
+		{"block comment", "/* header;\n still comment; */\nSELECT 1;\nSELECT /* a;b */ 2;\n/* only comment; */", []string{"SELECT 1", "SELECT   2"}},
+		{"mysql hint", "/*!40101 SET NAMES utf8 */;SELECT /*+ MAX_EXECUTION_TIME(1) */ 1;", []string{"/*!40101 SET NAMES utf8 */", "SELECT /*+ MAX_EXECUTION_TIME(1) */ 1"}},
+		{"dollar quote", "CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql;\nCREATE FUNCTION g() RETURNS text AS $body$ SELECT '$$;' $body$ LANGUAGE sql;",
+			[]string{"CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql", "CREATE FUNCTION g() RETURNS text AS $body$ SELECT '$$;' $body$ LANGUAGE sql"}},
+		{"delimiter", "DROP TRIGGER IF EXISTS t1;\nDELIMITER $$\nCREATE TRIGGER t1 BEFORE INSERT ON a FOR EACH ROW\nBEGIN\n  SET NEW.x = 1;\n  SET NEW.y = 2;\nEND$$\ndelimiter ;\nSELECT 1;",
+			[]string{"DROP TRIGGER IF EXISTS t1", "CREATE TRIGGER t1 BEFORE INSERT ON a FOR EACH ROW\nBEGIN\n  SET NEW.x = 1;\n  SET NEW.y = 2;\nEND", "SELECT 1"}},
+		{"shard", "ALTER TABLE {shard:sku} ADD c int;", []string{"ALTER TABLE {shard:sku} ADD c int"}},
+		{"empty", " ;\n-- nothing\n", nil},
+	}
+	for _, c := range cases {
+		if got := splitStatements(c.script); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+//内部方法：写入迁移文件
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"10_add_code.up.sql":     "ALTER TABLE item ADD code varchar(32);\n",
+		"10_add_code.down.sql":   "ALTER TABLE item DROP COLUMN code;",
+		"2_create_item.up.sql":   "CREATE TABLE item(id int);",
+		"2_create_item.down.sql": "DROP TABLE item;",
+		"3_seed.up.sql":          "INSERT INTO item(id) VALUES(1);\r\n",
+		"README.md":              "ignored",
+	})
+
+	list, err := LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []int64
+	for _, mg := range list {
+		versions = append(versions, mg.Version)
+	}
+	if !reflect.DeepEqual(versions, []int64{2, 3, 10}) {
+		t.Fatalf("versions = %v", versions)
+	}
+	if list[0].Name != "create_item" || list[0].Up != "CREATE TABLE item(id int);" || list[0].Down != "DROP TABLE item;" {
+		t.Errorf("migration 2 = %+v", list[0])
+	}
+	if list[1].Down != "" {
+		t.Errorf("migration 3 down = %q", list[1].Down)
+	}
+	for _, mg := range list {
+		if mg.Checksum != Checksum(mg.Up) || len(mg.Checksum) != 64 {
+			t.Errorf("migration %d checksum = %s", mg.Version, mg.Checksum)
+		}
+	}
+	if Checksum("SELECT 1;\r\nSELECT 2;\n") != Checksum("SELECT 1;\nSELECT 2;") {
+		t.Error("checksum should ignore CRLF and surrounding whitespace")
+	}
+	if Checksum("SELECT 1;") == Checksum("SELECT 2;") {
+		t.Error("checksum should change with content")
+	}
+
+	writeFiles(t, dir, map[string]string{"02_other.up.sql": "SELECT 1;"})
+	if _, err = LoadDir(dir); err == nil {
+		t.Error("expected error for duplicate version")
+	}
+}
+
+func TestUpDownStatus(t *testing.T) {
+	dtx, err := sql.NewContext("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(dtx.Close)
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"1_create_item.up.sql":   "CREATE TABLE item(id int, name varchar(32));\n/* seed; */\nINSERT INTO item VALUES(1, 'a;b');",
+		"1_create_item.down.sql": "DROP TABLE item;",
+		"2_seed.up.sql":          "INSERT INTO item VALUES(2, 'c');",
+		"2_seed.down.sql":        "DELETE FROM item WHERE id=2;",
+	})
+
+	ctx := context.Background()
+	m := New(dtx)
+	m.Logf = t.Logf
+	if err = m.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := m.Up(ctx, 0); err != nil || n != 2 {
+		t.Fatalf("up = %d, %v", n, err)
+	}
+	var count int64
+	if count, err = dtx.Engine().Table("item").Count(); err != nil || count != 2 {
+		t.Fatalf("item count = %d, %v", count, err)
+	}
+	if n, err := m.Down(ctx, 1); err != nil || n != 1 {
+		t.Fatalf("down = %d, %v", n, err)
+	}
+
+	//已执行的迁移文件被修改后状态为Changed
+	writeFiles(t, dir, map[string]string{"1_create_item.up.sql": "CREATE TABLE item(id int);"})
+	m = New(dtx)
+	if err = m.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 2 || !status[0].Applied || !status[0].Changed || status[1].Applied || status[1].Changed {
+		t.Errorf("status = %+v", status)
+	}
+}
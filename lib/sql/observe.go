@@ -0,0 +1,279 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	logger "github.com/maclon-lee/golanglib/lib/log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"xorm.io/xorm"
+	"xorm.io/xorm/contexts"
+)
+
+//SQL执行事件
+type QueryEvent struct {
+	Ctx      context.Context
+	Db       string        //数据库名称，dbs.db的name
+	Table    string        //表名，分表为配置的tableName
+	Op       string        //操作：select、insert、update、delete、upsert（merge/replace）、begin、commit、rollback、other
+	Sql      string        //SQL语句
+	Duration time.Duration //执行时间，查询为返回结果集的时间
+	Err      error
+}
+
+//链路追踪，SetTracer设置后每条SQL创建一个span
+type Tracer interface {
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+}
+
+//链路追踪的span
+type Span interface {
+	SetTag(key string, value interface{})
+	Finish(err error)
+}
+
+//SQL执行统计
+type QueryStat struct {
+	Db      string
+	Table   string
+	Op      string
+	Count   int64         //执行次数
+	Errors  int64         //错误次数
+	Total   time.Duration //总执行时间
+	Buckets []int64       //执行时间不超过QueryBuckets对应值的次数（累计）
+}
+
+//执行时间直方图的区间上限
+var QueryBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond, time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+var (
+	tracer    atomic.Value //tracerBox
+	observers []func(e QueryEvent)
+	obsLock   sync.RWMutex
+	stats     = make(map[statKey]*queryStat)
+	statsLock sync.Mutex
+)
+
+type tracerBox struct{ t Tracer }
+
+type statKey struct{ db, table, op string }
+
+type queryStat struct {
+	count, errors int64
+	total         time.Duration
+	buckets       []int64
+}
+
+//设置链路追踪，传nil时关闭
+func SetTracer(t Tracer) {
+	tracer.Store(tracerBox{t})
+}
+
+//订阅SQL执行事件，用于导出监控指标等，回调在执行SQL的协程中同步调用
+func OnQuery(fn func(e QueryEvent)) {
+	obsLock.Lock()
+	defer obsLock.Unlock()
+	observers = append(observers, fn)
+}
+
+//返回SQL执行统计，按数据库、表、操作排序
+func QueryStats() []QueryStat {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+
+	list := make([]QueryStat, 0, len(stats))
+	for k, s := range stats {
+		list = append(list, QueryStat{
+			Db: k.db, Table: k.table, Op: k.op,
+			Count: s.count, Errors: s.errors, Total: s.total,
+			Buckets: append([]int64{}, s.buckets...),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Db != b.Db {
+			return a.Db < b.Db
+		}
+		if a.Table != b.Table {
+			return a.Table < b.Table
+		}
+		return a.Op < b.Op
+	})
+	return list
+}
+
+//清空SQL执行统计
+func ResetQueryStats() {
+	statsLock.Lock()
+	stats = make(map[statKey]*queryStat)
+	statsLock.Unlock()
+}
+
+//内部方法：记录执行统计
+func record(e *QueryEvent) {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+
+	k := statKey{e.Db, e.Table, e.Op}
+	s, ok := stats[k]
+	if !ok {
+		s = &queryStat{buckets: make([]int64, len(QueryBuckets))}
+		stats[k] = s
+	}
+	s.count++
+	s.total += e.Duration
+	if e.Err != nil {
+		s.errors++
+	}
+	for i, b := range QueryBuckets {
+		if e.Duration <= b {
+			s.buckets[i]++
+		}
+	}
+}
+
+//xorm的SQL执行钩子，每个数据库上下文一个，主库和只读副本共用
+type queryHook struct {
+	db     string
+	driver string
+	tables []string //分表配置的表名，分表统计到配置的表名下
+	slow   int64    //慢查询阈值，单位：纳秒，0为不记录
+}
+
+type spanCtxKey struct{}
+
+//SQL语句中的表名
+var tablePattern = regexp.MustCompile(`(?is)^\s*(?:select\b.*?\bfrom|insert\s+(?:ignore\s+)?into|update|delete\s+from|merge\s+into|replace\s+into)\s+([\w.` + "`" + `"\[\]]+)`)
+
+//内部方法：构建SQL执行钩子
+func newQueryHook(c *DbContext) *queryHook {
+	h := &queryHook{db: c.Name, driver: c.Driver}
+	for _, t := range c.TableConfs {
+		h.tables = append(h.tables, t.TableName)
+	}
+	h.setSlow(defaultSlowQuery(c.Driver, c.SlowQuery))
+	return h
+}
+
+//内部方法：慢查询阈值，优先取dbs.db的slowQuery，其次取dbs.<driver>.slowQuery
+func defaultSlowQuery(driver string, slowQuery int) time.Duration {
+	if slowQuery <= 0 && dbConf != nil && dbConf.IsSet(driver+".slowQuery") {
+		slowQuery = dbConf.GetInt(driver + ".slowQuery")
+	}
+	return time.Duration(slowQuery) * time.Millisecond
+}
+
+//内部方法：设置慢查询阈值
+func (h *queryHook) setSlow(d time.Duration) {
+	atomic.StoreInt64(&h.slow, int64(d))
+}
+
+//内部方法：在引擎上注册钩子
+func (h *queryHook) attach(db *xorm.Engine) {
+	if h != nil && db != nil {
+		db.AddHook(h)
+	}
+}
+
+func (h *queryHook) BeforeProcess(c *contexts.ContextHook) (context.Context, error) {
+	ctx := c.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if box, _ := tracer.Load().(tracerBox); box.t != nil {
+		table, op := h.parse(c.SQL)
+		var span Span
+		ctx, span = box.t.StartSpan(ctx, "sql."+op)
+		span.SetTag("db.system", h.driver)
+		span.SetTag("db.instance", h.db)
+		span.SetTag("db.table", table)
+		span.SetTag("db.operation", op)
+		span.SetTag("db.statement", c.SQL)
+		if id := logger.TraceID(ctx); id != "" {
+			span.SetTag(logger.TraceIDKey, id)
+		}
+		ctx = context.WithValue(ctx, spanCtxKey{}, span)
+	}
+	return ctx, nil
+}
+
+func (h *queryHook) AfterProcess(c *contexts.ContextHook) error {
+	if c.Ctx == nil {
+		c.Ctx = context.Background()
+	}
+	table, op := h.parse(c.SQL)
+	e := QueryEvent{Ctx: c.Ctx, Db: h.db, Table: table, Op: op, Sql: c.SQL, Duration: c.ExecuteTime, Err: c.Err}
+
+	if span, ok := c.Ctx.Value(spanCtxKey{}).(Span); ok {
+		span.Finish(c.Err)
+	}
+	record(&e)
+
+	if slow := time.Duration(atomic.LoadInt64(&h.slow)); slow > 0 && c.ExecuteTime >= slow {
+		log.Ctx(c.Ctx).Warnw("慢查询", "db", h.db, "table", table, "ms", c.ExecuteTime.Milliseconds(), "sql", c.SQL, "args", redact(c.Args))
+	}
+
+	obsLock.RLock()
+	fns := observers
+	obsLock.RUnlock()
+	for _, fn := range fns {
+		fn(e)
+	}
+	return nil
+}
+
+//内部方法：解析SQL的表名和操作类型
+func (h *queryHook) parse(sql string) (string, string) {
+	s := strings.TrimSpace(sql)
+	op := "other"
+	if i := strings.IndexAny(s, " \t\r\n("); i > 0 {
+		op = strings.ToLower(s[:i])
+	} else if s != "" {
+		op = strings.ToLower(s)
+	}
+	switch op {
+	case "select", "insert", "update", "delete", "begin", "commit", "rollback":
+	case "merge", "replace":
+		op = "upsert"
+	case "with":
+		op = "select"
+	default:
+		op = "other"
+	}
+
+	m := tablePattern.FindStringSubmatch(s)
+	if m == nil {
+		return "", op
+	}
+	table := m[1]
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		table = table[i+1:]
+	}
+	table = strings.Trim(table, "`\"[]")
+	for _, t := range h.tables {
+		if strings.EqualFold(table, t) || len(table) > len(t) && strings.EqualFold(table[:len(t)+1], t+"_") {
+			return t, op
+		}
+	}
+	return table, op
+}
+
+//内部方法：参数脱敏，只保留类型
+func redact(args []interface{}) string {
+	types := make([]string, len(args))
+	for i, a := range args {
+		if a == nil {
+			types[i] = "nil"
+		} else {
+			types[i] = fmt.Sprintf("%T", a)
+		}
+	}
+	return "[" + strings.Join(types, " ") + "]"
+}
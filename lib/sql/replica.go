@@ -0,0 +1,294 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+	"xorm.io/xorm"
+)
+
+//只读副本
+type replica struct {
+	dsn     string
+	db      *xorm.Engine
+	healthy int32 //1为可用
+	latency int64 //健康检查的平均延迟，单位：纳秒
+	lag     int64 //复制延迟，单位：纳秒
+	err     atomic.Value
+	lagErr  atomic.Value //复制延迟无法查询的原因
+	warned  int32        //已记录复制延迟无法查询的日志
+}
+
+//只读副本状态
+type ReplicaStatus struct {
+	Index    int           //replicas中的序号
+	Healthy  bool          //是否可用，不可用的副本不参与读取
+	Latency  time.Duration //健康检查的平均延迟
+	Lag      time.Duration //复制延迟，mssql不检查
+	LagError string        //复制延迟无法查询的原因（如缺少REPLICATION CLIENT权限），此时Lag为0
+	Error    string        //最近一次健康检查的错误
+}
+
+//只读副本池
+type replicaSet struct {
+	driver   string
+	list     []*replica
+	balance  string
+	maxLag   time.Duration
+	interval time.Duration
+	next     uint32
+	stop     chan struct{}
+	once     sync.Once
+}
+
+//内部方法：构建只读副本池并开始健康检查，连接失败的副本标记为不可用
+func newReplicaSet(c *DbContext) *replicaSet {
+	rs := &replicaSet{
+		driver:   c.Driver,
+		balance:  c.Balance,
+		maxLag:   time.Duration(c.MaxLag) * time.Millisecond,
+		interval: time.Duration(c.HealthInterval) * time.Millisecond,
+		stop:     make(chan struct{}),
+	}
+	if rs.interval <= 0 {
+		rs.interval = 5 * time.Second
+	}
+
+	for _, dsn := range c.Replicas {
+		r := &replica{dsn: dsn}
+		db, err := newEngine(c.Driver, dsn)
+		if err != nil {
+			log.Errorf("数据库只读副本:%s, 错误:%s", c.Name, err)
+			r.err.Store(err.Error())
+		} else {
+			r.db = db
+			c.hook.attach(db)
+		}
+		rs.list = append(rs.list, r)
+	}
+
+	go rs.run()
+	return rs
+}
+
+//内部方法：定时健康检查，首次检查通过前读操作使用主库
+func (rs *replicaSet) run() {
+	rs.check()
+	ticker := time.NewTicker(rs.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rs.stop:
+			return
+		case <-ticker.C:
+			rs.check()
+		}
+	}
+}
+
+//内部方法：检查全部副本的连通性、延迟和复制延迟
+func (rs *replicaSet) check() {
+	var wg sync.WaitGroup
+	for _, r := range rs.list {
+		if r.db == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			err := rs.checkOne(r)
+			if err != nil {
+				r.err.Store(err.Error())
+				if atomic.SwapInt32(&r.healthy, 0) == 1 {
+					log.Warnf("只读副本不可用:%s", err)
+				}
+				return
+			}
+			r.err.Store("")
+			if atomic.SwapInt32(&r.healthy, 1) == 0 {
+				log.Infof("只读副本恢复可用")
+			}
+		}(r)
+	}
+	wg.Wait()
+}
+
+//内部方法：检查单个副本
+func (rs *replicaSet) checkOne(r *replica) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rs.interval)
+	defer cancel()
+
+	start := time.Now()
+	if err := r.db.PingContext(ctx); err != nil {
+		return err
+	}
+	cost := int64(time.Since(start))
+	if old := atomic.LoadInt64(&r.latency); old > 0 {
+		//指数加权平均，避免单次抖动
+		cost = (old*7 + cost) / 8
+	}
+	atomic.StoreInt64(&r.latency, cost)
+
+	lag, err := rs.replicationLag(ctx, r.db)
+	if err != nil {
+		if !isPermissionError(err) {
+			return err
+		}
+		//无权限查询复制状态时延迟未知，未设置maxLag时副本仍可用
+		r.lagErr.Store(err.Error())
+		atomic.StoreInt64(&r.lag, 0)
+		if atomic.SwapInt32(&r.warned, 1) == 0 {
+			log.Warnf("只读副本复制延迟无法查询:%s", err)
+		}
+		if rs.maxLag > 0 {
+			return errors.New("复制延迟未知，无法校验maxLag:" + err.Error())
+		}
+		return nil
+	}
+	r.lagErr.Store("")
+	atomic.StoreInt64(&r.lag, int64(lag))
+	if rs.maxLag > 0 && lag > rs.maxLag {
+		return errors.New("复制延迟" + lag.String() + "超过maxLag")
+	}
+	return nil
+}
+
+//内部方法：查询复制延迟，mssql不检查
+func (rs *replicaSet) replicationLag(ctx context.Context, db *xorm.Engine) (time.Duration, error) {
+	switch rs.driver {
+	case "mysql":
+		rows, err := db.Context(ctx).QueryInterface("SHOW SLAVE STATUS")
+		if err != nil || len(rows) == 0 {
+			return 0, err
+		}
+		v := plainValue(rows[0]["Seconds_Behind_Master"])
+		if v == nil {
+			return 0, errors.New("复制已停止")
+		}
+		return time.Duration(toFloat(v) * float64(time.Second)), nil
+	case "postgres":
+		//主库长时间无写入时pg_last_xact_replay_timestamp不更新，延迟会偏大
+		rows, err := db.Context(ctx).QueryInterface("SELECT CASE WHEN pg_is_in_recovery() THEN COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0) ELSE 0 END AS lag")
+		if err != nil || len(rows) == 0 {
+			return 0, err
+		}
+		return time.Duration(toFloat(rows[0]["lag"]) * float64(time.Second)), nil
+	}
+	return 0, nil
+}
+
+//内部方法：是否为权限不足的错误
+func isPermissionError(err error) bool {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		//ER_SPECIFIC_ACCESS_DENIED_ERROR、ER_DBACCESS_DENIED_ERROR、ER_TABLEACCESS_DENIED_ERROR
+		return myErr.Number == 1227 || myErr.Number == 1044 || myErr.Number == 1142
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "42501"
+	}
+	return false
+}
+
+//内部方法：选择可用的副本，无可用副本时返回nil
+func (rs *replicaSet) pick() *replica {
+	var healthy []*replica
+	for _, r := range rs.list {
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	if rs.balance == "latency" {
+		best := healthy[0]
+		for _, r := range healthy[1:] {
+			if atomic.LoadInt64(&r.latency) < atomic.LoadInt64(&best.latency) {
+				best = r
+			}
+		}
+		return best
+	}
+	n := atomic.AddUint32(&rs.next, 1)
+	return healthy[int(n)%len(healthy)]
+}
+
+//内部方法：读取失败时，连接类错误立即将副本标记为不可用，等待健康检查恢复
+func (rs *replicaSet) fail(r *replica, err error) {
+	if r == nil || err == nil {
+		return
+	}
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr) {
+		r.err.Store(err.Error())
+		if atomic.SwapInt32(&r.healthy, 0) == 1 {
+			log.Warnf("只读副本不可用:%s", err)
+		}
+	}
+}
+
+//内部方法：停止健康检查并关闭副本连接
+func (rs *replicaSet) close() {
+	rs.once.Do(func() {
+		close(rs.stop)
+		for _, r := range rs.list {
+			if r.db != nil {
+				r.db.Close()
+			}
+		}
+	})
+}
+
+/*
+* 获取强制使用主库的DB操作对象，用于写后立即读等场景，与原对象共用连接
+*
+* return DB操作对象
+ */
+func (dtx DbContext) UsePrimary() *DbContext {
+	dtx.primary = true
+	return &dtx
+}
+
+//只读副本状态，未配置replicas时为空
+func (dtx DbContext) ReplicaStats() []ReplicaStatus {
+	if dtx.replicas == nil {
+		return nil
+	}
+	list := make([]ReplicaStatus, len(dtx.replicas.list))
+	for i, r := range dtx.replicas.list {
+		msg, _ := r.err.Load().(string)
+		lagMsg, _ := r.lagErr.Load().(string)
+		list[i] = ReplicaStatus{
+			Index:    i,
+			Healthy:  atomic.LoadInt32(&r.healthy) == 1,
+			Latency:  time.Duration(atomic.LoadInt64(&r.latency)),
+			Lag:      time.Duration(atomic.LoadInt64(&r.lag)),
+			LagError: lagMsg,
+			Error:    msg,
+		}
+	}
+	return list
+}
+
+//内部方法：读操作使用的引擎，未配置副本、指定主库或无可用副本时为主库
+func (dtx DbContext) reader() (*xorm.Engine, func(err error)) {
+	if dtx.primary || dtx.replicas == nil {
+		return dtx.db, func(error) {}
+	}
+	r := dtx.replicas.pick()
+	if r == nil {
+		return dtx.db, func(error) {}
+	}
+	return r.db, func(err error) {
+		dtx.replicas.fail(r, err)
+	}
+}
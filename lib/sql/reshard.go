@@ -0,0 +1,718 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"github.com/maclon-lee/golanglib/lib/sql/schema"
+	"xorm.io/xorm"
+	"xorm.io/xorm/schemas"
+)
+
+//分表迁移配置（config.toml中dbs.db.splitTables.reshard节点）
+type ReshardConf = schema.Reshard
+
+//分表迁移的进度记录，保存在同一数据库中
+type reshardCheckpoint struct {
+	Id      int64     `xorm:"pk autoincr"`
+	Job     string    `xorm:"varchar(255) notnull unique(job_source)"`
+	Source  string    `xorm:"varchar(128) notnull unique(job_source)"`
+	LastKey string    `xorm:"varchar(255)"`
+	Copied  int64     `xorm:"notnull default 0"`
+	Done    bool      `xorm:"notnull default false"`
+	Updated time.Time `xorm:"updated"`
+}
+
+func (reshardCheckpoint) TableName() string {
+	return "reshard_checkpoint"
+}
+
+//分表校验结果
+type ShardReport struct {
+	Table            string //新分表名
+	ExpectedCount    int64  //按新规则从原分表计算的行数
+	ActualCount      int64  //新分表的行数
+	ExpectedChecksum uint64 //按新规则从原分表计算的校验和
+	ActualChecksum   uint64 //新分表的校验和
+}
+
+//校验是否一致
+func (r ShardReport) OK() bool {
+	return r.ExpectedCount == r.ActualCount && r.ExpectedChecksum == r.ActualChecksum
+}
+
+//分表迁移任务：建新表、分批复制、校验、切换
+type Resharder struct {
+	BatchSize int                                   //单批复制行数，默认1000
+	Parallel  int                                   //并发复制的原分表数，默认1
+	Logf      func(format string, a ...interface{}) //进度输出，默认写入sql日志
+
+	dtx     *DbContext
+	conf    SplitTableConf
+	newBase string
+	job     string
+	meta    *schemas.Table
+	pk      *schemas.Column
+
+	oldTables []string
+	newTables []string
+}
+
+/*
+* 构建分表迁移任务
+*
+* param  dtx        数据库上下文，分表配置中需包含reshard节点
+* param  tableName  分表配置的表名
+*
+* return 迁移任务
+ */
+func NewResharder(dtx *DbContext, tableName string) (*Resharder, error) {
+	conf, ok := dtx.splitConf(tableName)
+	if !ok || conf.Reshard == nil {
+		return nil, fmt.Errorf("%s未配置splitTables.reshard", tableName)
+	}
+	newBase := reshardBase(conf)
+	oldTables, err := shardNames(conf.TableName, conf.Policies)
+	if err != nil {
+		return nil, err
+	}
+	newTables, err := shardNames(newBase, conf.Reshard.Policies)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Resharder{
+		BatchSize: 1000,
+		Parallel:  1,
+		Logf:      log.Infof,
+		dtx:       dtx,
+		conf:      conf,
+		newBase:   newBase,
+		job:       conf.TableName + "->" + newBase,
+		oldTables: oldTables,
+		newTables: newTables,
+	}, nil
+}
+
+//原分表列表
+func (r *Resharder) OldTables() []string {
+	return r.oldTables
+}
+
+//新分表列表
+func (r *Resharder) NewTables() []string {
+	return r.newTables
+}
+
+/*
+* 按第一个原分表的结构创建新分表和索引，已存在的表跳过
+*
+* param  ctx  上下文
+*
+* return 是否异常
+ */
+func (r *Resharder) CreateTables(ctx context.Context) error {
+	if err := r.load(); err != nil {
+		return err
+	}
+
+	dialect := r.dtx.db.Dialect()
+	for _, name := range r.NewTables() {
+		exist, err := r.dtx.db.Context(ctx).IsTableExist(name)
+		if err != nil {
+			return err
+		}
+		if exist {
+			r.Logf("reshard: %s已存在", name)
+			continue
+		}
+
+		sqls, _ := dialect.CreateTableSQL(r.meta, name)
+		for _, index := range r.meta.Indexes {
+			sqls = append(sqls, dialect.CreateIndexSQL(name, index))
+		}
+		for _, s := range sqls {
+			if _, err = r.dtx.ExecContext(ctx, s); err != nil {
+				return fmt.Errorf("%s: %s", name, err)
+			}
+		}
+		r.Logf("reshard: 已创建%s", name)
+	}
+	return r.dtx.db.Context(ctx).Sync2(new(reshardCheckpoint))
+}
+
+/*
+* 按主键顺序分批复制原分表数据到新分表，每批与进度记录在同一事务中提交，中断后再次执行从进度处继续
+*
+* param  ctx      上下文，取消时在当前批次后停止
+* param  restart  忽略已有进度，重新复制
+*
+* return 是否异常
+ */
+func (r *Resharder) Copy(ctx context.Context, restart bool) error {
+	if err := r.load(); err != nil {
+		return err
+	}
+	if err := r.dtx.db.Context(ctx).Sync2(new(reshardCheckpoint)); err != nil {
+		return err
+	}
+	if restart {
+		if _, err := r.dtx.db.Context(ctx).Where("job=?", r.job).Delete(new(reshardCheckpoint)); err != nil {
+			return err
+		}
+	}
+
+	parallel := r.Parallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+	return r.dtx.scatter(ctx, r.OldTables(), parallel, func(ctx context.Context, _ int, table string) error {
+		return r.copyTable(ctx, table)
+	})
+}
+
+//内部方法：复制一个原分表
+func (r *Resharder) copyTable(ctx context.Context, table string) error {
+	cp := &reshardCheckpoint{Job: r.job, Source: table}
+	has, err := r.dtx.db.Context(ctx).Where("job=? AND source=?", r.job, table).Get(cp)
+	if err != nil {
+		return err
+	}
+	if has && cp.Done {
+		r.Logf("reshard: %s已完成，共%d行", table, cp.Copied)
+		return nil
+	}
+	if !has {
+		if _, err = r.dtx.db.Context(ctx).Insert(cp); err != nil {
+			return err
+		}
+	}
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		//在写入的事务中加锁读取，双写的更新和删除等待本批提交后执行，避免读取后变更的数据被旧值覆盖
+		var rows []map[string]interface{}
+		err = r.dtx.Transaction(ctx, func(tx *Tx) error {
+			lastKey, err := r.keyValue(cp.LastKey)
+			if err != nil {
+				return err
+			}
+			session, done := tx.stmt()
+			rows, err = session.QueryInterface(r.batchSql(table, lastKey, r.batchSize(), true)...)
+			done()
+			if err != nil {
+				return err
+			}
+			if len(rows) > 0 {
+				cp.LastKey = keyString(rowValue(rows[len(rows)-1], r.pk.Name))
+			}
+			cp.Copied += int64(len(rows))
+			cp.Done = len(rows) < r.batchSize()
+
+			if err := r.write(tx, rows); err != nil {
+				return err
+			}
+			_, err = tx.session.ID(cp.Id).Cols("last_key", "copied", "done", "updated").Update(cp)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %s", table, err)
+		}
+
+		if cp.Done {
+			r.Logf("reshard: %s复制完成，共%d行", table, cp.Copied)
+			return nil
+		}
+		r.Logf("reshard: %s已复制%d行", table, cp.Copied)
+	}
+}
+
+//内部方法：按主键读取一批数据的SQL和参数，lock为加锁读取，需在事务中执行
+func (r *Resharder) batchSql(table string, lastKey interface{}, size int, lock bool) []interface{} {
+	quote := r.dtx.db.Quote
+	sqlOrArgs := []interface{}{""}
+	where := ""
+	if lastKey != nil {
+		where = " WHERE " + quote(r.pk.Name) + ">?"
+		sqlOrArgs = append(sqlOrArgs, lastKey)
+	}
+	if r.dtx.Driver == "mssql" {
+		hint := ""
+		if lock {
+			hint = " WITH (UPDLOCK, ROWLOCK)"
+		}
+		sqlOrArgs[0] = fmt.Sprintf("SELECT TOP %d * FROM %s%s%s ORDER BY %s", size, quote(table), hint, where, quote(r.pk.Name))
+		return sqlOrArgs
+	}
+
+	sql := fmt.Sprintf("SELECT * FROM %s%s ORDER BY %s LIMIT %d", quote(table), where, quote(r.pk.Name), size)
+	//sqlite的写事务串行执行，无需加锁
+	if lock && (r.dtx.Driver == "mysql" || r.dtx.Driver == "postgres") {
+		sql += " FOR UPDATE"
+	}
+	sqlOrArgs[0] = sql
+	return sqlOrArgs
+}
+
+//内部方法：按主键读取一批数据，不加锁
+func (r *Resharder) batch(ctx context.Context, table string, lastKey interface{}, size int) ([]map[string]interface{}, error) {
+	ctx, cancel := r.dtx.withTimeout(ctx)
+	defer cancel()
+	return r.dtx.db.Context(ctx).QueryInterface(r.batchSql(table, lastKey, size, false)...)
+}
+
+//内部方法：主键值转为进度记录中的文本，时间按RFC3339保留纳秒和时区
+func keyString(v interface{}) string {
+	v = plainValue(v)
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
+
+//内部方法：进度记录中的文本按主键的字段类型转回，空值为从头开始
+func (r *Resharder) keyValue(s string) (interface{}, error) {
+	if s == "" {
+		return nil, nil
+	}
+	switch {
+	case r.pk.SQLType.IsNumeric():
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n, nil
+		}
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("进度记录的主键%s不是数值", s)
+		}
+	case r.pk.SQLType.IsTime():
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t, nil
+		}
+	}
+	//DECIMAL及驱动以文本返回的时间保持原文本，由数据库按字段类型比较
+	return s, nil
+}
+
+//内部方法：按新规则写入新分表，先删除同主键的数据（双写或上次中断已写入的）再插入
+func (r *Resharder) write(tx *Tx, rows []map[string]interface{}) error {
+	group := make(map[string][]map[string]interface{})
+	var names []string
+	for _, row := range rows {
+		name, err := r.route(row)
+		if err != nil {
+			return err
+		}
+		if _, ok := group[name]; !ok {
+			names = append(names, name)
+		}
+		group[name] = append(group[name], row)
+	}
+
+	quote := r.dtx.db.Quote
+	cols := r.meta.ColumnsSeq()
+	quoted := make([]string, len(cols))
+	for i, c := range cols {
+		quoted[i] = quote(c)
+	}
+	for _, name := range names {
+		list := group[name]
+		keys := make([]interface{}, len(list))
+		for i, row := range list {
+			keys[i] = plainValue(rowValue(row, r.pk.Name))
+		}
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s IN (%s)", quote(name), quote(r.pk.Name), placeholders(len(keys))), keys...); err != nil {
+			return err
+		}
+
+		if r.pk.IsAutoIncrement && r.dtx.Driver == "mssql" {
+			if _, err := tx.Exec("SET IDENTITY_INSERT " + quote(name) + " ON"); err != nil {
+				return err
+			}
+		}
+		for _, row := range list {
+			args := make([]interface{}, len(cols))
+			for i, c := range cols {
+				args[i] = plainValue(rowValue(row, c))
+			}
+			sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quote(name), strings.Join(quoted, ","), placeholders(len(cols)))
+			if _, err := tx.Exec(sql, args...); err != nil {
+				return err
+			}
+		}
+		if r.pk.IsAutoIncrement && r.dtx.Driver == "mssql" {
+			if _, err := tx.Exec("SET IDENTITY_INSERT " + quote(name) + " OFF"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//内部方法：按新规则计算数据行的新分表名
+func (r *Resharder) route(row map[string]interface{}) (string, error) {
+	return shardName(r.newBase, r.conf.Reshard.Policies, func(column string) interface{} {
+		//分表字段为结构体字段名，表字段名可能经过映射
+		col := r.meta.GetColumn(column)
+		if col == nil {
+			col = r.meta.GetColumn(r.dtx.db.GetColumnMapper().Obj2Table(column))
+		}
+		if col == nil {
+			return nil
+		}
+		return normalizeValue(col, plainValue(rowValue(row, col.Name)))
+	})
+}
+
+/*
+* 校验新分表，按新规则从原分表计算各新分表的行数和校验和，与新分表实际数据比较
+* 双写期间有数据变更时结果可能不一致，应在停止写入或双写追平后校验
+*
+* param  ctx  上下文
+*
+* return 各新分表的校验结果
+ */
+func (r *Resharder) Verify(ctx context.Context) ([]ShardReport, error) {
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	reports := make(map[string]*ShardReport)
+	var mu sync.Mutex
+	for _, name := range r.NewTables() {
+		reports[name] = &ShardReport{Table: name}
+	}
+
+	parallel := r.Parallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+	err := r.dtx.scatter(ctx, r.OldTables(), parallel, func(ctx context.Context, _ int, table string) error {
+		return r.scan(ctx, table, func(row map[string]interface{}) error {
+			name, err := r.route(row)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			rep, ok := reports[name]
+			if !ok {
+				return fmt.Errorf("新分表%s不存在", name)
+			}
+			rep.ExpectedCount++
+			rep.ExpectedChecksum += r.checksum(row)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.dtx.scatter(ctx, r.NewTables(), parallel, func(ctx context.Context, _ int, table string) error {
+		return r.scan(ctx, table, func(row map[string]interface{}) error {
+			mu.Lock()
+			defer mu.Unlock()
+			rep := reports[table]
+			rep.ActualCount++
+			rep.ActualChecksum += r.checksum(row)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]ShardReport, 0, len(reports))
+	for _, name := range r.NewTables() {
+		list = append(list, *reports[name])
+	}
+	return list, nil
+}
+
+//内部方法：按主键顺序分批读取全部数据
+func (r *Resharder) scan(ctx context.Context, table string, fn func(row map[string]interface{}) error) error {
+	var lastKey interface{}
+	for {
+		rows, err := r.batch(ctx, table, lastKey, r.batchSize())
+		if err != nil {
+			return fmt.Errorf("%s: %s", table, err)
+		}
+		for _, row := range rows {
+			if err = fn(row); err != nil {
+				return err
+			}
+		}
+		if len(rows) < r.batchSize() {
+			return nil
+		}
+		lastKey = plainValue(rowValue(rows[len(rows)-1], r.pk.Name))
+	}
+}
+
+//内部方法：数据行的校验和，各行求和，与顺序无关
+func (r *Resharder) checksum(row map[string]interface{}) uint64 {
+	var b strings.Builder
+	for _, c := range r.meta.ColumnsSeq() {
+		b.WriteString(fmt.Sprint(plainValue(rowValue(row, c))))
+		b.WriteByte(0)
+	}
+	return uint64(crc32.ChecksumIEEE([]byte(b.String())))
+}
+
+/*
+* 切换分表：原分表重命名为 原表名_old_N，新分表重命名为 原表名_N
+* 切换前应停止写入，切换后将配置中的policy改为新规则并删除reshard节点
+*
+* param  ctx  上下文
+*
+* return 是否异常
+ */
+func (r *Resharder) Cutover(ctx context.Context) error {
+	var renames [][2]string
+	for _, name := range r.OldTables() {
+		renames = append(renames, [2]string{name, r.conf.TableName + "_old" + strings.TrimPrefix(name, r.conf.TableName)})
+	}
+	for _, name := range r.NewTables() {
+		renames = append(renames, [2]string{name, r.conf.TableName + strings.TrimPrefix(name, r.newBase)})
+	}
+
+	quote := r.dtx.db.Quote
+	switch r.dtx.Driver {
+	case "mysql":
+		//mysql的RENAME TABLE可原子地重命名多个表
+		items := make([]string, len(renames))
+		for i, rn := range renames {
+			items[i] = quote(rn[0]) + " TO " + quote(rn[1])
+		}
+		_, err := r.dtx.ExecContext(ctx, "RENAME TABLE "+strings.Join(items, ","))
+		return err
+	case "mssql":
+		return r.dtx.Transaction(ctx, func(tx *Tx) error {
+			for _, rn := range renames {
+				if _, err := tx.Exec("EXEC sp_rename ?, ?", rn[0], rn[1]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return r.dtx.Transaction(ctx, func(tx *Tx) error {
+		for _, rn := range renames {
+			if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s RENAME TO %s", quote(rn[0]), quote(rn[1]))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//内部方法：读取原分表结构，需要单列主键
+func (r *Resharder) load() error {
+	if r.meta != nil {
+		return nil
+	}
+	old := r.OldTables()[0]
+	tables, err := r.dtx.db.DBMetas()
+	if err != nil {
+		return err
+	}
+	for _, t := range tables {
+		if strings.EqualFold(t.Name, old) {
+			r.meta = t
+			break
+		}
+	}
+	if r.meta == nil {
+		return fmt.Errorf("原分表%s不存在", old)
+	}
+	pks := r.meta.PKColumns()
+	if len(pks) != 1 {
+		return fmt.Errorf("%s必须有单列主键", old)
+	}
+	r.pk = pks[0]
+	return nil
+}
+
+func (r *Resharder) batchSize() int {
+	if r.BatchSize <= 0 {
+		return 1000
+	}
+	return r.BatchSize
+}
+
+//内部方法：查找分表配置
+func (dtx DbContext) splitConf(tableName string) (SplitTableConf, bool) {
+	for _, c := range dtx.TableConfs {
+		if c.TableName == tableName {
+			return c, true
+		}
+	}
+	return SplitTableConf{}, false
+}
+
+//内部方法：新分表的表名前缀
+func reshardBase(c SplitTableConf) string {
+	if c.Reshard.TableName != "" {
+		return c.Reshard.TableName
+	}
+	return c.TableName + "_new"
+}
+
+//内部方法：按分表规则计算表名，value按字段名取分表字段值
+func shardName(base string, policies []Policy, value func(column string) interface{}) (string, error) {
+	name := base
+	for _, p := range policies {
+		s, err := policySuffix(p, value(p.Column))
+		if err != nil {
+			return "", err
+		}
+		name = fmt.Sprintf("%v_%s", name, s)
+	}
+	return name, nil
+}
+
+//内部方法：按分表规则列出全部表名，规则需可列出全部后缀（如count大于1）
+func shardNames(base string, policies []Policy) ([]string, error) {
+	names := []string{base}
+	for _, p := range policies {
+		suffixes, ok := policySuffixes(p)
+		if !ok {
+			return nil, fmt.Errorf("分表规则%s无法列出全部分表，迁移需要count大于1或配置date的start", p.Column)
+		}
+		var temp []string
+		for _, n := range names {
+			for _, s := range suffixes {
+				temp = append(temp, fmt.Sprintf("%v_%v", n, s))
+			}
+		}
+		names = temp
+	}
+	return names, nil
+}
+
+//内部方法：按字段类型转换查询结果（mysql文本协议返回[]byte），与实体字段计算的分表一致
+func normalizeValue(col *schemas.Column, v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	switch {
+	case col.SQLType.IsNumeric():
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case col.SQLType.IsTime():
+		for _, layout := range []string{"2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05Z07:00", "2006-01-02"} {
+			if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				return t
+			}
+		}
+	}
+	return s
+}
+
+//内部方法：n个参数占位符
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+//内部方法：双写时写操作同时执行的新分表，fullTableName为空时按entity计算，无法确定时为全部新分表
+func (dtx DbContext) mirrorTables(fullTableName string, entity interface{}) []string {
+	var conf SplitTableConf
+	found := false
+	for _, c := range dtx.TableConfs {
+		if c.Reshard == nil || !c.Reshard.DualWrite {
+			continue
+		}
+		if fullTableName == "" && dtx.db.TableName(entity) == c.TableName ||
+			fullTableName == c.TableName ||
+			strings.HasPrefix(fullTableName, c.TableName+"_") && !strings.HasPrefix(fullTableName, reshardBase(c)) {
+			conf, found = c, true
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	if fullTableName == "" {
+		v := reflect.Indirect(reflect.ValueOf(entity))
+		if v.Kind() == reflect.Struct {
+			name, err := shardName(reshardBase(conf), conf.Reshard.Policies, func(column string) interface{} {
+				return v.FieldByName(column)
+			})
+			if err == nil {
+				return []string{name}
+			}
+		}
+	}
+	names, err := shardNames(reshardBase(conf), conf.Reshard.Policies)
+	if err != nil {
+		log.Warnf("双写%s: %s", conf.TableName, err)
+	}
+	return names
+}
+
+//内部方法：是否有需要双写的分表
+func (dtx DbContext) dualWrite() bool {
+	for _, c := range dtx.TableConfs {
+		if c.Reshard != nil && c.Reshard.DualWrite {
+			return true
+		}
+	}
+	return false
+}
+
+//内部方法：双写时在新分表上插入，逐条插入以保持与原分表一致的自增主键
+func (dtx DbContext) mirrorInsert(session *xorm.Session, entities []interface{}) (int64, error) {
+	var n int64
+	for _, bean := range entities {
+		tbName, err := dtx.GetTableName(bean)
+		if err != nil {
+			return 0, errors.New("GetTableName err:" + err.Error())
+		}
+		r, err := session.Table(tbName).InsertOne(bean)
+		if err != nil {
+			return 0, errors.New("session.Insert err:" + err.Error())
+		}
+		n += r
+
+		for _, name := range dtx.mirrorTables("", bean) {
+			if dtx.Driver == "mssql" {
+				if _, err = session.Exec(fmt.Sprintf("SET IDENTITY_INSERT %s on", name)); err != nil {
+					return 0, fmt.Errorf("双写%s err:%s", name, err)
+				}
+			}
+			_, err = session.Table(name).InsertOne(bean)
+			if dtx.Driver == "mssql" {
+				if _, offErr := session.Exec(fmt.Sprintf("SET IDENTITY_INSERT %s off", name)); err == nil {
+					err = offErr
+				}
+			}
+			if err != nil {
+				return 0, fmt.Errorf("双写%s err:%s", name, err)
+			}
+		}
+	}
+	return n, nil
+}
+
+//内部方法：双写时在新分表上执行更新或删除
+func (dtx DbContext) mirrorWrite(session *xorm.Session, fullTableName string, entity interface{}, fn func(session *xorm.Session) (int64, error)) error {
+	for _, name := range dtx.mirrorTables(fullTableName, entity) {
+		if _, err := fn(session.Table(name)); err != nil {
+			return fmt.Errorf("双写%s err:%s", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package sql_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/maclon-lee/golanglib/lib/sql"
+)
+
+//以时间为主键的分表
+type reshardEvent struct {
+	At  time.Time `xorm:"pk 'At'"`
+	Seq int64     `xorm:"'Seq'"`
+	Tag string    `xorm:"varchar(16) 'Tag'"`
+}
+
+func (reshardEvent) TableName() string {
+	return "reshard_event"
+}
+
+//内部方法：按Seq从2个分表迁移到3个分表
+func newReshard(t *testing.T, rows int) (*sql.DbContext, *sql.Resharder) {
+	t.Helper()
+	confs := []sql.SplitTableConf{{
+		TableName: "reshard_event",
+		Policies:  []sql.Policy{{Column: "Seq", Count: 2, Hash: "mod"}},
+		Reshard:   &sql.ReshardConf{Policies: []sql.Policy{{Column: "Seq", Count: 3, Hash: "mod"}}},
+	}}
+	dtx := newSqlite(t, confs, reshardEvent{})
+	base := time.Date(2026, 10, 16, 12, 0, 0, 0, time.Local)
+	for i := 0; i < rows; i++ {
+		if _, err := dtx.Inserts(&reshardEvent{At: base.Add(time.Duration(i) * time.Minute), Seq: int64(i), Tag: "a"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := sql.NewResharder(dtx, "reshard_event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.BatchSize = 2
+	r.Logf = t.Logf
+	if err = r.CreateTables(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return dtx, r
+}
+
+//内部方法：校验全部新分表一致，返回总行数
+func verifyReshard(t *testing.T, r *sql.Resharder) int64 {
+	t.Helper()
+	reports, err := r.Verify(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	for _, rep := range reports {
+		if !rep.OK() {
+			t.Errorf("%s: %+v", rep.Table, rep)
+		}
+		n += rep.ActualCount
+	}
+	return n
+}
+
+//中断后按进度中的时间主键继续复制
+func TestReshardCopyResume(t *testing.T) {
+	_, r := newReshard(t, 7)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	batches := 0
+	r.Logf = func(format string, a ...interface{}) {
+		t.Logf(format, a...)
+		if batches++; batches == 1 {
+			cancel()
+		}
+	}
+	if err := r.Copy(ctx, false); err != context.Canceled {
+		t.Fatalf("Copy = %v, want canceled", err)
+	}
+
+	r.Logf = t.Logf
+	if err := r.Copy(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if n := verifyReshard(t, r); n != 7 {
+		t.Errorf("copied rows = %d, want 7", n)
+	}
+
+	//重新复制覆盖已写入的数据
+	if err := r.Copy(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+	if n := verifyReshard(t, r); n != 7 {
+		t.Errorf("rows after restart = %d, want 7", n)
+	}
+}
+
+//双写期间的写入同时进入新分表，复制不覆盖
+func TestReshardDualWrite(t *testing.T) {
+	dtx, r := newReshard(t, 4)
+	conf := dtx.TableConfs[0]
+	conf.Reshard.DualWrite = true
+
+	if err := r.Copy(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2026, 10, 16, 13, 0, 0, 0, time.Local)
+	if _, err := dtx.Inserts(&reshardEvent{At: at, Seq: 10, Tag: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := verifyReshard(t, r); n != 5 {
+		t.Errorf("rows = %d, want 5", n)
+	}
+}
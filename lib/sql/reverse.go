@@ -1,2 +1,393 @@
 /**通过数据库生成 代码**/
 package sql
+
+import (
+	"fmt"
+	"go/format"
+	"go/token"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"xorm.io/xorm/schemas"
+)
+
+//代码生成参数
+type ReverseConf struct {
+	Package    string   //生成代码的包名，默认models
+	Tables     []string //只生成指定的表（分表为配置的表名），为空时为全部
+	Repository bool     //是否生成Get/Inserts/Update/Delete仓储方法
+}
+
+//生成的表结构，分表合并为一个
+type reverseTable struct {
+	name   string   //表名，分表为配置的表名
+	shards []string //对应的分表，非分表时为空
+	meta   *schemas.Table
+	policy []Policy
+	fields []reverseField
+}
+
+type reverseField struct {
+	name   string //Go字段名
+	goType string
+	col    *schemas.Column
+}
+
+//按数字后缀识别未配置的分表，如 mysku_0、mysku_1
+var numSuffix = regexp.MustCompile(`^(.+)_\d+$`)
+
+/*
+* 按数据库表结构生成Go实体代码，nullable字段使用null.v3类型，分表按splitTables合并为一个结构
+*
+* param  conf  生成参数
+*
+* return 文件名到代码的映射，文件名为 表名.go
+ */
+func (dtx DbContext) Reverse(conf ReverseConf) (map[string][]byte, error) {
+	if conf.Package == "" {
+		conf.Package = "models"
+	}
+	metas, err := dtx.db.DBMetas()
+	if err != nil {
+		return nil, err
+	}
+
+	tables := dtx.reverseTables(metas)
+	if len(conf.Tables) > 0 {
+		want := make(map[string]bool, len(conf.Tables))
+		for _, t := range conf.Tables {
+			want[strings.ToLower(t)] = true
+		}
+		var list []*reverseTable
+		for _, t := range tables {
+			if want[strings.ToLower(t.name)] {
+				list = append(list, t)
+			}
+		}
+		tables = list
+	}
+
+	files := make(map[string][]byte, len(tables))
+	for _, t := range tables {
+		src := dtx.reverseSource(conf, t)
+		code, err := format.Source([]byte(src))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", t.name, err)
+		}
+		files[strings.ToLower(t.name)+".go"] = code
+	}
+	return files, nil
+}
+
+//内部方法：合并分表，配置了splitTables的按规则匹配，未配置的按相同结构的数字后缀识别
+func (dtx DbContext) reverseTables(metas []*schemas.Table) []*reverseTable {
+	byName := make(map[string]*reverseTable)
+	var list []*reverseTable
+	add := func(name string, meta *schemas.Table, policy []Policy) *reverseTable {
+		t, ok := byName[name]
+		if !ok {
+			t = &reverseTable{name: name, meta: meta, policy: policy}
+			byName[name] = t
+			list = append(list, t)
+		}
+		return t
+	}
+
+	var rest []*schemas.Table
+	for _, meta := range metas {
+		matched := false
+		for _, c := range dtx.TableConfs {
+			pattern := "^" + regexp.QuoteMeta(c.TableName) + strings.Repeat(`_[^_]+`, len(c.Policies)) + "$"
+			if ok, _ := regexp.MatchString(pattern, meta.Name); ok {
+				t := add(c.TableName, meta, c.Policies)
+				t.shards = append(t.shards, meta.Name)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			rest = append(rest, meta)
+		}
+	}
+
+	//未配置的分表：至少两个结构相同且不存在同名基础表
+	groups := make(map[string][]*schemas.Table)
+	exists := make(map[string]bool)
+	for _, meta := range rest {
+		exists[meta.Name] = true
+		if m := numSuffix.FindStringSubmatch(meta.Name); m != nil {
+			groups[m[1]] = append(groups[m[1]], meta)
+		}
+	}
+	for _, meta := range rest {
+		m := numSuffix.FindStringSubmatch(meta.Name)
+		if m != nil && len(groups[m[1]]) > 1 && !exists[m[1]] && sameColumns(groups[m[1]]) {
+			t := add(m[1], meta, nil)
+			t.shards = append(t.shards, meta.Name)
+			continue
+		}
+		add(meta.Name, meta, nil)
+	}
+
+	for _, t := range list {
+		sort.Slice(t.shards, func(i, j int) bool { return compareValue(t.shards[i], t.shards[j], true) < 0 })
+		t.fields = reverseFields(t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	return list
+}
+
+//内部方法：表结构的列名是否一致
+func sameColumns(metas []*schemas.Table) bool {
+	first := strings.Join(metas[0].ColumnsSeq(), ",")
+	for _, m := range metas[1:] {
+		if strings.Join(m.ColumnsSeq(), ",") != first {
+			return false
+		}
+	}
+	return true
+}
+
+//内部方法：生成字段，分表字段名与policy.column一致
+func reverseFields(t *reverseTable) []reverseField {
+	var fields []reverseField
+	used := make(map[string]bool)
+	for _, col := range t.meta.Columns() {
+		name := goName(col.Name)
+		for _, p := range t.policy {
+			if strings.EqualFold(p.Column, col.Name) || strings.EqualFold(p.Column, name) {
+				name = p.Column
+			}
+		}
+		for used[name] {
+			name += "_"
+		}
+		used[name] = true
+		fields = append(fields, reverseField{name: name, goType: goType(col), col: col})
+	}
+	return fields
+}
+
+//内部方法：列名转换为Go字段名，如 customer_id → CustomerId
+func goName(column string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range column {
+		if r == '_' || r == ' ' || r == '-' {
+			upper = true
+			continue
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	name := b.String()
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "F" + name
+	}
+	return name
+}
+
+//内部方法：列类型对应的Go类型，nullable列使用null.v3类型
+func goType(col *schemas.Column) string {
+	t := schemas.SQLType2Type(col.SQLType)
+	if strings.EqualFold(col.SQLType.Name, schemas.Bit) && col.Length <= 1 {
+		t = reflect.TypeOf(true)
+	}
+	if t.Kind() == reflect.Slice {
+		return "[]byte"
+	}
+	if !col.Nullable || col.IsPrimaryKey {
+		return t.String()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "null.Int"
+	case reflect.Float32, reflect.Float64:
+		return "null.Float"
+	case reflect.Bool:
+		return "null.Bool"
+	case reflect.String:
+		return "null.String"
+	case reflect.Struct:
+		return "null.Time"
+	}
+	return t.String()
+}
+
+//内部方法：生成一个表的代码
+func (dtx DbContext) reverseSource(conf ReverseConf, t *reverseTable) string {
+	typeName := goName(t.name)
+	pks := t.meta.PKColumns()
+
+	var imports []string
+	var body strings.Builder
+	need := func(pkg string) {
+		for _, i := range imports {
+			if i == pkg {
+				return
+			}
+		}
+		imports = append(imports, pkg)
+	}
+
+	//实体结构
+	if t.meta.Comment != "" {
+		fmt.Fprintf(&body, "// %s %s\n", typeName, t.meta.Comment)
+	} else {
+		fmt.Fprintf(&body, "// %s 对应表 %s\n", typeName, t.name)
+	}
+	if len(t.shards) > 0 {
+		fmt.Fprintf(&body, "// 分表: %s\n", strings.Join(t.shards, ", "))
+		if len(t.policy) == 0 {
+			body.WriteString("// 未在dbs.db.splitTables中配置分表规则，按分表访问前需补充配置\n")
+		}
+	}
+	fmt.Fprintf(&body, "type %s struct {\n", typeName)
+	for _, f := range t.fields {
+		if strings.HasPrefix(f.goType, "null.") {
+			need(`"gopkg.in/guregu/null.v3"`)
+		} else if f.goType == "time.Time" {
+			need(`"time"`)
+		}
+		tag := []string{"'" + f.col.Name + "'"}
+		if f.col.IsPrimaryKey {
+			tag = append(tag, "pk")
+		}
+		if f.col.IsAutoIncrement {
+			tag = append(tag, "autoincr")
+		}
+		fmt.Fprintf(&body, "\t%s %s `xorm:\"%s\" json:\"%s\"`", f.name, f.goType, strings.Join(tag, " "), jsonName(f.name))
+		if f.col.Comment != "" {
+			fmt.Fprintf(&body, " // %s", strings.Replace(f.col.Comment, "\n", " ", -1))
+		}
+		body.WriteString("\n")
+	}
+	body.WriteString("}\n\n")
+
+	//分表时返回配置的表名，由DbContext按分表规则计算实际表名
+	fmt.Fprintf(&body, "func (%s) TableName() string {\n\treturn %q\n}\n", typeName, t.name)
+
+	if conf.Repository {
+		need(`"context"`)
+		need(`"github.com/maclon-lee/golanglib/lib/sql"`)
+		dtx.reverseRepository(&body, t, typeName, pks, need)
+	}
+
+	var src strings.Builder
+	src.WriteString("// Code generated by golanglib sql reverse. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&src, "package %s\n\n", conf.Package)
+	if len(imports) > 0 {
+		sort.Strings(imports)
+		fmt.Fprintf(&src, "import (\n\t%s\n)\n\n", strings.Join(imports, "\n\t"))
+	}
+	src.WriteString(body.String())
+	return src.String()
+}
+
+//内部方法：生成仓储方法，单列主键时生成Get/Update/Delete，分表字段作为参数
+func (dtx DbContext) reverseRepository(body *strings.Builder, t *reverseTable, typeName string, pks []*schemas.Column, need func(pkg string)) {
+	repo := typeName + "Repo"
+	fmt.Fprintf(body, "\n// %s %s的仓储方法\ntype %s struct {\n\tdtx *sql.DbContext\n}\n\n", repo, typeName, repo)
+	fmt.Fprintf(body, "func New%s(dtx *sql.DbContext) *%s {\n\treturn &%s{dtx: dtx}\n}\n\n", repo, repo, repo)
+
+	fmt.Fprintf(body, "// Inserts 插入数据，分表按分表字段路由\nfunc (r *%s) Inserts(ctx context.Context, entities ...*%s) (int64, error) {\n", repo, typeName)
+	body.WriteString("\tlist := make([]interface{}, len(entities))\n\tfor i, e := range entities {\n\t\tlist[i] = e\n\t}\n")
+	body.WriteString("\treturn r.dtx.InsertsContext(ctx, list...)\n}\n")
+
+	if len(pks) != 1 {
+		body.WriteString("\n// 非单列主键，未生成Get/Update/Delete\n")
+		return
+	}
+	var pk reverseField
+	for _, f := range t.fields {
+		if f.col == pks[0] {
+			pk = f
+		}
+	}
+
+	//分表字段作为参数，用于计算表名
+	params := []string{"ctx context.Context", paramName(pk.name) + " " + pk.goType}
+	inits := []string{pk.name + ": " + paramName(pk.name)}
+	for _, p := range t.policy {
+		for _, f := range t.fields {
+			if f.name == p.Column && f.col != pk.col {
+				params = append(params, paramName(f.name)+" "+f.goType)
+				inits = append(inits, f.name+": "+paramName(f.name))
+			}
+		}
+	}
+	zero := zeroCheck(pk)
+	if zero != "" {
+		need(`"errors"`)
+	}
+
+	fmt.Fprintf(body, "\n// Get 按主键查询，不存在时返回nil\nfunc (r *%s) Get(%s) (*%s, error) {\n", repo, strings.Join(params, ", "), typeName)
+	fmt.Fprintf(body, "\tentity := &%s{%s}\n", typeName, strings.Join(inits, ", "))
+	fmt.Fprintf(body, "\tvar list []%s\n", typeName)
+	fmt.Fprintf(body, "\ttable, err := r.dtx.GetTableName(entity)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+	fmt.Fprintf(body, "\tif err = r.dtx.QueryContext(ctx, &list, \"SELECT * FROM \"+table+%q, entity.%s); err != nil || len(list) == 0 {\n\t\treturn nil, err\n\t}\n", " WHERE "+dtx.db.Quote(pk.col.Name)+"=?", pk.name)
+	body.WriteString("\treturn &list[0], nil\n}\n")
+
+	fmt.Fprintf(body, "\n// Update 按主键更新非零值字段\nfunc (r *%s) Update(ctx context.Context, entity *%s) (int64, error) {\n", repo, typeName)
+	if zero != "" {
+		fmt.Fprintf(body, "\tif %s {\n\t\treturn 0, errors.New(\"%s不能为空\")\n\t}\n", fmt.Sprintf(zero, "entity."+pk.name), pk.name)
+	}
+	fmt.Fprintf(body, "\treturn r.dtx.UpdateContext(ctx, \"\", entity, map[string]interface{}{%q: entity.%s})\n}\n", pk.col.Name, pk.name)
+
+	fmt.Fprintf(body, "\n// Delete 按主键删除\nfunc (r *%s) Delete(%s) (int64, error) {\n", repo, strings.Join(params, ", "))
+	if zero != "" {
+		fmt.Fprintf(body, "\tif %s {\n\t\treturn 0, errors.New(\"%s不能为空\")\n\t}\n", fmt.Sprintf(zero, paramName(pk.name)), pk.name)
+	}
+	fmt.Fprintf(body, "\treturn r.dtx.DeleteContext(ctx, \"\", &%s{%s})\n}\n", typeName, strings.Join(inits, ", "))
+}
+
+//内部方法：主键为空的判断表达式，%s为变量名，无法判断时为空
+func zeroCheck(f reverseField) string {
+	switch f.goType {
+	case "string":
+		return `%s == ""`
+	case "[]byte":
+		return `len(%s) == 0`
+	case "time.Time":
+		return `%s.IsZero()`
+	case "int", "int64", "float32", "float64":
+		return `%s == 0`
+	}
+	return ""
+}
+
+//内部方法：参数名，避开关键字和生成代码中的变量名
+func paramName(name string) string {
+	p := lowerFirst(strings.TrimRight(name, "_"))
+	switch p {
+	case "ctx", "r", "entity", "list", "table", "err", "errors", "sql", "context", "null", "time":
+		return p + "_"
+	}
+	if token.IsKeyword(p) {
+		return p + "_"
+	}
+	return p
+}
+
+//内部方法：json字段名，首字母小写
+func jsonName(name string) string {
+	return lowerFirst(strings.TrimRight(name, "_"))
+}
+
+//内部方法：首字母小写，全大写的缩写整体小写，如 ID → id
+func lowerFirst(name string) string {
+	if strings.ToUpper(name) == name {
+		return strings.ToLower(name)
+	}
+	r := []rune(name)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
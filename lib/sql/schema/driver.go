@@ -0,0 +1,54 @@
+package schema
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/maclon-lee/golanglib/lib/config"
+	"sort"
+	"sync"
+)
+
+//可用的数据库驱动名称，sqlite、clickhouse在引入对应子包后注册，配置校验时不引入也视为有效
+var driverLock sync.RWMutex
+var drivers = map[string]bool{
+	"mysql":      true,
+	"mssql":      true,
+	"postgres":   true,
+	"sqlite":     true,
+	"clickhouse": true,
+}
+
+/*
+* 添加数据库驱动名称，dbs.db.driver校验时视为有效，sql.RegisterDriver注册驱动时调用
+*
+* param  name  驱动名称
+ */
+func RegisterDriver(name string) {
+	driverLock.Lock()
+	drivers[name] = true
+	driverLock.Unlock()
+}
+
+//可用的数据库驱动名称，按名称排序
+func Drivers() []string {
+	driverLock.RLock()
+	defer driverLock.RUnlock()
+	list := make([]string, 0, len(drivers))
+	for name := range drivers {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+//内部方法：dbdriver校验规则，值须为可用的驱动名称
+func validDriver(fl validator.FieldLevel) bool {
+	driverLock.RLock()
+	defer driverLock.RUnlock()
+	return drivers[fl.Field().String()]
+}
+
+func init() {
+	if err := config.RegisterValidation("dbdriver", validDriver); err != nil {
+		panic(err)
+	}
+}
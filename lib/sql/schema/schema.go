@@ -0,0 +1,66 @@
+//数据库配置节点（dbs）结构，lib/sql按此结构读取配置，不建立连接，可单独引入用于配置校验
+package schema
+
+import "github.com/maclon-lee/golanglib/lib/config"
+
+//数据库配置结构（config.toml中的dbs节点）
+type Conf struct {
+	Mysql      Pool `mapstructure:"mysql"`
+	Mssql      Pool `mapstructure:"mssql"`
+	Postgres   Pool `mapstructure:"postgres"`
+	Sqlite     Pool `mapstructure:"sqlite"`
+	Clickhouse Pool `mapstructure:"clickhouse"`
+	Db         []Db `mapstructure:"db" validate:"required,dive"`
+}
+
+//连接池配置（dbs.<driver>）
+type Pool struct {
+	MaxLifetime int `mapstructure:"maxLifetime" validate:"min=0"` //连接最长使用时间，单位：秒
+	MaxIdle     int `mapstructure:"maxIdle" validate:"min=0"`
+	MaxOpen     int `mapstructure:"maxOpen" validate:"min=0"`
+	Timeout     int `mapstructure:"timeout" validate:"min=0"`   //默认语句超时，单位：毫秒
+	SlowQuery   int `mapstructure:"slowQuery" validate:"min=0"` //慢查询日志阈值，单位：毫秒
+}
+
+//数据库连接配置（dbs.db），lib/sql的DbContext嵌入此结构
+type Db struct {
+	TableConfs     []SplitTable `mapstructure:"splitTables" validate:"dive"`
+	Name           string       `mapstructure:"name" validate:"required"`
+	Driver         string       `mapstructure:"driver" validate:"required,dbdriver"` //mysql、mssql、postgres，引入lib/sql/sqlite、lib/sql/clickhouse后可用sqlite、clickhouse，或RegisterDriver注册的名称
+	ConnectString  string       `mapstructure:"str" validate:"required"`
+	Timeout        int          `mapstructure:"timeout" validate:"min=0"`                              //默认语句超时，单位：毫秒，0时取dbs.<driver>.timeout
+	Replicas       []string     `mapstructure:"replicas"`                                              //只读副本连接字符串，Query/Get使用副本，写操作和事务使用主库
+	Balance        string       `mapstructure:"balance" validate:"omitempty,oneof=roundrobin latency"` //副本选择方式：roundrobin（默认）、latency（延迟最低）
+	MaxLag         int          `mapstructure:"maxLag" validate:"min=0"`                               //副本复制延迟上限，超过时暂停使用，单位：毫秒，0为不限
+	HealthInterval int          `mapstructure:"healthInterval" validate:"min=0"`                       //副本健康检查间隔，单位：毫秒，默认5000
+	SlowQuery      int          `mapstructure:"slowQuery" validate:"min=0"`                            //慢查询日志阈值，单位：毫秒，0时取dbs.<driver>.slowQuery
+}
+
+//分表配置（dbs.db.splitTables）
+type SplitTable struct {
+	TableName string   `mapstructure:"tableName" validate:"required"`
+	Policies  []Policy `mapstructure:"policy" validate:"required,dive"`
+	Reshard   *Reshard `mapstructure:"reshard"` //分表迁移，迁移期间可开启双写
+}
+
+//分表规则
+type Policy struct {
+	Column string  `mapstructure:"column" validate:"required"`
+	Count  int     `mapstructure:"count" validate:"min=0"`
+	Hash   string  `mapstructure:"hash"`                  //分表策略：crc32、murmur3、mod、range、date，为空时兼容原有的GetHashcode取余
+	Step   int64   `mapstructure:"step" validate:"min=0"` //range：按step等宽分段
+	Ranges []int64 `mapstructure:"ranges"`                //range：分段的分界值，升序
+	Format string  `mapstructure:"format"`                //date：后缀的时间格式，默认200601（按月）
+	Start  string  `mapstructure:"start"`                 //date：最早的分表时间，如2026-01，用于列出全部分表
+}
+
+//分表迁移配置（dbs.db.splitTables.reshard）
+type Reshard struct {
+	TableName string   `mapstructure:"tableName"`                       //新分表的表名前缀，默认为 原表名_new
+	Policies  []Policy `mapstructure:"policy" validate:"required,dive"` //新分表规则
+	DualWrite bool     `mapstructure:"dualWrite"`                       //双写：写入原分表的同时写入新分表
+}
+
+func init() {
+	config.RegisterSection("dbs", Conf{}, false)
+}
@@ -0,0 +1,511 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"xorm.io/builder"
+	"xorm.io/xorm/schemas"
+)
+
+//查询条件，可使用xorm.io/builder的Eq、Neq、Like、In、Between等构造，字段名不做映射
+type Cond = builder.Cond
+
+//SQL条件表达式，如 Expr("Status=? OR Amount>?", 1, 100)
+func Expr(sql string, args ...interface{}) Cond { return builder.Expr(sql, args...) }
+
+//条件全部满足
+func And(conds ...Cond) Cond { return builder.And(conds...) }
+
+//条件任一满足
+func Or(conds ...Cond) Cond { return builder.Or(conds...) }
+
+//查询构造器，Build时按数据库驱动生成SQL
+type SelectBuilder struct {
+	cols    []string
+	from    interface{}
+	alias   string
+	joins   []selectJoin
+	conds   []selectCond
+	groupBy []string
+	having  []selectCond
+	orderBy []string
+	limit   int
+	offset  int
+}
+
+type selectJoin struct {
+	op    string
+	table interface{}
+	on    string
+	args  []interface{}
+}
+
+type selectCond struct {
+	or    bool
+	in    string //IN条件的字段名
+	query interface{}
+	args  []interface{}
+}
+
+//字段名映射：结构体字段名按xorm标签映射为表字段名，有连接时加表名或别名前缀
+type columnResolver struct {
+	table  *schemas.Table
+	prefix string
+	quote  func(string) string
+}
+
+/*
+* 构建查询，用法：Select("ID", "Name").From(&Entity{}).Where("Status=?", 1).Or("VIP=?", true).OrderBy("ID DESC").Page(1, 20)
+*
+* param  cols  查询字段，可为结构体字段名（按xorm标签映射为表字段名）、表字段名或表达式，为空时查询实体的全部字段
+*
+* return 查询构造器
+ */
+func Select(cols ...string) *SelectBuilder {
+	return &SelectBuilder{cols: cols}
+}
+
+/*
+* 查询的表
+*
+* param  table  数据对象（按分表规则取表名，软删除的实体追加未删除条件）或表名（原样使用）
+* param  alias  表别名
+ */
+func (b *SelectBuilder) From(table interface{}, alias ...string) *SelectBuilder {
+	b.from = table
+	if len(alias) > 0 {
+		b.alias = alias[0]
+	}
+	return b
+}
+
+/*
+* 连接查询，有连接时From实体的字段名映射为 别名.字段名
+*
+* param  op     连接类型：INNER、LEFT、RIGHT
+* param  table  数据对象或表名（原样使用，可带别名，如 customer c）
+* param  on     连接条件
+* param  args   连接条件的参数
+ */
+func (b *SelectBuilder) Join(op string, table interface{}, on string, args ...interface{}) *SelectBuilder {
+	b.joins = append(b.joins, selectJoin{op: strings.ToUpper(op), table: table, on: on, args: args})
+	return b
+}
+
+//左连接查询
+func (b *SelectBuilder) LeftJoin(table interface{}, on string, args ...interface{}) *SelectBuilder {
+	return b.Join("LEFT", table, on, args...)
+}
+
+/*
+* AND条件
+*
+* param  query  条件：SQL语句（如 Status=?）、Cond、*Where或*ShardWhere
+* param  args   SQL语句的参数
+ */
+func (b *SelectBuilder) Where(query interface{}, args ...interface{}) *SelectBuilder {
+	b.conds = append(b.conds, selectCond{query: query, args: args})
+	return b
+}
+
+//AND条件，同Where
+func (b *SelectBuilder) And(query interface{}, args ...interface{}) *SelectBuilder {
+	return b.Where(query, args...)
+}
+
+//cond为true时追加AND条件
+func (b *SelectBuilder) WhereIf(cond bool, query interface{}, args ...interface{}) *SelectBuilder {
+	if cond {
+		b.Where(query, args...)
+	}
+	return b
+}
+
+//OR条件，与之前的全部条件组成 (之前的条件) OR (query)
+func (b *SelectBuilder) Or(query interface{}, args ...interface{}) *SelectBuilder {
+	b.conds = append(b.conds, selectCond{or: true, query: query, args: args})
+	return b
+}
+
+//cond为true时追加OR条件
+func (b *SelectBuilder) OrIf(cond bool, query interface{}, args ...interface{}) *SelectBuilder {
+	if cond {
+		b.Or(query, args...)
+	}
+	return b
+}
+
+//IN条件，字段名同Select，values为单个切片时展开，为空时条件不成立
+func (b *SelectBuilder) In(col string, values ...interface{}) *SelectBuilder {
+	b.conds = append(b.conds, selectCond{in: col, args: flattenArgs(values)})
+	return b
+}
+
+//分组字段，字段名同Select
+func (b *SelectBuilder) GroupBy(cols ...string) *SelectBuilder {
+	b.groupBy = append(b.groupBy, cols...)
+	return b
+}
+
+//分组条件，多次调用为AND
+func (b *SelectBuilder) Having(query interface{}, args ...interface{}) *SelectBuilder {
+	b.having = append(b.having, selectCond{query: query, args: args})
+	return b
+}
+
+//排序，如 OrderBy("CreateTime DESC", "ID")，字段名同Select
+func (b *SelectBuilder) OrderBy(orders ...string) *SelectBuilder {
+	for _, o := range orders {
+		for _, s := range strings.Split(o, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				b.orderBy = append(b.orderBy, s)
+			}
+		}
+	}
+	return b
+}
+
+//条数和偏移，limit为0时不限条数
+func (b *SelectBuilder) Limit(limit int, offset ...int) *SelectBuilder {
+	b.limit = limit
+	if len(offset) > 0 {
+		b.offset = offset[0]
+	}
+	return b
+}
+
+//分页，page从1开始
+func (b *SelectBuilder) Page(page, size int) *SelectBuilder {
+	if page < 1 {
+		page = 1
+	}
+	return b.Limit(size, (page-1)*size)
+}
+
+/*
+* 生成查询SQL
+* mysql/postgres/sqlite: LIMIT n OFFSET m
+* mssql: OFFSET m ROWS FETCH NEXT n ROWS ONLY，无排序时按 ORDER BY (SELECT NULL)
+*
+* param  dtx  数据库上下文，用于取表名、字段映射和数据库驱动
+*
+* return SQL语句、SQL参数
+ */
+func (b *SelectBuilder) Build(dtx DbContext) (string, []interface{}, error) {
+	return b.build(dtx, false)
+}
+
+//生成统计总数的SQL，不含排序和分页
+func (b *SelectBuilder) BuildCount(dtx DbContext) (string, []interface{}, error) {
+	return b.build(dtx, true)
+}
+
+//内部方法：生成SQL
+func (b *SelectBuilder) build(dtx DbContext, count bool) (string, []interface{}, error) {
+	if b.from == nil {
+		return "", nil, errors.New("查询未指定From")
+	}
+	quote := dtx.db.Quote
+
+	r := columnResolver{quote: quote}
+	from, ok := b.from.(string)
+	if !ok {
+		name, err := dtx.GetTableName(b.from)
+		if err != nil {
+			return "", nil, err
+		}
+		if r.table, err = dtx.db.TableInfo(b.from); err != nil {
+			return "", nil, err
+		}
+		from = quote(name)
+		if len(b.joins) > 0 {
+			r.prefix = from + "."
+			if b.alias != "" {
+				r.prefix = b.alias + "."
+			}
+		}
+	}
+	if b.alias != "" {
+		from += " " + b.alias
+	}
+
+	var args []interface{}
+	var sql strings.Builder
+	sql.WriteString(" FROM ")
+	sql.WriteString(from)
+	for _, j := range b.joins {
+		table, ok := j.table.(string)
+		if !ok {
+			name, err := dtx.GetTableName(j.table)
+			if err != nil {
+				return "", nil, err
+			}
+			table = quote(name)
+		}
+		fmt.Fprintf(&sql, " %s JOIN %s ON %s", j.op, table, j.on)
+		args = append(args, j.args...)
+	}
+
+	cond, err := r.cond(b.conds)
+	if err != nil {
+		return "", nil, err
+	}
+	col, err := dtx.deletedColumn(b.from)
+	if err != nil {
+		return "", nil, err
+	}
+	if col != nil {
+		if nd := dtx.notDeleted(col); nd != "" {
+			cond = builder.And(cond, builder.Expr(strings.Replace(nd, quote(col.Name), r.prefix+quote(col.Name), -1)))
+		}
+	}
+	if cond.IsValid() {
+		where, whereArgs, err := builder.ToSQL(cond)
+		if err != nil {
+			return "", nil, err
+		}
+		sql.WriteString(" WHERE ")
+		sql.WriteString(where)
+		args = append(args, whereArgs...)
+	}
+
+	if len(b.groupBy) > 0 {
+		sql.WriteString(" GROUP BY ")
+		sql.WriteString(r.columns(b.groupBy))
+	}
+	having, err := r.cond(b.having)
+	if err != nil {
+		return "", nil, err
+	}
+	if having.IsValid() {
+		h, havingArgs, err := builder.ToSQL(having)
+		if err != nil {
+			return "", nil, err
+		}
+		sql.WriteString(" HAVING ")
+		sql.WriteString(h)
+		args = append(args, havingArgs...)
+	}
+
+	if count {
+		if len(b.groupBy) > 0 {
+			return "SELECT COUNT(*) FROM (SELECT 1 AS n" + sql.String() + ") t", args, nil
+		}
+		return "SELECT COUNT(*)" + sql.String(), args, nil
+	}
+
+	if len(b.orderBy) > 0 {
+		orders := make([]string, len(b.orderBy))
+		for i, o := range b.orderBy {
+			orders[i] = r.order(o)
+		}
+		sql.WriteString(" ORDER BY ")
+		sql.WriteString(strings.Join(orders, ","))
+	}
+	sql.WriteString(dtx.pageSql(b.limit, b.offset, len(b.orderBy) > 0))
+
+	return "SELECT " + r.selectColumns(b.cols) + sql.String(), args, nil
+}
+
+//内部方法：分页语句，mssql的OFFSET FETCH必须有ORDER BY
+func (dtx DbContext) pageSql(limit, offset int, ordered bool) string {
+	if limit <= 0 && offset <= 0 {
+		return ""
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	switch dtx.Driver {
+	case "mssql":
+		s := fmt.Sprintf(" OFFSET %d ROWS", offset)
+		if !ordered {
+			s = " ORDER BY (SELECT NULL)" + s
+		}
+		if limit > 0 {
+			s += fmt.Sprintf(" FETCH NEXT %d ROWS ONLY", limit)
+		}
+		return s
+	case "mysql":
+		//mysql的OFFSET必须有LIMIT
+		if limit <= 0 {
+			return fmt.Sprintf(" LIMIT %d,18446744073709551615", offset)
+		}
+	case "sqlite":
+		if limit <= 0 {
+			limit = -1
+		}
+	}
+
+	var s string
+	if limit != 0 {
+		s = fmt.Sprintf(" LIMIT %d", limit)
+	}
+	if offset > 0 {
+		s += fmt.Sprintf(" OFFSET %d", offset)
+	}
+	return s
+}
+
+//内部方法：映射字段名，非实体字段、表达式和带前缀的字段原样返回
+func (r columnResolver) column(name string) string {
+	name = strings.TrimSpace(name)
+	if r.table == nil || strings.ContainsAny(name, " .()*`\"[") {
+		return name
+	}
+	for _, col := range r.table.Columns() {
+		if col.FieldName[strings.LastIndex(col.FieldName, ".")+1:] == name || strings.EqualFold(col.Name, name) {
+			return r.prefix + r.quote(col.Name)
+		}
+	}
+	return name
+}
+
+//内部方法：映射字段名列表
+func (r columnResolver) columns(names []string) string {
+	cols := make([]string, len(names))
+	for i, name := range names {
+		cols[i] = r.column(name)
+	}
+	return strings.Join(cols, ",")
+}
+
+//内部方法：查询字段，为空时为实体的全部字段（不含只写字段），表名查询为*
+func (r columnResolver) selectColumns(names []string) string {
+	if len(names) > 0 {
+		return r.columns(names)
+	}
+	if r.table == nil {
+		return "*"
+	}
+	var cols []string
+	for _, col := range r.table.Columns() {
+		if col.MapType != schemas.ONLYTODB {
+			cols = append(cols, r.prefix+r.quote(col.Name))
+		}
+	}
+	return strings.Join(cols, ",")
+}
+
+//内部方法：映射排序项的字段名，如 CreateTime DESC
+func (r columnResolver) order(s string) string {
+	if i := strings.IndexAny(s, " \t"); i > 0 {
+		return r.column(s[:i]) + s[i:]
+	}
+	return r.column(s)
+}
+
+//内部方法：按顺序组合条件
+func (r columnResolver) cond(conds []selectCond) (Cond, error) {
+	result := builder.NewCond()
+	for _, sc := range conds {
+		var c Cond
+		if sc.in != "" {
+			c = builder.In(r.column(sc.in), sc.args...)
+		} else {
+			switch q := sc.query.(type) {
+			case string:
+				c = builder.Expr(q, sc.args...)
+			case Cond:
+				c = q
+			case *Where:
+				c = whereCond(q.Build())
+			case *ShardWhere:
+				c = builder.Expr(q.Condition())
+			default:
+				return nil, fmt.Errorf("不支持的查询条件类型:%T", sc.query)
+			}
+		}
+		if !result.IsValid() {
+			result = c
+		} else if sc.or {
+			result = builder.Or(result, c)
+		} else {
+			result = builder.And(result, c)
+		}
+	}
+	return result, nil
+}
+
+//内部方法：Where.Build()的结果转为条件，去掉WHERE
+func whereCond(sql string, args []interface{}) Cond {
+	sql = strings.TrimSpace(sql)
+	if len(sql) >= 5 && strings.EqualFold(sql[:5], "WHERE") {
+		sql = strings.TrimSpace(sql[5:])
+	}
+	if sql == "" {
+		return builder.NewCond()
+	}
+	return builder.Expr(sql, args...)
+}
+
+/*
+* 按查询构造器查询
+*
+* param  rowsSlicePtr  返回记录行数据对象，支持[]struct, []map[string]interface{}类型
+* param  b             查询构造器
+*
+* return 是否异常
+ */
+func (dtx DbContext) Find(rowsSlicePtr interface{}, b *SelectBuilder) error {
+	return dtx.FindContext(context.Background(), rowsSlicePtr, b)
+}
+
+//按查询构造器查询，ctx取消或超时时中止查询
+func (dtx DbContext) FindContext(ctx context.Context, rowsSlicePtr interface{}, b *SelectBuilder) error {
+	sql, args, err := b.Build(dtx)
+	if err != nil {
+		return err
+	}
+	return dtx.QueryContext(ctx, rowsSlicePtr, sql, args...)
+}
+
+/*
+* 按查询构造器统计总数，忽略排序和分页，用于分页查询的总数
+*
+* param  b  查询构造器
+*
+* return 总数
+ */
+func (dtx DbContext) Count(b *SelectBuilder) (int64, error) {
+	return dtx.CountContext(context.Background(), b)
+}
+
+//按查询构造器统计总数，ctx取消或超时时中止查询
+func (dtx DbContext) CountContext(ctx context.Context, b *SelectBuilder) (int64, error) {
+	sql, args, err := b.BuildCount(dtx)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := dtx.withTimeout(ctx)
+	defer cancel()
+
+	db, fail := dtx.reader()
+	var n int64
+	_, err = db.Context(ctx).SQL(sql, args...).Get(&n)
+	fail(err)
+	return n, err
+}
+
+//按查询构造器查询
+func (tx *Tx) Find(rowsSlicePtr interface{}, b *SelectBuilder) error {
+	sql, args, err := b.Build(tx.dtx)
+	if err != nil {
+		return err
+	}
+	return tx.Query(rowsSlicePtr, sql, args...)
+}
+
+//按查询构造器统计总数
+func (tx *Tx) Count(b *SelectBuilder) (int64, error) {
+	sql, args, err := b.BuildCount(tx.dtx)
+	if err != nil {
+		return 0, err
+	}
+	session, done := tx.stmt()
+	defer done()
+	var n int64
+	_, err = session.SQL(sql, args...).Get(&n)
+	return n, err
+}
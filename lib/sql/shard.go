@@ -0,0 +1,749 @@
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"xorm.io/xorm"
+	"xorm.io/xorm/schemas"
+)
+
+//跨分表查询中表名的占位符
+const TablePlaceholder = "{table}"
+
+//跨分表查询参数
+type ShardQuery struct {
+	Sql      string        //SQL语句，表名使用{table}占位，为空时为 SELECT * FROM {table} + Where（软删除的实体追加未删除条件）
+	Where    string        //条件语句，如Where.Build()返回的 WHERE ...，用于Sql为空时及聚合查询
+	Args     []interface{} //SQL参数
+	Tables   []string      //查询的物理表，为空时查询entity的全部分表
+	Parallel int           //并发数，默认8
+	OrderBy  string        //全局排序，如 CreateTime DESC,ID；设置时Sql中不能包含ORDER BY、LIMIT
+	Offset   int           //全局偏移
+	Limit    int           //全局条数，0为不限
+	GroupBy  []string      //聚合查询的分组字段
+}
+
+//聚合函数
+type Aggregate struct {
+	Func   string //COUNT、SUM、MIN、MAX、AVG
+	Column string //字段名，COUNT可为*
+	Alias  string //结果中的键名，默认为 函数_字段，如 sum_Amount、count
+}
+
+func Count(column string) Aggregate { return Aggregate{Func: "COUNT", Column: column} }
+func Sum(column string) Aggregate   { return Aggregate{Func: "SUM", Column: column} }
+func Min(column string) Aggregate   { return Aggregate{Func: "MIN", Column: column} }
+func Max(column string) Aggregate   { return Aggregate{Func: "MAX", Column: column} }
+func Avg(column string) Aggregate   { return Aggregate{Func: "AVG", Column: column} }
+
+//设置结果键名
+func (a Aggregate) As(alias string) Aggregate {
+	a.Alias = alias
+	return a
+}
+
+//结果键名
+func (a Aggregate) name() string {
+	if a.Alias != "" {
+		return a.Alias
+	}
+	if a.Column == "" || a.Column == "*" {
+		return strings.ToLower(a.Func)
+	}
+	return strings.ToLower(a.Func) + "_" + a.Column
+}
+
+//排序字段
+type orderField struct {
+	column string
+	desc   bool
+}
+
+/*
+* 跨分表查询，在各分表上并发执行同一SQL，合并结果后按全局排序和分页返回
+*
+* param  ctx           上下文，取消时中止全部分表查询
+* param  rowsSlicePtr  返回记录行数据对象, 支持[]struct, []map[string]interface{}类型
+* param  entity        数据对象，用于获取分表列表，q.Tables不为空时可传nil
+* param  q             查询参数，如 ShardQuery{Sql: "select * from {table} where Status=?", Args: []interface{}{1}, OrderBy: "ID desc", Limit: 20}
+*
+* return 是否异常
+ */
+func (dtx DbContext) QueryShards(ctx context.Context, rowsSlicePtr interface{}, entity interface{}, q ShardQuery) error {
+	sliceValue := reflect.ValueOf(rowsSlicePtr)
+	if sliceValue.Kind() != reflect.Ptr || sliceValue.Elem().Kind() != reflect.Slice {
+		return errors.New("rowsSlicePtr必须为切片指针")
+	}
+	sliceValue = sliceValue.Elem()
+
+	tables, err := dtx.shardTables(entity, q.Tables)
+	if err != nil {
+		return err
+	}
+	orders := parseOrderBy(q.OrderBy)
+
+	//自定义Sql时不追加软删除条件
+	sqlStr := q.Sql
+	if sqlStr == "" {
+		where, err := dtx.scopeWhere(q.Where, entity)
+		if err != nil {
+			return err
+		}
+		sqlStr = "SELECT * FROM " + TablePlaceholder + where
+	}
+	sqlStr += dtx.shardLimit(q.OrderBy, q.Offset, q.Limit)
+
+	//map记录按查询结果的字段类型判断是否按数值排序，struct记录按字段的Go类型
+	isMap := reflect.TypeOf(map[string]interface{}{}).ConvertibleTo(sliceValue.Type().Elem())
+	results := make([]reflect.Value, len(tables))
+	numerics := make([]map[string]bool, len(tables))
+	err = dtx.scatter(ctx, tables, q.Parallel, func(ctx context.Context, i int, table string) error {
+		rows := reflect.New(sliceValue.Type())
+		db, fail := dtx.reader()
+		var err error
+		if isMap {
+			var list []map[string]interface{}
+			list, numerics[i], err = queryMaps(ctx, db, strings.Replace(sqlStr, TablePlaceholder, table, -1), q.Args)
+			if err == nil {
+				for _, m := range list {
+					rows.Elem().Set(reflect.Append(rows.Elem(), reflect.ValueOf(m).Convert(sliceValue.Type().Elem())))
+				}
+			}
+		} else {
+			err = db.Context(ctx).SQL(strings.Replace(sqlStr, TablePlaceholder, table, -1), q.Args...).Find(rows.Interface())
+		}
+		fail(err)
+		if err != nil {
+			return fmt.Errorf("%s: %s", table, err)
+		}
+		results[i] = rows.Elem()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	merged := reflect.MakeSlice(sliceValue.Type(), 0, 0)
+	for _, rows := range results {
+		merged = reflect.AppendSlice(merged, rows)
+	}
+
+	if len(orders) > 0 {
+		getter, err := dtx.columnGetter(sliceValue.Type().Elem())
+		if err != nil {
+			return err
+		}
+		numeric := mergeNumeric(numerics)
+		sort.SliceStable(merged.Interface(), func(i, j int) bool {
+			return lessRow(getter, merged.Index(i), merged.Index(j), orders, numeric)
+		})
+	}
+
+	start, end := pageRange(merged.Len(), q.Offset, q.Limit)
+	sliceValue.Set(merged.Slice(start, end))
+	return nil
+}
+
+/*
+* 跨分表聚合查询，各分表分别聚合后合并，AVG按各分表的SUM和COUNT计算
+*
+* param  ctx     上下文，取消时中止全部分表查询
+* param  entity  数据对象，用于获取分表列表，q.Tables不为空时可传nil
+* param  q       查询参数，使用Where、Args、Tables、GroupBy、OrderBy、Offset、Limit
+* param  aggs    聚合函数，如 sql.Count("*"), sql.Sum("Amount").As("total")
+*
+* return 聚合结果，每个分组一行，键为分组字段和聚合结果键名；COUNT为int64，SUM整数为int64、小数为float64，AVG为float64，MIN、MAX为原值；全部分表为NULL时SUM、AVG、MIN、MAX为nil
+ */
+func (dtx DbContext) AggregateShards(ctx context.Context, entity interface{}, q ShardQuery, aggs ...Aggregate) ([]map[string]interface{}, error) {
+	if len(aggs) == 0 {
+		return nil, errors.New("聚合函数不能为空")
+	}
+	tables, err := dtx.shardTables(entity, q.Tables)
+	if err != nil {
+		return nil, err
+	}
+
+	//AVG拆分为SUM和COUNT
+	cols := append([]string{}, q.GroupBy...)
+	for i, a := range aggs {
+		column := a.Column
+		if column == "" {
+			column = "*"
+		}
+		switch strings.ToUpper(a.Func) {
+		case "COUNT", "SUM", "MIN", "MAX":
+			cols = append(cols, fmt.Sprintf("%s(%s) AS a%d", strings.ToUpper(a.Func), column, i))
+		case "AVG":
+			cols = append(cols, fmt.Sprintf("SUM(%s) AS a%d", column, i), fmt.Sprintf("COUNT(%s) AS c%d", column, i))
+		default:
+			return nil, fmt.Errorf("不支持的聚合函数:%s", a.Func)
+		}
+	}
+	where, err := dtx.scopeWhere(q.Where, entity)
+	if err != nil {
+		return nil, err
+	}
+	sqlStr := "SELECT " + strings.Join(cols, ",") + " FROM " + TablePlaceholder + where
+	if len(q.GroupBy) > 0 {
+		sqlStr += " GROUP BY " + strings.Join(q.GroupBy, ",")
+	}
+
+	results := make([][]map[string]interface{}, len(tables))
+	numerics := make([]map[string]bool, len(tables))
+	err = dtx.scatter(ctx, tables, q.Parallel, func(ctx context.Context, i int, table string) error {
+		db, fail := dtx.reader()
+		rows, numeric, err := queryMaps(ctx, db, strings.Replace(sqlStr, TablePlaceholder, table, -1), q.Args)
+		fail(err)
+		if err != nil {
+			return fmt.Errorf("%s: %s", table, err)
+		}
+		results[i] = rows
+		numerics[i] = numeric
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	numeric := mergeNumeric(numerics)
+
+	//按分组合并
+	var keys []string
+	groups := make(map[string]map[string]interface{})
+	for _, rows := range results {
+		for _, row := range rows {
+			key := groupKey(row, q.GroupBy)
+			acc, ok := groups[key]
+			if !ok {
+				acc = make(map[string]interface{})
+				for _, g := range q.GroupBy {
+					acc[g] = plainValue(rowValue(row, g))
+				}
+				groups[key] = acc
+				keys = append(keys, key)
+			}
+			mergeAggregate(acc, row, aggs, numeric)
+		}
+	}
+
+	list := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		acc := groups[key]
+		row := make(map[string]interface{})
+		for _, g := range q.GroupBy {
+			row[g] = acc[g]
+		}
+		for i, a := range aggs {
+			switch strings.ToUpper(a.Func) {
+			case "COUNT":
+				n, ok := acc[fmt.Sprintf("a%d", i)].(int64)
+				if !ok {
+					n = int64(toFloat(acc[fmt.Sprintf("a%d", i)]))
+				}
+				row[a.name()] = n
+				numeric[strings.ToLower(a.name())] = true
+			case "AVG":
+				if c := toFloat(acc[fmt.Sprintf("c%d", i)]); c > 0 {
+					row[a.name()] = toFloat(acc[fmt.Sprintf("a%d", i)]) / c
+				} else {
+					row[a.name()] = nil
+				}
+				numeric[strings.ToLower(a.name())] = true
+			case "SUM":
+				row[a.name()] = acc[fmt.Sprintf("a%d", i)]
+				numeric[strings.ToLower(a.name())] = true
+			default:
+				row[a.name()] = acc[fmt.Sprintf("a%d", i)]
+				numeric[strings.ToLower(a.name())] = numeric[fmt.Sprintf("a%d", i)]
+			}
+		}
+		list = append(list, row)
+	}
+
+	//无分组且全部分表无数据时返回一行
+	if len(list) == 0 && len(q.GroupBy) == 0 {
+		row := make(map[string]interface{})
+		for _, a := range aggs {
+			if strings.ToUpper(a.Func) == "COUNT" {
+				row[a.name()] = int64(0)
+			} else {
+				row[a.name()] = nil
+			}
+		}
+		list = append(list, row)
+	}
+
+	if orders := parseOrderBy(q.OrderBy); len(orders) > 0 {
+		getter := func(v reflect.Value, column string) interface{} {
+			return rowValue(v.Interface().(map[string]interface{}), column)
+		}
+		sort.SliceStable(list, func(i, j int) bool {
+			return lessRow(getter, reflect.ValueOf(list[i]), reflect.ValueOf(list[j]), orders, numeric)
+		})
+	}
+	start, end := pageRange(len(list), q.Offset, q.Limit)
+	return list[start:end], nil
+}
+
+/*
+* 按分表配置列出表的全部分表，未配置分表时返回表名本身
+*
+* param  tableName  分表配置的表名
+*
+* return 表名列表
+ */
+func (dtx DbContext) ShardTables(tableName string) ([]string, error) {
+	conf, ok := dtx.splitConf(tableName)
+	if !ok {
+		return []string{tableName}, nil
+	}
+	return shardNames(conf.TableName, conf.Policies)
+}
+
+//内部方法：查询的物理表列表
+func (dtx DbContext) shardTables(entity interface{}, tables []string) ([]string, error) {
+	if len(tables) > 0 {
+		return tables, nil
+	}
+	if entity == nil {
+		return nil, errors.New("entity和Tables不能同时为空")
+	}
+	return dtx.GetAllTableName(entity)
+}
+
+//内部方法：分表上的排序和条数，全局分页时各分表需返回offset+limit条
+func (dtx DbContext) shardLimit(orderBy string, offset, limit int) string {
+	var s string
+	if orderBy != "" {
+		s = " ORDER BY " + orderBy
+	}
+	if limit <= 0 {
+		return s
+	}
+
+	n := offset + limit
+	if dtx.Driver == "mssql" {
+		//mssql的OFFSET FETCH必须有ORDER BY，无排序时各分表返回全部记录
+		if orderBy == "" {
+			return s
+		}
+		return fmt.Sprintf("%s OFFSET 0 ROWS FETCH NEXT %d ROWS ONLY", s, n)
+	}
+	return fmt.Sprintf("%s LIMIT %d", s, n)
+}
+
+//内部方法：按并发数在各分表上执行，任一分表失败时取消其他分表并返回错误
+func (dtx DbContext) scatter(ctx context.Context, tables []string, parallel int, fn func(ctx context.Context, i int, table string) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if parallel <= 0 {
+		parallel = 8
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, parallel)
+	for i, table := range tables {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, table string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			tctx, tcancel := dtx.withTimeout(ctx)
+			defer tcancel()
+			if err := fn(tctx, i, table); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(i, table)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+//内部方法：解析排序语句，如 CreateTime DESC,ID
+func parseOrderBy(orderBy string) []orderField {
+	var orders []orderField
+	for _, item := range strings.Split(orderBy, ",") {
+		parts := strings.Fields(item)
+		if len(parts) == 0 {
+			continue
+		}
+		column := parts[0]
+		if idx := strings.LastIndex(column, "."); idx >= 0 {
+			column = column[idx+1:]
+		}
+		column = strings.Trim(column, "`\"[]")
+		orders = append(orders, orderField{
+			column: column,
+			desc:   len(parts) > 1 && strings.EqualFold(parts[1], "DESC"),
+		})
+	}
+	return orders
+}
+
+//内部方法：按记录类型获取字段值的方法，struct按xorm标签的字段名匹配
+func (dtx DbContext) columnGetter(elemType reflect.Type) (func(v reflect.Value, column string) interface{}, error) {
+	if elemType.Kind() == reflect.Map {
+		return func(v reflect.Value, column string) interface{} {
+			return rowValue(v.Interface().(map[string]interface{}), column)
+		}, nil
+	}
+
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("不支持排序的记录类型:%s", elemType)
+	}
+	table, err := dtx.db.TableInfo(reflect.New(elemType).Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	cols := make(map[string]*schemas.Column)
+	return func(v reflect.Value, column string) interface{} {
+		if isPtr {
+			if v.IsNil() {
+				return nil
+			}
+			v = v.Elem()
+		}
+		col, ok := cols[column]
+		if !ok {
+			col = table.GetColumn(column)
+			cols[column] = col
+		}
+		var fv *reflect.Value
+		if col != nil {
+			fv, _ = col.ValueOfV(&v)
+		} else if f := v.FieldByName(column); f.IsValid() {
+			fv = &f
+		}
+		if fv == nil || !fv.IsValid() {
+			return nil
+		}
+		return fv.Interface()
+	}, nil
+}
+
+//内部方法：按排序字段比较两行，numeric为按数值比较的字段（小写）
+func lessRow(getter func(v reflect.Value, column string) interface{}, a, b reflect.Value, orders []orderField, numeric map[string]bool) bool {
+	for _, o := range orders {
+		c := compareValue(getter(a, o.column), getter(b, o.column), numeric[strings.ToLower(o.column)])
+		if c == 0 {
+			continue
+		}
+		if o.desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	return false
+}
+
+//内部方法：比较两个值，nil最小，数字按数值比较，其他按字符串比较
+//字符串只在numeric（字段为数值类型，如驱动以[]byte返回的DECIMAL）时解析为数字，与数据库的排序一致
+func compareValue(a, b interface{}, numeric bool) int {
+	a, b = plainValue(a), plainValue(b)
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		}
+		return 1
+	}
+
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			switch {
+			case ta.Before(tb):
+				return -1
+			case ta.After(tb):
+				return 1
+			}
+			return 0
+		}
+	}
+
+	fa, oka := numberValue(a, numeric)
+	fb, okb := numberValue(b, numeric)
+	if oka && okb {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+//内部方法：取出指针、driver.Valuer（如null.String）和[]byte中的原值
+func plainValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	if valuer, ok := v.(driver.Valuer); ok {
+		val, err := valuer.Value()
+		if err != nil {
+			return nil
+		}
+		v = val
+	}
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		return plainValue(rv.Elem().Interface())
+	}
+	return v
+}
+
+//内部方法：转换为数值，parse时字符串可解析为数字的按数字处理
+func numberValue(v interface{}, parse bool) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	case reflect.String:
+		if !parse {
+			return 0, false
+		}
+		f, err := strconv.ParseFloat(rv.String(), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+//内部方法：转换为数值，无法转换时为0
+func toFloat(v interface{}) float64 {
+	f, _ := numberValue(plainValue(v), true)
+	return f
+}
+
+//内部方法：转换为整数，小数及无法转换时ok为false
+func intValue(v interface{}) (int64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() <= math.MaxInt64 {
+			return int64(rv.Uint()), true
+		}
+	case reflect.String:
+		n, err := strconv.ParseInt(rv.String(), 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+//内部方法：累加聚合值，整数按int64相加（溢出时改为float64），NULL不参与累加，全部为NULL时为nil
+func addNumber(acc interface{}, v interface{}) interface{} {
+	v = plainValue(v)
+	if v == nil {
+		return acc
+	}
+	n, ok := intValue(v)
+	if !ok {
+		f, _ := numberValue(v, true)
+		if acc == nil {
+			return f
+		}
+		return toFloat(acc) + f
+	}
+	switch a := acc.(type) {
+	case nil:
+		return n
+	case int64:
+		if sum := a + n; (n >= 0) == (sum >= a) {
+			return sum
+		}
+		return float64(a) + float64(n)
+	}
+	return toFloat(acc) + float64(n)
+}
+
+//内部方法：执行查询返回map记录，及数值类型的字段（小写）
+func queryMaps(ctx context.Context, db *xorm.Engine, sql string, args []interface{}) ([]map[string]interface{}, map[string]bool, error) {
+	for _, f := range db.Dialect().Filters() {
+		sql = f.Do(sql)
+	}
+	rows, err := db.DB().QueryContext(ctx, sql, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, err
+	}
+	numeric := make(map[string]bool, len(cols))
+	for i, t := range types {
+		numeric[strings.ToLower(cols[i])] = isNumericColumn(t)
+	}
+
+	var list []map[string]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err = rows.Scan(ptrs...); err != nil {
+			return nil, nil, err
+		}
+		row := make(map[string]interface{}, len(cols))
+		for i, c := range cols {
+			row[c] = values[i]
+		}
+		list = append(list, row)
+	}
+	return list, numeric, rows.Err()
+}
+
+//内部方法：字段是否为数值类型，按驱动的扫描类型或数据库类型名判断
+func isNumericColumn(t *stdsql.ColumnType) bool {
+	if st := t.ScanType(); st != nil {
+		for st.Kind() == reflect.Ptr {
+			st = st.Elem()
+		}
+		switch st.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return true
+		}
+	}
+	name := strings.ToUpper(t.DatabaseTypeName())
+	name = strings.TrimPrefix(name, "UNSIGNED ")
+	if idx := strings.IndexAny(name, "( "); idx >= 0 {
+		name = name[:idx]
+	}
+	sqlType := schemas.SQLType{Name: name}
+	return sqlType.IsNumeric()
+}
+
+//内部方法：合并各分表的数值字段
+func mergeNumeric(list []map[string]bool) map[string]bool {
+	numeric := make(map[string]bool)
+	for _, m := range list {
+		for k, v := range m {
+			numeric[k] = numeric[k] || v
+		}
+	}
+	return numeric
+}
+
+//内部方法：按字段名取值，忽略大小写
+func rowValue(row map[string]interface{}, column string) interface{} {
+	if v, ok := row[column]; ok {
+		return v
+	}
+	for k, v := range row {
+		if strings.EqualFold(k, column) {
+			return v
+		}
+	}
+	return nil
+}
+
+//内部方法：分组键
+func groupKey(row map[string]interface{}, groupBy []string) string {
+	var b strings.Builder
+	for _, g := range groupBy {
+		b.WriteString(fmt.Sprint(plainValue(rowValue(row, g))))
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+//内部方法：将分表的聚合结果合并到acc
+func mergeAggregate(acc map[string]interface{}, row map[string]interface{}, aggs []Aggregate, numeric map[string]bool) {
+	for i, a := range aggs {
+		key := fmt.Sprintf("a%d", i)
+		v := plainValue(rowValue(row, key))
+		switch strings.ToUpper(a.Func) {
+		case "COUNT", "SUM":
+			acc[key] = addNumber(acc[key], v)
+		case "AVG":
+			ckey := fmt.Sprintf("c%d", i)
+			acc[key] = addNumber(acc[key], v)
+			acc[ckey] = addNumber(acc[ckey], rowValue(row, ckey))
+		case "MIN":
+			if v != nil && (acc[key] == nil || compareValue(v, acc[key], numeric[key]) < 0) {
+				acc[key] = v
+			}
+		case "MAX":
+			if v != nil && (acc[key] == nil || compareValue(v, acc[key], numeric[key]) > 0) {
+				acc[key] = v
+			}
+		}
+	}
+}
+
+//内部方法：分页范围
+func pageRange(n, offset, limit int) (int, int) {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > n {
+		offset = n
+	}
+	end := n
+	if limit > 0 && offset+limit < n {
+		end = offset + limit
+	}
+	return offset, end
+}
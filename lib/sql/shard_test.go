@@ -0,0 +1,136 @@
+package sql_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/maclon-lee/golanglib/lib/sql"
+)
+
+type shardItem struct {
+	Id     int64  `xorm:"pk 'Id'"`
+	Code   string `xorm:"varchar(32) 'Code'"`
+	Amount int64  `xorm:"'Amount'"`
+}
+
+func (shardItem) TableName() string {
+	return "shard_item"
+}
+
+func newShardItems(t *testing.T) *sql.DbContext {
+	dtx := newSqlite(t, splitById("shard_item", 2), shardItem{})
+	items := []interface{}{
+		&shardItem{Id: 1, Code: "9", Amount: 30},
+		&shardItem{Id: 2, Code: "10", Amount: 5},
+		&shardItem{Id: 3, Code: "2", Amount: 100},
+		&shardItem{Id: 4, Code: "9", Amount: 7},
+		&shardItem{Id: 5, Code: "a", Amount: 12},
+	}
+	if _, err := dtx.Inserts(items...); err != nil {
+		t.Fatal(err)
+	}
+	return dtx
+}
+
+//字符串字段按数据库的字典序合并，数值字段按数值合并
+func TestQueryShardsOrder(t *testing.T) {
+	dtx := newShardItems(t)
+	ctx := context.Background()
+
+	var items []shardItem
+	if err := dtx.QueryShards(ctx, &items, shardItem{}, sql.ShardQuery{OrderBy: "Code,Id"}); err != nil {
+		t.Fatal(err)
+	}
+	var codes []string
+	for _, it := range items {
+		codes = append(codes, it.Code)
+	}
+	if want := []string{"10", "2", "9", "9", "a"}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("order by Code: got %v, want %v", codes, want)
+	}
+
+	items = nil
+	if err := dtx.QueryShards(ctx, &items, shardItem{}, sql.ShardQuery{OrderBy: "Amount DESC", Offset: 1, Limit: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Id != 1 || items[1].Id != 5 {
+		t.Errorf("order by Amount DESC page: got %+v", items)
+	}
+
+	var rows []map[string]interface{}
+	if err := dtx.QueryShards(ctx, &rows, shardItem{}, sql.ShardQuery{OrderBy: "Code DESC,Id DESC"}); err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, row := range rows {
+		ids = append(ids, row["Id"].(int64))
+	}
+	if want := []int64{5, 4, 1, 3, 2}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("map rows order by Code DESC: got %v, want %v", ids, want)
+	}
+}
+
+func TestAggregateShards(t *testing.T) {
+	dtx := newShardItems(t)
+
+	rows, err := dtx.AggregateShards(context.Background(), shardItem{}, sql.ShardQuery{},
+		sql.Count("*"), sql.Sum("Amount"), sql.Avg("Amount"), sql.Min("Amount"), sql.Max("Code"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows", len(rows))
+	}
+	row := rows[0]
+	if row["count"] != int64(5) {
+		t.Errorf("count: got %v", row["count"])
+	}
+	if row["sum_Amount"] != int64(154) {
+		t.Errorf("sum: got %v", row["sum_Amount"])
+	}
+	if row["avg_Amount"] != 154.0/5 {
+		t.Errorf("avg: got %v", row["avg_Amount"])
+	}
+	if row["min_Amount"] != int64(5) {
+		t.Errorf("min: got %v", row["min_Amount"])
+	}
+	if row["max_Code"] != "a" {
+		t.Errorf("max: got %v", row["max_Code"])
+	}
+
+	rows, err = dtx.AggregateShards(context.Background(), shardItem{}, sql.ShardQuery{GroupBy: []string{"Code"}, OrderBy: "total DESC"},
+		sql.Sum("Amount").As("total"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var codes []string
+	for _, row := range rows {
+		codes = append(codes, row["Code"].(string))
+	}
+	if want := []string{"2", "9", "a", "10"}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("group by Code order by total: got %v, want %v", codes, want)
+	}
+
+	//没有记录时SUM为NULL，COUNT为0
+	rows, err = dtx.AggregateShards(context.Background(), shardItem{}, sql.ShardQuery{Where: " WHERE Id>?", Args: []interface{}{100}},
+		sql.Count("*"), sql.Sum("Amount"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["count"] != int64(0) || rows[0]["sum_Amount"] != nil {
+		t.Errorf("empty aggregate: got %v", rows)
+	}
+
+	//超过2^53的整数合计不丢失精度
+	if _, err = dtx.Inserts(&shardItem{Id: 6, Amount: 1 << 53}, &shardItem{Id: 7, Amount: 1}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err = dtx.AggregateShards(context.Background(), shardItem{}, sql.ShardQuery{}, sql.Sum("Amount"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(1<<53 + 155); rows[0]["sum_Amount"] != want {
+		t.Errorf("large sum: got %v, want %d", rows[0]["sum_Amount"], want)
+	}
+}
@@ -0,0 +1,293 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//AppendIf中可识别的分表条件：col=? 和 col IN (?,?)
+var (
+	eqPattern = regexp.MustCompile(`(?i)^\s*(?:AND\s+)?([\w.` + "`" + `"\[\]]+)\s*=\s*\?\s*$`)
+	inPattern = regexp.MustCompile(`(?i)^\s*(?:AND\s+)?([\w.` + "`" + `"\[\]]+)\s+IN\s*\(\s*\?(?:\s*,\s*\?)*\s*\)\s*$`)
+)
+
+//分表感知的Where builder，记录分表字段上的等值和IN条件，用于计算可能命中的分表
+type ShardWhere struct {
+	*Where
+	entity interface{}
+	values map[string][][]interface{} //分表字段（小写）对应的各条件取值，多个条件取交集
+}
+
+/*
+* 构建分表感知的Where builder
+*
+* param  entity  数据对象，用于获取表名和分表规则
+*
+* return Where builder，用法同NewWhere
+ */
+func NewShardWhere(entity interface{}) *ShardWhere {
+	return &ShardWhere{
+		Where:  NewWhere(),
+		entity: entity,
+		values: make(map[string][][]interface{}),
+	}
+}
+
+//append SQL短句，col=?、col IN (?,?)形式的条件参与分表计算
+func (w *ShardWhere) AppendIf(cond bool, whereStr string, args ...interface{}) *ShardWhere {
+	if cond {
+		if m := eqPattern.FindStringSubmatch(whereStr); m != nil && len(args) == 1 {
+			w.record(m[1], args)
+		} else if m := inPattern.FindStringSubmatch(whereStr); m != nil {
+			w.record(m[1], args)
+		}
+	}
+	w.Where.AppendIf(cond, whereStr, args...)
+	return w
+}
+
+//append in查询 数组
+func (w *ShardWhere) InIf(cond bool, col string, args ...interface{}) *ShardWhere {
+	if cond {
+		w.record(col, flattenArgs(args))
+	}
+	w.Where.InIf(cond, col, args...)
+	return w
+}
+
+//append 单表达式查询，=条件参与分表计算
+func (w *ShardWhere) ExprIf(cond bool, col string, symbol string, args ...interface{}) *ShardWhere {
+	if cond && strings.TrimSpace(symbol) == "=" && len(args) == 1 {
+		w.record(col, args)
+	}
+	w.Where.ExprIf(cond, col, symbol, args...)
+	return w
+}
+
+//内部方法：记录字段条件取值，去掉表别名和引号
+func (w *ShardWhere) record(col string, values []interface{}) {
+	if idx := strings.LastIndex(col, "."); idx >= 0 {
+		col = col[idx+1:]
+	}
+	col = strings.ToLower(strings.Trim(col, "`\"[] "))
+	w.values[col] = append(w.values[col], values)
+}
+
+//条件语句（不含WHERE），用于xorm的Where方法
+func (w *ShardWhere) Condition() (string, []interface{}) {
+	sql, args := w.Build()
+	sql = strings.TrimSpace(sql)
+	if len(sql) >= 5 && strings.EqualFold(sql[:5], "WHERE") {
+		sql = strings.TrimSpace(sql[5:])
+	}
+	return sql, args
+}
+
+/*
+* 根据条件计算可能命中的分表，分表字段上有等值或IN条件时只返回对应分表，否则返回全部分表
+*
+* param  w  分表感知的Where builder
+*
+* return 表名列表，条件互斥时为空
+ */
+func (dtx DbContext) PruneTables(w *ShardWhere) ([]string, error) {
+	tableName := dtx.db.TableName(w.entity)
+	var conf *SplitTableConf
+	for i, c := range dtx.TableConfs {
+		if c.TableName == tableName {
+			conf = &dtx.TableConfs[i]
+			break
+		}
+	}
+	if conf == nil {
+		return []string{tableName}, nil
+	}
+
+	tables := []string{tableName}
+	for _, p := range conf.Policies {
+		suffixes, err := w.suffixes(p, dtx.db.GetColumnMapper().Obj2Table(p.Column))
+		if err != nil {
+			return nil, err
+		}
+
+		var temp []string
+		for _, n := range tables {
+			for _, s := range suffixes {
+				temp = append(temp, fmt.Sprintf("%v_%v", n, s))
+			}
+		}
+		tables = temp
+	}
+	return tables, nil
+}
+
+//内部方法：分表字段可能的表名后缀，无条件时为全部后缀，column为映射后的表字段名
+func (w *ShardWhere) suffixes(p Policy, column string) ([]string, error) {
+	conds, ok := w.values[strings.ToLower(p.Column)]
+	if !ok {
+		conds, ok = w.values[strings.ToLower(column)]
+	}
+	if !ok {
+		all, ok := policySuffixes(p)
+		if !ok {
+			return nil, fmt.Errorf("必须提供字段参数:%v", p.Column)
+		}
+		return all, nil
+	}
+
+	//同一字段的多个条件为AND关系，取交集
+	var set map[string]bool
+	for _, values := range conds {
+		cur := make(map[string]bool)
+		for _, v := range values {
+			s, err := policySuffix(p, v)
+			if err != nil {
+				return nil, err
+			}
+			if set == nil || set[s] {
+				cur[s] = true
+			}
+		}
+		set = cur
+	}
+
+	list := make([]string, 0, len(set))
+	for s := range set {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return compareValue(list[i], list[j], true) < 0 })
+	return list, nil
+}
+
+/*
+* 按条件跨分表查询，只查询可能命中的分表
+*
+* param  ctx           上下文
+* param  rowsSlicePtr  返回记录行数据对象, 支持[]struct, []map[string]interface{}类型
+* param  w             分表感知的Where builder
+* param  q             查询参数，使用Parallel、OrderBy、Offset、Limit，Where、Args、Tables由w生成
+*
+* return 是否异常
+ */
+func (dtx DbContext) QueryWhere(ctx context.Context, rowsSlicePtr interface{}, w *ShardWhere, q ShardQuery) error {
+	tables, err := dtx.PruneTables(w)
+	if err != nil {
+		return err
+	}
+	if len(tables) == 0 {
+		v := reflect.ValueOf(rowsSlicePtr)
+		if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Slice {
+			v.Elem().Set(reflect.MakeSlice(v.Elem().Type(), 0, 0))
+		}
+		return nil
+	}
+
+	q.Where, q.Args = w.Build()
+	q.Tables = tables
+	return dtx.QueryShards(ctx, rowsSlicePtr, w.entity, q)
+}
+
+/*
+* 按条件更新，只更新可能命中的分表，多个分表在同一事务中执行
+*
+* param  ctx     上下文
+* param  entity  更新数据，支持map或struct类型
+* param  w       分表感知的Where builder，条件不能为空
+*
+* return 更新成功数量
+ */
+func (dtx DbContext) UpdateWhere(ctx context.Context, entity interface{}, w *ShardWhere) (int64, error) {
+	tables, err := dtx.PruneTables(w)
+	if err != nil {
+		return 0, err
+	}
+	cond, args := w.Condition()
+	if cond == "" {
+		return 0, fmt.Errorf("更新条件不能为空")
+	}
+	where, err := dtx.scopeWhere(cond, w.entity)
+	if err != nil {
+		return 0, err
+	}
+	cond = strings.TrimPrefix(where, " WHERE ")
+	fillAudit(ctx, entity, false)
+	//双写时同时更新全部新分表，返回数量只计原分表
+	pruned := len(tables)
+	tables = append(tables, dtx.mirrorTables(dtx.db.TableName(w.entity), nil)...)
+
+	var n int64
+	err = dtx.Transaction(ctx, func(tx *Tx) error {
+		for i, table := range tables {
+			session, done := tx.stmt()
+			r, err := dtx.scope(session).Table(table).Where(cond, args...).Update(entity)
+			done()
+			if err != nil {
+				return fmt.Errorf("%s: %s", table, err)
+			}
+			if i < pruned {
+				n += r
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+/*
+* 按条件删除，只删除可能命中的分表，多个分表在同一事务中执行，软删除的实体改为设置删除时间
+*
+* param  ctx  上下文
+* param  w    分表感知的Where builder，条件不能为空
+*
+* return 删除成功数量
+ */
+func (dtx DbContext) DeleteWhere(ctx context.Context, w *ShardWhere) (int64, error) {
+	tables, err := dtx.PruneTables(w)
+	if err != nil {
+		return 0, err
+	}
+	cond, args := w.Condition()
+	if cond == "" {
+		return 0, fmt.Errorf("删除条件不能为空")
+	}
+	//软删除时改为设置删除时间
+	col, err := dtx.deletedColumn(w.entity)
+	if err != nil {
+		return 0, err
+	}
+	sqlStr := "DELETE FROM " + TablePlaceholder + " WHERE " + cond
+	if col != nil {
+		sqlStr = "UPDATE " + TablePlaceholder + " SET " + dtx.db.Quote(col.Name) + "=? WHERE (" + cond + ")"
+		if notDeleted := dtx.notDeleted(col); notDeleted != "" {
+			sqlStr += " AND " + notDeleted
+		}
+		args = append([]interface{}{deletedValue(col)}, args...)
+	}
+	pruned := len(tables)
+	tables = append(tables, dtx.mirrorTables(dtx.db.TableName(w.entity), nil)...)
+
+	var n int64
+	err = dtx.Transaction(ctx, func(tx *Tx) error {
+		for i, table := range tables {
+			r, err := tx.Exec(strings.Replace(sqlStr, TablePlaceholder, table, -1), args...)
+			if err != nil {
+				return fmt.Errorf("%s: %s", table, err)
+			}
+			if i < pruned {
+				n += r
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,98 @@
+package sql_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/maclon-lee/golanglib/lib/sql"
+)
+
+func TestPruneTables(t *testing.T) {
+	dtx := newSqlite(t, splitById("shard_item", 2), shardItem{})
+	all := []string{"shard_item_0", "shard_item_1"}
+
+	cases := []struct {
+		name string
+		w    *sql.ShardWhere
+		want []string
+	}{
+		{"eq", sql.NewShardWhere(&shardItem{}).AppendIf(true, "Id=?", 3), []string{"shard_item_1"}},
+		{"quoted alias", sql.NewShardWhere(&shardItem{}).AppendIf(true, "AND t.`Id` = ?", 4), []string{"shard_item_0"}},
+		{"in", sql.NewShardWhere(&shardItem{}).AppendIf(true, "Id IN (?,?)", 2, 4), []string{"shard_item_0"}},
+		{"InIf", sql.NewShardWhere(&shardItem{}).InIf(true, "Id", []int64{1, 2, 4}), all},
+		{"ExprIf", sql.NewShardWhere(&shardItem{}).ExprIf(true, "Id", "=", 5), []string{"shard_item_1"}},
+		{"intersect", sql.NewShardWhere(&shardItem{}).AppendIf(true, "Id=?", 1).InIf(true, "Id", 2, 4), []string{}},
+		{"cond false", sql.NewShardWhere(&shardItem{}).AppendIf(false, "Id=?", 1), all},
+		{"other column", sql.NewShardWhere(&shardItem{}).AppendIf(true, "Code=?", "9"), all},
+		{"range", sql.NewShardWhere(&shardItem{}).AppendIf(true, "Id>?", 1), all},
+		{"or", sql.NewShardWhere(&shardItem{}).AppendIf(true, "Id=? OR Id=?", 1, 2), all},
+	}
+	for _, c := range cases {
+		tables, err := dtx.PruneTables(c.w)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if len(tables) == 0 && len(c.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(tables, c.want) {
+			t.Errorf("%s: tables = %v, want %v", c.name, tables, c.want)
+		}
+	}
+}
+
+//只在裁剪后的分表上执行，删除其他分表不影响结果
+func TestQueryWherePruned(t *testing.T) {
+	dtx := newShardItems(t)
+	ctx := context.Background()
+	if _, err := dtx.Engine().Exec("DROP TABLE shard_item_1"); err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []shardItem
+	w := sql.NewShardWhere(&shardItem{}).InIf(true, "Id", 2, 4)
+	if err := dtx.QueryWhere(ctx, &rows, w, sql.ShardQuery{OrderBy: "Id"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Id != 2 || rows[1].Id != 4 {
+		t.Errorf("rows = %+v", rows)
+	}
+
+	n, err := dtx.UpdateWhere(ctx, &shardItem{Amount: 99}, sql.NewShardWhere(&shardItem{}).AppendIf(true, "Id=?", 4))
+	if err != nil || n != 1 {
+		t.Fatalf("UpdateWhere = %d, %v", n, err)
+	}
+	if n, err = dtx.DeleteWhere(ctx, sql.NewShardWhere(&shardItem{}).AppendIf(true, "Id=?", 2)); err != nil || n != 1 {
+		t.Fatalf("DeleteWhere = %d, %v", n, err)
+	}
+	//条件为空时不更新、不删除全部数据
+	empty := sql.NewShardWhere(&shardItem{}).AppendIf(false, "Id=?", 4)
+	if n, err = dtx.UpdateWhere(ctx, &shardItem{Amount: 1}, empty); err == nil || n != 0 {
+		t.Errorf("UpdateWhere without condition = %d, %v", n, err)
+	}
+	if n, err = dtx.DeleteWhere(ctx, empty); err == nil || n != 0 {
+		t.Errorf("DeleteWhere without condition = %d, %v", n, err)
+	}
+
+	rows = nil
+	if err = dtx.QueryWhere(ctx, &rows, sql.NewShardWhere(&shardItem{}).AppendIf(true, "Id=?", 4), sql.ShardQuery{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Amount != 99 {
+		t.Errorf("updated rows = %+v", rows)
+	}
+
+	//条件互斥时不查询任何分表
+	rows = nil
+	w = sql.NewShardWhere(&shardItem{}).AppendIf(true, "Id=?", 1).AppendIf(true, "Id=?", 2)
+	if err = dtx.QueryWhere(ctx, &rows, w, sql.ShardQuery{}); err != nil || rows == nil || len(rows) != 0 {
+		t.Errorf("disjoint rows = %+v, %v", rows, err)
+	}
+
+	//未裁剪时查询全部分表
+	if err = dtx.QueryWhere(ctx, &rows, sql.NewShardWhere(&shardItem{}), sql.ShardQuery{}); err == nil {
+		t.Error("expected error for dropped shard")
+	}
+}
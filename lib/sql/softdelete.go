@@ -0,0 +1,120 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"xorm.io/xorm"
+	"xorm.io/xorm/schemas"
+)
+
+//返回包含已删除记录的数据库上下文，Get、Update、查询构造器不过滤已删除的记录，Delete为物理删除
+func (dtx DbContext) Unscoped() *DbContext {
+	dtx.unscoped = true
+	return &dtx
+}
+
+//返回包含已删除记录的事务对象，与原事务使用同一会话
+func (tx *Tx) Unscoped() *Tx {
+	t := *tx
+	t.dtx.unscoped = true
+	return &t
+}
+
+//内部方法：Unscoped时会话不使用软删除
+func (dtx DbContext) scope(session *xorm.Session) *xorm.Session {
+	if dtx.unscoped {
+		return session.Unscoped()
+	}
+	return session
+}
+
+//内部方法：实体的软删除字段，Unscoped或未定义时为nil，实现SoftDelete而未定义deleted字段时返回错误
+func (dtx DbContext) deletedColumn(entity interface{}) (*schemas.Column, error) {
+	if entity == nil || dtx.unscoped {
+		return nil, nil
+	}
+	if _, ok := entity.(string); ok {
+		return nil, nil
+	}
+	table, err := dtx.db.TableInfo(entity)
+	if err != nil {
+		return nil, nil
+	}
+	col := table.DeletedColumn()
+	if col == nil && isSoftDelete(entity) {
+		return nil, fmt.Errorf("%s实现了SoftDelete，但未定义deleted字段", table.Name)
+	}
+	//mssql的datetime不支持0001-01-01，无法判断未删除
+	if col != nil && dtx.Driver == "mssql" && !col.SQLType.IsNumeric() && !col.Nullable {
+		return nil, fmt.Errorf("%s的deleted字段%s在mssql中须为整数或允许NULL", table.Name, col.Name)
+	}
+	return col, nil
+}
+
+//内部方法：实体是否实现SoftDelete或SoftDeleteState
+func isSoftDelete(entity interface{}) bool {
+	switch entity.(type) {
+	case SoftDelete, SoftDeleteState:
+		return true
+	}
+	return false
+}
+
+//内部方法：未删除条件，与xorm的软删除条件一致，mssql的时间字段只判断NULL（deletedColumn已排除不允许NULL的字段）
+func (dtx DbContext) notDeleted(col *schemas.Column) string {
+	name := dtx.db.Quote(col.Name)
+	var conds []string
+	if col.SQLType.IsNumeric() {
+		conds = append(conds, name+"=0")
+	} else if dtx.Driver != "mssql" {
+		conds = append(conds, name+"='0001-01-01 00:00:00'")
+	}
+	if col.Nullable {
+		conds = append(conds, name+" IS NULL")
+	}
+	if len(conds) == 0 {
+		return ""
+	}
+	return "(" + strings.Join(conds, " OR ") + ")"
+}
+
+//内部方法：删除时间，整数字段为时间戳
+func deletedValue(col *schemas.Column) interface{} {
+	if col.SQLType.IsNumeric() {
+		return time.Now().Unix()
+	}
+	return time.Now()
+}
+
+//内部方法：未删除时的值（SQL字面量），用于恢复软删除的记录
+func undeletedValue(col *schemas.Column) string {
+	if col.SQLType.IsNumeric() {
+		return "0"
+	}
+	if col.Nullable {
+		return "NULL"
+	}
+	return "'0001-01-01 00:00:00'"
+}
+
+//内部方法：条件语句（WHERE ...或不含WHERE）追加未删除条件，返回 WHERE ...
+func (dtx DbContext) scopeWhere(where string, entity interface{}) (string, error) {
+	col, err := dtx.deletedColumn(entity)
+	if err != nil || col == nil {
+		return where, err
+	}
+	cond := dtx.notDeleted(col)
+	if cond == "" {
+		return where, nil
+	}
+
+	where = strings.TrimSpace(where)
+	if len(where) >= 5 && strings.EqualFold(where[:5], "WHERE") {
+		where = strings.TrimSpace(where[5:])
+	}
+	if where == "" {
+		return " WHERE " + cond, nil
+	}
+	return " WHERE (" + where + ") AND " + cond, nil
+}
@@ -0,0 +1,176 @@
+package sql_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/maclon-lee/golanglib/lib/sql"
+)
+
+type softItem struct {
+	Id                  int64  `xorm:"pk 'Id'"`
+	Name                string `xorm:"'Name'"`
+	sql.SoftDeleteModel `xorm:"extends"`
+}
+
+func (softItem) TableName() string {
+	return "soft_item"
+}
+
+//自定义整数删除字段，实现SoftDelete
+type softIntItem struct {
+	Id        int64 `xorm:"pk 'Id'"`
+	DeletedAt int64 `xorm:"deleted notnull default 0 'DeletedAt'"`
+}
+
+func (softIntItem) TableName() string {
+	return "soft_int_item"
+}
+
+func (softIntItem) Delete() {}
+
+//实现SoftDelete但未定义deleted字段
+type softInvalidItem struct {
+	Id int64 `xorm:"pk 'Id'"`
+}
+
+func (softInvalidItem) TableName() string {
+	return "soft_invalid_item"
+}
+
+func (softInvalidItem) Delete() {}
+
+//内部方法：查询全部分表的Id
+func softIds(t *testing.T, dtx *sql.DbContext) []int64 {
+	t.Helper()
+	var rows []softItem
+	if err := dtx.QueryShards(context.Background(), &rows, softItem{}, sql.ShardQuery{OrderBy: "Id"}); err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, r := range rows {
+		ids = append(ids, r.Id)
+	}
+	return ids
+}
+
+//内部方法：按Id读取，分表按实体的Id路由，Name非空时为找到记录
+func getSoft(t *testing.T, get func(entity interface{}, id ...interface{}) error, id int64) softItem {
+	t.Helper()
+	item := softItem{Id: id}
+	if err := get(&item, id); err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+func TestSoftDelete(t *testing.T) {
+	dtx := newSqlite(t, splitById("soft_item", 2), softItem{})
+	ctx := context.Background()
+	if _, err := dtx.Inserts(&softItem{Id: 1, Name: "a"}, &softItem{Id: 2, Name: "b"}, &softItem{Id: 3, Name: "c"}, &softItem{Id: 4, Name: "d"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := dtx.Delete("", &softItem{Id: 1}); err != nil || n != 1 {
+		t.Fatalf("Delete = %d, %v", n, err)
+	}
+	n, err := dtx.DeleteWhere(ctx, sql.NewShardWhere(&softItem{}).AppendIf(true, "Id=?", 2))
+	if err != nil || n != 1 {
+		t.Fatalf("DeleteWhere = %d, %v", n, err)
+	}
+	//已删除的记录不再重复删除
+	if n, err = dtx.Delete("", &softItem{Id: 1}); err != nil || n != 0 {
+		t.Errorf("second Delete = %d, %v", n, err)
+	}
+
+	if item := getSoft(t, dtx.Get, 1); item.Name != "" {
+		t.Errorf("Get deleted = %+v", item)
+	}
+	if item := getSoft(t, dtx.Unscoped().Get, 1); item.Name != "a" || !item.IsDeleted() {
+		t.Errorf("Unscoped Get = %+v", item)
+	}
+	if item := getSoft(t, dtx.Get, 3); item.Name != "c" || item.IsDeleted() {
+		t.Errorf("Get = %+v", item)
+	}
+	if n, err = dtx.Update("", &softItem{Name: "x"}, softItem{Id: 1}); err != nil || n != 0 {
+		t.Errorf("Update deleted = %d, %v", n, err)
+	}
+
+	if ids := softIds(t, dtx); !reflect.DeepEqual(ids, []int64{3, 4}) {
+		t.Errorf("QueryShards ids = %v", ids)
+	}
+	if ids := softIds(t, dtx.Unscoped()); !reflect.DeepEqual(ids, []int64{1, 2, 3, 4}) {
+		t.Errorf("Unscoped QueryShards ids = %v", ids)
+	}
+	rows, err := dtx.AggregateShards(ctx, softItem{}, sql.ShardQuery{}, sql.Count("*"))
+	if err != nil || rows[0]["count"] != int64(2) {
+		t.Errorf("AggregateShards = %v, %v", rows, err)
+	}
+	var found []softItem
+	if err = dtx.QueryWhere(ctx, &found, sql.NewShardWhere(&softItem{}).InIf(true, "Id", 1, 3), sql.ShardQuery{}); err != nil || len(found) != 1 || found[0].Id != 3 {
+		t.Errorf("QueryWhere = %+v, %v", found, err)
+	}
+	pages := 0
+	err = dtx.IterateKeyset(ctx, &softItem{}, sql.Keyset{}, func(table string, page interface{}) error {
+		for _, r := range *page.(*[]softItem) {
+			pages++
+			if r.IsDeleted() {
+				t.Errorf("IterateKeyset returned deleted %+v", r)
+			}
+		}
+		return nil
+	})
+	if err != nil || pages != 2 {
+		t.Errorf("IterateKeyset rows = %d, %v", pages, err)
+	}
+
+	//Unscoped的Delete为物理删除
+	if n, err = dtx.Unscoped().Delete("", &softItem{Id: 1}); err != nil || n != 1 {
+		t.Fatalf("Unscoped Delete = %d, %v", n, err)
+	}
+	if ids := softIds(t, dtx.Unscoped()); !reflect.DeepEqual(ids, []int64{2, 3, 4}) {
+		t.Errorf("ids after physical delete = %v", ids)
+	}
+
+	//事务内同样过滤，tx.Unscoped包含已删除的记录
+	err = dtx.Transaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.Delete("", &softItem{Id: 3}); err != nil {
+			return err
+		}
+		if item := getSoft(t, tx.Get, 3); item.Name != "" {
+			t.Errorf("tx Get deleted = %+v", item)
+		}
+		if item := getSoft(t, tx.Unscoped().Get, 3); item.Name != "c" || !item.IsDeleted() {
+			t.Errorf("tx Unscoped Get = %+v", item)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSoftDeleteCustomColumn(t *testing.T) {
+	dtx := newSqlite(t, nil, softIntItem{}, softInvalidItem{})
+	if _, err := dtx.Inserts(&softIntItem{Id: 1}, &softIntItem{Id: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := dtx.Delete("", &softIntItem{Id: 1}); err != nil || n != 1 {
+		t.Fatalf("Delete = %d, %v", n, err)
+	}
+	var deleted, unscoped, item softIntItem
+	if err := dtx.Get(&deleted, 1); err != nil || deleted.Id != 0 {
+		t.Errorf("Get deleted = %+v, %v", deleted, err)
+	}
+	if err := dtx.Unscoped().Get(&unscoped, 1); err != nil || unscoped.DeletedAt == 0 {
+		t.Errorf("Unscoped Get = %+v, %v", unscoped, err)
+	}
+	if err := dtx.Get(&item, 2); err != nil || item.Id != 2 || item.DeletedAt != 0 {
+		t.Errorf("Get = %+v, %v", item, err)
+	}
+
+	if _, err := dtx.Delete("", &softInvalidItem{Id: 1}); err == nil {
+		t.Error("expected error for SoftDelete without deleted column")
+	}
+}
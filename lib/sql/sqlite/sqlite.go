@@ -0,0 +1,33 @@
+//sqlite驱动，依赖cgo，以 import _ "github.com/maclon-lee/golanglib/lib/sql/sqlite" 引入后dbs.db的driver可使用sqlite
+package sqlite
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/maclon-lee/golanglib/lib/sql"
+	"strings"
+	"xorm.io/xorm"
+)
+
+//注册sqlite驱动，重新加载使用sqlite而未能连接的数据库上下文
+func init() {
+	sql.RegisterDriver("sqlite", sql.DriverFunc(Open))
+}
+
+//sqlite：连接字符串为文件路径（如 file:data.db?_busy_timeout=5000）或 :memory:
+func Open(dataSourceName string) (*xorm.Engine, error) {
+	db, err := xorm.NewEngine("sqlite3", dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	//内存数据库每个连接独立，且连接关闭后数据丢失，只保留一个常驻连接
+	if IsMemory(dataSourceName) {
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+	}
+	return db, nil
+}
+
+//是否为sqlite内存数据库
+func IsMemory(dataSourceName string) bool {
+	return strings.Contains(dataSourceName, ":memory:") || strings.Contains(dataSourceName, "mode=memory")
+}
@@ -0,0 +1,418 @@
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"xorm.io/xorm"
+	"xorm.io/xorm/schemas"
+)
+
+//事务隔离级别
+type IsolationLevel = stdsql.IsolationLevel
+
+const (
+	LevelDefault         = stdsql.LevelDefault //使用数据库默认隔离级别
+	LevelReadUncommitted = stdsql.LevelReadUncommitted
+	LevelReadCommitted   = stdsql.LevelReadCommitted
+	LevelRepeatableRead  = stdsql.LevelRepeatableRead
+	LevelSerializable    = stdsql.LevelSerializable
+)
+
+//事务选项
+type TxOptions struct {
+	Isolation IsolationLevel //隔离级别，默认使用数据库默认隔离级别
+	ReadOnly  bool           //只读事务
+}
+
+//事务对象，方法与DbContext一致，同一事务内的写入可立即读取
+//仅可在Transaction的回调函数内使用，不可并发调用
+type Tx struct {
+	dtx       DbContext
+	session   *xorm.Session
+	ctx       context.Context
+	savepoint int
+}
+
+/*
+* 在事务中执行，回调返回nil时提交，返回错误或panic时回滚
+*
+* param  ctx   上下文，取消时中止并回滚，事务内每条语句另受默认语句超时限制
+* param  fn    事务回调函数，使用tx执行数据操作
+* param  opts  事务选项，可选
+*
+* return 回调函数返回的错误或提交错误
+ */
+func (dtx DbContext) Transaction(ctx context.Context, fn func(tx *Tx) error, opts ...TxOptions) (err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	session := dtx.db.NewSession().Context(ctx)
+	defer session.Close()
+
+	var opt TxOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	reset, err := begin(session, opt)
+	if err != nil {
+		return errors.New("session.Begin err:" + err.Error())
+	}
+	restore := func() {
+		if reset != "" {
+			_, _ = session.Exec(reset)
+		}
+	}
+
+	tx := &Tx{dtx: dtx, session: session, ctx: ctx}
+	defer func() {
+		if r := recover(); r != nil {
+			restore()
+			_ = session.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		restore()
+		if rerr := session.Rollback(); rerr != nil {
+			log.Warnf("session.Rollback err:%s", rerr)
+		}
+		return err
+	}
+
+	restore()
+	if err = session.Commit(); err != nil {
+		_ = session.Rollback()
+		return errors.New("session.Commit err:" + err.Error())
+	}
+	return nil
+}
+
+//内部方法：开始事务，xorm的Begin不支持事务选项，开始后在事务连接上设置隔离级别和只读
+//返回提交或回滚前须执行的恢复语句（mssql的隔离级别在连接上保持，须恢复为默认）
+func begin(session *xorm.Session, opt TxOptions) (string, error) {
+	if err := session.Begin(); err != nil {
+		return "", err
+	}
+	if opt.Isolation == LevelDefault && !opt.ReadOnly {
+		return "", nil
+	}
+
+	stmts, reset, err := txOptionSql(session.Engine().Dialect().URI().DBType, opt)
+	if err == nil {
+		for _, stmt := range stmts {
+			if _, err = session.Exec(stmt); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		_ = session.Rollback()
+		return "", err
+	}
+	return reset, nil
+}
+
+//内部方法：设置事务选项的SQL，按顺序在事务连接上执行
+func txOptionSql(dbType schemas.DBType, opt TxOptions) ([]string, string, error) {
+	var level string
+	switch opt.Isolation {
+	case LevelDefault:
+	case LevelReadUncommitted, LevelReadCommitted, LevelRepeatableRead, LevelSerializable:
+		level = strings.ToUpper(opt.Isolation.String())
+	case stdsql.LevelSnapshot:
+		if dbType != schemas.MSSQL {
+			return nil, "", fmt.Errorf("%s不支持隔离级别%s", dbType, opt.Isolation)
+		}
+		level = "SNAPSHOT"
+	default:
+		return nil, "", fmt.Errorf("%s不支持隔离级别%s", dbType, opt.Isolation)
+	}
+
+	switch dbType {
+	case schemas.POSTGRES:
+		//须为事务的第一条语句
+		stmt := "SET TRANSACTION"
+		if level != "" {
+			stmt += " ISOLATION LEVEL " + level
+		}
+		if opt.ReadOnly {
+			stmt += " READ ONLY"
+		}
+		return []string{stmt}, "", nil
+	case schemas.MYSQL:
+		//mysql事务开始后不能修改隔离级别，提交空事务后在同一连接上设置并重新开始
+		stmts := []string{"COMMIT"}
+		if level != "" {
+			stmts = append(stmts, "SET TRANSACTION ISOLATION LEVEL "+level)
+		}
+		if opt.ReadOnly {
+			return append(stmts, "START TRANSACTION READ ONLY"), "", nil
+		}
+		return append(stmts, "START TRANSACTION"), "", nil
+	case schemas.MSSQL:
+		if opt.ReadOnly {
+			return nil, "", errors.New("mssql不支持只读事务")
+		}
+		return []string{"SET TRANSACTION ISOLATION LEVEL " + level}, "SET TRANSACTION ISOLATION LEVEL READ COMMITTED", nil
+	case schemas.SQLITE:
+		//sqlite的事务总是可串行化
+		if opt.ReadOnly || (level != "" && opt.Isolation != LevelSerializable) {
+			return nil, "", fmt.Errorf("sqlite不支持事务选项%+v", opt)
+		}
+		return nil, "", nil
+	}
+	return nil, "", fmt.Errorf("%s不支持事务选项", dbType)
+}
+
+/*
+* 嵌套事务（保存点），回调返回错误或panic时仅回滚到保存点，外层事务可继续执行
+*
+* param  fn  事务回调函数
+*
+* return 回调函数返回的错误
+ */
+func (tx *Tx) Transaction(fn func(tx *Tx) error) (err error) {
+	tx.savepoint++
+	name := fmt.Sprintf("sp_%d", tx.savepoint)
+	defer func() {
+		tx.savepoint--
+	}()
+
+	if _, err = tx.Exec(tx.savepointSql("save", name)); err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			_, _ = tx.Exec(tx.savepointSql("rollback", name))
+			panic(r)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		if _, rerr := tx.Exec(tx.savepointSql("rollback", name)); rerr != nil {
+			log.Warnf("rollback savepoint %s err:%s", name, rerr)
+		}
+		return err
+	}
+
+	if sql := tx.savepointSql("release", name); sql != "" {
+		_, err = tx.Exec(sql)
+	}
+	return err
+}
+
+//内部方法：保存点SQL，mssql无释放保存点语句
+func (tx *Tx) savepointSql(op string, name string) string {
+	if tx.dtx.Driver == "mssql" {
+		switch op {
+		case "save":
+			return "SAVE TRANSACTION " + name
+		case "rollback":
+			return "ROLLBACK TRANSACTION " + name
+		}
+		return ""
+	}
+
+	switch op {
+	case "save":
+		return "SAVEPOINT " + name
+	case "rollback":
+		return "ROLLBACK TO SAVEPOINT " + name
+	}
+	return "RELEASE SAVEPOINT " + name
+}
+
+//内部方法：设置单条语句的超时，返回的函数恢复事务上下文
+func (tx *Tx) stmt() (*xorm.Session, func()) {
+	ctx, cancel := tx.dtx.withTimeout(tx.ctx)
+	tx.session.Context(ctx)
+	return tx.session, func() {
+		cancel()
+		tx.session.Context(tx.ctx)
+	}
+}
+
+//返回事务的数据库上下文
+func (tx *Tx) Context() DbContext {
+	return tx.dtx
+}
+
+//返回事务的xorm会话，用于直接使用xorm的方法
+func (tx *Tx) Session() *xorm.Session {
+	return tx.session
+}
+
+/*
+* 根据ID查询数据记录，可读取本事务内未提交的数据
+*
+* param  entity  返回数据对象，传string时为表名
+* param  id      ID值列表
+*
+* return 是否异常
+ */
+func (tx *Tx) Get(entity interface{}, id ...interface{}) error {
+	tbName, ok := entity.(string)
+	if !ok {
+		var err error
+		if tbName, err = tx.dtx.GetTableName(entity); err != nil {
+			return err
+		}
+	}
+
+	session, done := tx.stmt()
+	defer done()
+	_, err := tx.dtx.scope(session).Table(tbName).ID(id).Get(entity)
+	return err
+}
+
+/*
+* 插入数据，支持批量和单个，按分表规则分组插入
+*
+* param  entities  入库数据
+*
+* return 入库成功数量
+ */
+func (tx *Tx) Inserts(entities ...interface{}) (int64, error) {
+	return tx.ImportData(false, 0, entities...)
+}
+
+/*
+* 批量导入数据
+*
+* param  isIdentityInsert 是否包含插入自增类型字段值
+* param  batchNum         单次批量入库数量
+* param  entities         入库数据
+*
+* return 入库成功数量
+ */
+func (tx *Tx) ImportData(isIdentityInsert bool, batchNum int, entities ...interface{}) (int64, error) {
+	if len(entities) == 0 {
+		return 0, errors.New("参数不能为空")
+	}
+	for _, bean := range entities {
+		fillAudit(tx.ctx, bean, true)
+	}
+
+	session, done := tx.stmt()
+	defer done()
+	if tx.dtx.dualWrite() {
+		return tx.dtx.mirrorInsert(session, entities)
+	}
+
+	group, err := tx.dtx.groupByTable(entities)
+	if err != nil {
+		return 0, err
+	}
+	return tx.dtx.insertGroup(session, isIdentityInsert, batchNum, group)
+}
+
+/*
+* 更新数据
+*
+* param  fullTableName  表名，传空值时自动获取表名
+* param  entity         入库数据
+* param  condi          更新条件，支持map或struct类型
+*
+* return 更新成功数量，版本冲突时返回ErrStaleObject
+ */
+func (tx *Tx) Update(fullTableName string, entity interface{}, condi ...interface{}) (int64, error) {
+	var err error
+	tbName := fullTableName
+	if tbName == "" {
+		if tbName, err = tx.dtx.GetTableName(entity); err != nil {
+			return 0, err
+		}
+	}
+
+	fillAudit(tx.ctx, entity, false)
+
+	session, done := tx.stmt()
+	defer done()
+	lock := tx.dtx.versionLock(entity)
+	n, err := tx.dtx.scope(session).Table(tbName).Update(entity, condi...)
+	if n, err = lock.check(tbName, n, err); err != nil {
+		return 0, err
+	}
+	err = lock.rewind(func() error {
+		return tx.dtx.mirrorWrite(session, fullTableName, entity, func(session *xorm.Session) (int64, error) {
+			return tx.dtx.scope(session).Update(entity, condi...)
+		})
+	})
+	return n, err
+}
+
+/*
+* 删除数据
+*
+* param  fullTableName  表名，传空值时自动获取表名
+* param  entity         删除条件，支持map或struct类型
+*
+* return 删除成功数量
+ */
+func (tx *Tx) Delete(fullTableName string, entity interface{}) (int64, error) {
+	var err error
+	tbName := fullTableName
+	if tbName == "" {
+		if tbName, err = tx.dtx.GetTableName(entity); err != nil {
+			return 0, err
+		}
+	}
+	if _, err = tx.dtx.deletedColumn(entity); err != nil {
+		return 0, err
+	}
+
+	session, done := tx.stmt()
+	defer done()
+	n, err := tx.dtx.scope(session).Table(tbName).Delete(entity)
+	if err != nil {
+		return 0, err
+	}
+	err = tx.dtx.mirrorWrite(session, fullTableName, entity, func(session *xorm.Session) (int64, error) {
+		return tx.dtx.scope(session).Delete(entity)
+	})
+	return n, err
+}
+
+/*
+* 自定义SQL查询，可读取本事务内未提交的数据
+*
+* param  rowsSlicePtr   返回记录行数据对象, 支持[]struct, []map[string]interface{}类型
+* param  sql            SQL语句
+* param  args           SQL参数
+*
+* return 是否异常
+ */
+func (tx *Tx) Query(rowsSlicePtr interface{}, sql string, args ...interface{}) error {
+	session, done := tx.stmt()
+	defer done()
+	return session.SQL(sql, args...).Find(rowsSlicePtr)
+}
+
+/*
+* 执行自定义SQL
+*
+* param  sql            SQL语句
+* param  args           SQL参数
+*
+* return 执行成功数量
+ */
+func (tx *Tx) Exec(sql string, args ...interface{}) (int64, error) {
+	var sqlOrArgs []interface{}
+	sqlOrArgs = append(sqlOrArgs, sql)
+	sqlOrArgs = append(sqlOrArgs, args...)
+
+	session, done := tx.stmt()
+	defer done()
+	res, err := session.Exec(sqlOrArgs...)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
@@ -0,0 +1,156 @@
+package sql_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/maclon-lee/golanglib/lib/sql"
+)
+
+type txItem struct {
+	Id   int64  `xorm:"pk 'Id'"`
+	Name string `xorm:"'Name'"`
+}
+
+func (txItem) TableName() string {
+	return "tx_item"
+}
+
+//内部方法：按Id升序的全部记录Id
+func txIds(t *testing.T, dtx *sql.DbContext) []int64 {
+	t.Helper()
+	var rows []txItem
+	if err := dtx.Engine().Asc("Id").Find(&rows); err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]int64, len(rows))
+	for i, r := range rows {
+		ids[i] = r.Id
+	}
+	return ids
+}
+
+func TestTransactionCommitRollback(t *testing.T) {
+	dtx := newSqlite(t, nil, txItem{})
+	ctx := context.Background()
+
+	err := dtx.Transaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.Inserts(&txItem{Id: 1, Name: "a"}); err != nil {
+			return err
+		}
+		//事务内可读取未提交的写入
+		var item txItem
+		if err := tx.Get(&item, 1); err != nil || item.Name != "a" {
+			t.Errorf("uncommitted read = %+v, %v", item, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errFail := errors.New("fail")
+	err = dtx.Transaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.Inserts(&txItem{Id: 2, Name: "b"}); err != nil {
+			return err
+		}
+		return errFail
+	})
+	if err != errFail {
+		t.Errorf("rollback error = %v", err)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("recover = %v", r)
+			}
+		}()
+		_ = dtx.Transaction(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.Inserts(&txItem{Id: 3, Name: "c"}); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	}()
+
+	if ids := txIds(t, dtx); len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("ids = %v, want [1]", ids)
+	}
+}
+
+func TestNestedTransaction(t *testing.T) {
+	dtx := newSqlite(t, nil, txItem{})
+
+	err := dtx.Transaction(context.Background(), func(tx *sql.Tx) error {
+		if _, err := tx.Inserts(&txItem{Id: 1}); err != nil {
+			return err
+		}
+		//内层失败只回滚到保存点
+		err := tx.Transaction(func(tx *sql.Tx) error {
+			if _, err := tx.Inserts(&txItem{Id: 2}); err != nil {
+				return err
+			}
+			return errors.New("inner")
+		})
+		if err == nil || err.Error() != "inner" {
+			t.Errorf("inner error = %v", err)
+		}
+
+		return tx.Transaction(func(tx *sql.Tx) error {
+			if _, err := tx.Inserts(&txItem{Id: 3}); err != nil {
+				return err
+			}
+			//第二层嵌套失败不影响第一层
+			_ = tx.Transaction(func(tx *sql.Tx) error {
+				if _, err := tx.Inserts(&txItem{Id: 4}); err != nil {
+					return err
+				}
+				return errors.New("deep")
+			})
+			_, err := tx.Inserts(&txItem{Id: 5})
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := txIds(t, dtx); len(ids) != 3 || ids[0] != 1 || ids[1] != 3 || ids[2] != 5 {
+		t.Errorf("ids = %v, want [1 3 5]", ids)
+	}
+
+	//外层回滚时已释放的保存点一并回滚
+	_ = dtx.Transaction(context.Background(), func(tx *sql.Tx) error {
+		_ = tx.Transaction(func(tx *sql.Tx) error {
+			_, err := tx.Inserts(&txItem{Id: 6})
+			return err
+		})
+		return errors.New("outer")
+	})
+	if ids := txIds(t, dtx); len(ids) != 3 {
+		t.Errorf("ids after outer rollback = %v", ids)
+	}
+}
+
+func TestTransactionOptions(t *testing.T) {
+	dtx := newSqlite(t, nil, txItem{})
+	ctx := context.Background()
+
+	err := dtx.Transaction(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Inserts(&txItem{Id: 1})
+		return err
+	}, sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	called := false
+	err = dtx.Transaction(ctx, func(tx *sql.Tx) error {
+		called = true
+		return nil
+	}, sql.TxOptions{ReadOnly: true})
+	if err == nil || called {
+		t.Errorf("sqlite read only: err = %v, called = %v", err, called)
+	}
+}
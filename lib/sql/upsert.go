@@ -0,0 +1,459 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/maclon-lee/golanglib/lib/json"
+	"reflect"
+	"strings"
+	"time"
+	"xorm.io/xorm/convert"
+	"xorm.io/xorm/schemas"
+)
+
+//mssql单条语句参数上限为2100
+const mssqlMaxParams = 2000
+
+/*
+* 插入或更新数据，冲突字段已存在时更新，否则插入，支持批量和单个
+* mysql: ON DUPLICATE KEY UPDATE（按表的任意唯一键冲突）
+* postgres/sqlite: ON CONFLICT (conflictColumns) DO UPDATE
+* mssql: MERGE
+* 更新时同时恢复已软删除的记录
+* mysql的数量按RowsAffected推算（插入计1，更新计2），已存在且值未变化的记录计0，会计入插入数量；有version字段时每次更新都会变化，数量准确
+*
+* param  conflictColumns  冲突判断的表字段名，需有主键或唯一索引
+* param  updateColumns    已存在时更新的表字段名，为空时更新除冲突字段、主键、自增、created和CreatedAt/CreatedBy字段外的全部字段；version字段加1
+* param  entities         入库数据
+*
+* return 插入数量、更新数量
+ */
+func (dtx DbContext) Upsert(conflictColumns []string, updateColumns []string, entities ...interface{}) (int64, int64, error) {
+	return dtx.UpsertDataContext(context.Background(), 0, conflictColumns, updateColumns, entities...)
+}
+
+//插入或更新数据，ctx取消或超时时中止并回滚
+func (dtx DbContext) UpsertContext(ctx context.Context, conflictColumns []string, updateColumns []string, entities ...interface{}) (int64, int64, error) {
+	return dtx.UpsertDataContext(ctx, 0, conflictColumns, updateColumns, entities...)
+}
+
+/*
+* 批量插入或更新数据，按分表规则分组，每组按batchNum分批执行，全部在一个事务中
+*
+* param  batchNum         单次批量入库数量，默认1000，mssql另受参数数量限制
+* param  conflictColumns  冲突判断的表字段名
+* param  updateColumns    已存在时更新的表字段名
+* param  entities         入库数据
+*
+* return 插入数量、更新数量
+ */
+func (dtx DbContext) UpsertData(batchNum int, conflictColumns []string, updateColumns []string, entities ...interface{}) (int64, int64, error) {
+	return dtx.UpsertDataContext(context.Background(), batchNum, conflictColumns, updateColumns, entities...)
+}
+
+//批量插入或更新数据，ctx取消或超时时中止并回滚
+func (dtx DbContext) UpsertDataContext(ctx context.Context, batchNum int, conflictColumns []string, updateColumns []string, entities ...interface{}) (int64, int64, error) {
+	ctx, cancel := dtx.withTimeout(ctx)
+	defer cancel()
+
+	var inserted, updated int64
+	err := dtx.Transaction(ctx, func(tx *Tx) error {
+		var err error
+		inserted, updated, err = tx.UpsertData(batchNum, conflictColumns, updateColumns, entities...)
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return inserted, updated, nil
+}
+
+/*
+* 插入或更新数据
+*
+* param  conflictColumns  冲突判断的表字段名
+* param  updateColumns    已存在时更新的表字段名
+* param  entities         入库数据
+*
+* return 插入数量、更新数量
+ */
+func (tx *Tx) Upsert(conflictColumns []string, updateColumns []string, entities ...interface{}) (int64, int64, error) {
+	return tx.UpsertData(0, conflictColumns, updateColumns, entities...)
+}
+
+/*
+* 批量插入或更新数据，双写时同时写入新分表
+*
+* param  batchNum         单次批量入库数量
+* param  conflictColumns  冲突判断的表字段名
+* param  updateColumns    已存在时更新的表字段名
+* param  entities         入库数据
+*
+* return 插入数量、更新数量
+ */
+func (tx *Tx) UpsertData(batchNum int, conflictColumns []string, updateColumns []string, entities ...interface{}) (int64, int64, error) {
+	if len(entities) == 0 {
+		return 0, 0, errors.New("参数不能为空")
+	}
+	if len(conflictColumns) == 0 {
+		return 0, 0, errors.New("conflictColumns不能为空")
+	}
+	switch tx.dtx.Driver {
+	case "mysql", "postgres", "sqlite", "mssql":
+	default:
+		return 0, 0, errors.New("Upsert不支持的数据库驱动:" + tx.dtx.Driver)
+	}
+
+	for _, bean := range entities {
+		fillAudit(tx.ctx, bean, true)
+	}
+
+	group, err := tx.dtx.groupByTable(entities)
+	if err != nil {
+		return 0, 0, err
+	}
+	var inserted, updated int64
+	for k, v := range group {
+		i, u, err := tx.upsertTable(k, batchNum, conflictColumns, updateColumns, v)
+		if err != nil {
+			return 0, 0, err
+		}
+		inserted += i
+		updated += u
+	}
+
+	if tx.dtx.dualWrite() {
+		mirror := make(map[string][]interface{})
+		for _, bean := range entities {
+			for _, name := range tx.dtx.mirrorTables("", bean) {
+				mirror[name] = append(mirror[name], bean)
+			}
+		}
+		for k, v := range mirror {
+			if _, _, err = tx.upsertTable(k, batchNum, conflictColumns, updateColumns, v); err != nil {
+				return 0, 0, fmt.Errorf("双写%s err:%s", k, err)
+			}
+		}
+	}
+	return inserted, updated, nil
+}
+
+//内部方法：单个表分批插入或更新
+func (tx *Tx) upsertTable(tableName string, batchNum int, conflictColumns []string, updateColumns []string, beans []interface{}) (int64, int64, error) {
+	table, err := tx.dtx.db.TableInfo(beans[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	cols, conflict, update, err := upsertColumns(table, conflictColumns, updateColumns)
+	if err != nil {
+		return 0, 0, err
+	}
+	deleted := table.DeletedColumn()
+
+	_bnum := 1000
+	if batchNum > 0 {
+		_bnum = batchNum
+	}
+	if tx.dtx.Driver == "mssql" && _bnum*len(cols) > mssqlMaxParams {
+		_bnum = mssqlMaxParams / len(cols)
+	}
+
+	//冲突字段包含自增字段时需写入其值
+	identity := false
+	for _, col := range conflict {
+		identity = identity || col.IsAutoIncrement
+	}
+	if identity && tx.dtx.Driver == "mssql" {
+		if _, err = tx.Exec(fmt.Sprintf("SET IDENTITY_INSERT %s ON", tx.dtx.db.Quote(tableName))); err != nil {
+			return 0, 0, err
+		}
+		defer tx.Exec(fmt.Sprintf("SET IDENTITY_INSERT %s OFF", tx.dtx.db.Quote(tableName)))
+	}
+
+	var inserted, updated int64
+	for j := 0; j < len(beans); j += _bnum {
+		end := j + _bnum
+		if end > len(beans) {
+			end = len(beans)
+		}
+		i, u, err := tx.upsertBatch(tableName, cols, conflict, update, deleted, beans[j:end])
+		if err != nil {
+			return 0, 0, errors.New("Upsert err:" + err.Error())
+		}
+		inserted += i
+		updated += u
+	}
+	return inserted, updated, nil
+}
+
+//内部方法：执行一批插入或更新，postgres和mssql由语句返回每行的操作，mysql按RowsAffected推算，sqlite先统计已存在的冲突值
+func (tx *Tx) upsertBatch(tableName string, cols, conflict, update []*schemas.Column, deleted *schemas.Column, beans []interface{}) (int64, int64, error) {
+	args := make([]interface{}, 0, len(beans)*len(cols))
+	for _, bean := range beans {
+		v := reflect.ValueOf(bean)
+		for v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		for _, col := range cols {
+			arg, err := upsertValue(col, &v)
+			if err != nil {
+				return 0, 0, err
+			}
+			args = append(args, arg)
+		}
+	}
+
+	n := int64(len(beans))
+	sql := tx.dtx.upsertSql(tableName, cols, conflict, update, deleted, len(beans))
+	switch tx.dtx.Driver {
+	case "postgres", "mssql":
+		session, done := tx.stmt()
+		defer done()
+		rows, err := session.SQL(sql, args...).QueryString()
+		if err != nil {
+			return 0, 0, err
+		}
+		var inserted int64
+		for _, row := range rows {
+			if row["action"] == "INSERT" {
+				inserted++
+			}
+		}
+		return inserted, int64(len(rows)) - inserted, nil
+
+	case "mysql":
+		affected, err := tx.Exec(sql, args...)
+		if err != nil {
+			return 0, 0, err
+		}
+		//无更新字段时已存在的记录不修改，RowsAffected即插入数量
+		if len(update) == 0 {
+			return affected, n - affected, nil
+		}
+		//插入计1，更新计2
+		updated := affected - n
+		if updated < 0 {
+			updated = 0
+		}
+		return n - updated, updated, nil
+	}
+
+	//sqlite写事务独占数据库，统计与执行之间不会有其他写入
+	inserted, err := tx.countMissing(tableName, cols, conflict, args, len(beans))
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err = tx.Exec(sql, args...); err != nil {
+		return 0, 0, err
+	}
+	return inserted, n - inserted, nil
+}
+
+//内部方法：统计不存在的冲突值数量（批内重复的冲突值只插入一次），即插入数量
+func (tx *Tx) countMissing(tableName string, cols, conflict []*schemas.Column, args []interface{}, rows int) (int64, error) {
+	quote := tx.dtx.db.Quote
+	idx := make([]int, len(conflict))
+	conds := make([]string, len(conflict))
+	for i, c := range conflict {
+		for j, col := range cols {
+			if col == c {
+				idx[i] = j
+			}
+		}
+		conds[i] = quote(c.Name) + "=?"
+	}
+	cond := "(" + strings.Join(conds, " AND ") + ")"
+
+	var where []string
+	keys := make([]interface{}, 0, rows*len(conflict))
+	seen := make(map[string]bool, rows)
+	for r := 0; r < rows; r++ {
+		key := make([]interface{}, len(idx))
+		for k, i := range idx {
+			key[k] = args[r*len(cols)+i]
+		}
+		if s := fmt.Sprint(key...); !seen[s] {
+			seen[s] = true
+			where = append(where, cond)
+			keys = append(keys, key...)
+		}
+	}
+
+	session, done := tx.stmt()
+	defer done()
+	var existed int64
+	_, err := session.SQL(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", quote(tableName), strings.Join(where, " OR ")), keys...).Get(&existed)
+	return int64(len(where)) - existed, err
+}
+
+//内部方法：插入或更新SQL，有更新字段时恢复软删除的记录
+func (dtx DbContext) upsertSql(tableName string, cols, conflict, update []*schemas.Column, deleted *schemas.Column, rows int) string {
+	quote := dtx.db.Quote
+	names := make([]string, len(cols))
+	for i, col := range cols {
+		names[i] = quote(col.Name)
+	}
+	values := make([]string, rows)
+	for i := range values {
+		values[i] = "(" + placeholders(len(cols)) + ")"
+	}
+	//更新时版本字段加1
+	var version *schemas.Column
+	for _, col := range cols {
+		if col.IsVersion {
+			version = col
+		}
+	}
+
+	var sets []string
+	switch dtx.Driver {
+	case "mssql":
+		on := make([]string, len(conflict))
+		for i, col := range conflict {
+			on[i] = "T." + quote(col.Name) + "=S." + quote(col.Name)
+		}
+		src := make([]string, len(cols))
+		for i, name := range names {
+			src[i] = "S." + name
+		}
+		for _, col := range update {
+			sets = append(sets, "T."+quote(col.Name)+"=S."+quote(col.Name))
+		}
+		if deleted != nil && len(sets) > 0 {
+			sets = append(sets, "T."+quote(deleted.Name)+"="+undeletedValue(deleted))
+		}
+		if version != nil && len(sets) > 0 {
+			sets = append(sets, "T."+quote(version.Name)+"=T."+quote(version.Name)+"+1")
+		}
+		matched := ""
+		if len(sets) > 0 {
+			matched = " WHEN MATCHED THEN UPDATE SET " + strings.Join(sets, ",")
+		}
+		return fmt.Sprintf("MERGE INTO %s WITH (HOLDLOCK) AS T USING (VALUES %s) AS S (%s) ON %s%s WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s) OUTPUT $action AS action;",
+			quote(tableName), strings.Join(values, ","), strings.Join(names, ","), strings.Join(on, " AND "), matched, strings.Join(names, ","), strings.Join(src, ","))
+
+	case "mysql":
+		for _, col := range update {
+			sets = append(sets, quote(col.Name)+"=VALUES("+quote(col.Name)+")")
+		}
+		if deleted != nil && len(sets) > 0 {
+			sets = append(sets, quote(deleted.Name)+"="+undeletedValue(deleted))
+		}
+		if version != nil && len(sets) > 0 {
+			sets = append(sets, quote(version.Name)+"="+quote(version.Name)+"+1")
+		}
+		if len(sets) == 0 {
+			sets = append(sets, quote(conflict[0].Name)+"="+quote(conflict[0].Name))
+		}
+		return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s ON DUPLICATE KEY UPDATE %s",
+			quote(tableName), strings.Join(names, ","), strings.Join(values, ","), strings.Join(sets, ","))
+	}
+
+	keys := make([]string, len(conflict))
+	for i, col := range conflict {
+		keys[i] = quote(col.Name)
+	}
+	for _, col := range update {
+		sets = append(sets, quote(col.Name)+"=EXCLUDED."+quote(col.Name))
+	}
+	if deleted != nil && len(sets) > 0 {
+		sets = append(sets, quote(deleted.Name)+"="+undeletedValue(deleted))
+	}
+	if version != nil && len(sets) > 0 {
+		sets = append(sets, quote(version.Name)+"="+quote(tableName)+"."+quote(version.Name)+"+1")
+	}
+	action := "DO NOTHING"
+	if len(sets) > 0 {
+		action = "DO UPDATE SET " + strings.Join(sets, ",")
+	}
+	sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s ON CONFLICT (%s) %s",
+		quote(tableName), strings.Join(names, ","), strings.Join(values, ","), strings.Join(keys, ","), action)
+	if dtx.Driver == "postgres" {
+		//xmax为0的行为新插入的行
+		sql += " RETURNING CASE WHEN xmax = 0 THEN 'INSERT' ELSE 'UPDATE' END AS action"
+	}
+	return sql
+}
+
+//内部方法：插入字段（不含自增字段和软删除字段，冲突字段除外）、冲突字段和更新字段
+func upsertColumns(table *schemas.Table, conflictColumns []string, updateColumns []string) (cols, conflict, update []*schemas.Column, err error) {
+	isConflict := make(map[*schemas.Column]bool)
+	for _, name := range conflictColumns {
+		col := table.GetColumn(name)
+		if col == nil {
+			return nil, nil, nil, fmt.Errorf("%s不存在字段%s", table.Name, name)
+		}
+		conflict = append(conflict, col)
+		isConflict[col] = true
+	}
+
+	for _, col := range table.Columns() {
+		if col.IsAutoIncrement && !isConflict[col] || col.IsDeleted {
+			continue
+		}
+		cols = append(cols, col)
+	}
+
+	if len(updateColumns) == 0 {
+		for _, col := range cols {
+			if !isConflict[col] && !col.IsPrimaryKey && !col.IsAutoIncrement && !col.IsCreated && !col.IsVersion && !isCreatedField(col.FieldName) {
+				update = append(update, col)
+			}
+		}
+		return cols, conflict, update, nil
+	}
+	for _, name := range updateColumns {
+		col := table.GetColumn(name)
+		if col == nil {
+			return nil, nil, nil, fmt.Errorf("%s不存在字段%s", table.Name, name)
+		}
+		if isConflict[col] || col.IsAutoIncrement || col.IsVersion {
+			return nil, nil, nil, fmt.Errorf("%s不能作为更新字段", name)
+		}
+		update = append(update, col)
+	}
+	return cols, conflict, update, nil
+}
+
+//内部方法：字段的入库值，created/updated字段为零值时取当前时间，version字段为1，json字段序列化
+func upsertValue(col *schemas.Column, v *reflect.Value) (interface{}, error) {
+	field, err := col.ValueOfV(v)
+	if err != nil {
+		return nil, err
+	}
+	if !field.IsValid() {
+		return nil, nil
+	}
+	if (col.IsCreated || col.IsUpdated) && field.Type() == reflect.TypeOf(time.Time{}) && field.Interface().(time.Time).IsZero() {
+		return time.Now(), nil
+	}
+	//新插入记录的版本为1，与xorm一致
+	if col.IsVersion {
+		return 1, nil
+	}
+
+	value := field.Interface()
+	if c, ok := value.(convert.Conversion); ok {
+		if field.Kind() == reflect.Ptr && field.IsNil() {
+			return nil, nil
+		}
+		b, err := c.ToDB()
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+	if _, ok := value.(driver.Valuer); ok {
+		return value, nil
+	}
+	if col.IsJSON || col.SQLType.IsJson() {
+		b, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+	return value, nil
+}
@@ -0,0 +1,61 @@
+package sql_test
+
+import (
+	"testing"
+
+	"github.com/maclon-lee/golanglib/lib/sql"
+)
+
+type upsertItem struct {
+	Code                string `xorm:"pk varchar(32) 'Code'"`
+	Stock               int    `xorm:"'Stock'"`
+	sql.SoftDeleteModel `xorm:"extends"`
+}
+
+func (upsertItem) TableName() string {
+	return "upsert_item"
+}
+
+func TestUpsertCounts(t *testing.T) {
+	dtx := newSqlite(t, nil, upsertItem{})
+
+	inserted, updated, err := dtx.Upsert([]string{"Code"}, nil, &upsertItem{Code: "a", Stock: 1}, &upsertItem{Code: "b", Stock: 1})
+	if err != nil || inserted != 2 || updated != 0 {
+		t.Fatalf("first upsert = %d, %d, %v", inserted, updated, err)
+	}
+
+	//批内重复的冲突值只插入一次，后出现的计为更新
+	inserted, updated, err = dtx.Upsert([]string{"Code"}, []string{"Stock"},
+		&upsertItem{Code: "a", Stock: 5}, &upsertItem{Code: "c", Stock: 1}, &upsertItem{Code: "c", Stock: 7})
+	if err != nil || inserted != 1 || updated != 2 {
+		t.Fatalf("second upsert = %d, %d, %v", inserted, updated, err)
+	}
+	for code, stock := range map[string]int{"a": 5, "b": 1, "c": 7} {
+		var item upsertItem
+		if err = dtx.Get(&item, code); err != nil || item.Stock != stock {
+			t.Errorf("%s stock = %d, %v, want %d", code, item.Stock, err, stock)
+		}
+	}
+}
+
+func TestUpsertRestoresSoftDeleted(t *testing.T) {
+	dtx := newSqlite(t, nil, upsertItem{})
+	if _, _, err := dtx.Upsert([]string{"Code"}, nil, &upsertItem{Code: "a", Stock: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dtx.Delete("", &upsertItem{Code: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	var item upsertItem
+	if err := dtx.Get(&item, "a"); err != nil || item.Code != "" {
+		t.Fatalf("deleted item visible: %+v, %v", item, err)
+	}
+
+	inserted, updated, err := dtx.Upsert([]string{"Code"}, []string{"Stock"}, &upsertItem{Code: "a", Stock: 3})
+	if err != nil || inserted != 0 || updated != 1 {
+		t.Fatalf("upsert = %d, %d, %v", inserted, updated, err)
+	}
+	if err = dtx.Get(&item, "a"); err != nil || item.Stock != 3 || item.IsDeleted() {
+		t.Errorf("restored item = %+v, %v", item, err)
+	}
+}
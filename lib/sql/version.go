@@ -0,0 +1,139 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+//乐观锁冲突：带版本字段（xorm标签version）的实体更新时版本不匹配，记录已被修改或删除
+type StaleObjectError struct {
+	Table   string      //表名
+	Version interface{} //更新时实体的版本值
+}
+
+func (e *StaleObjectError) Error() string {
+	return fmt.Sprintf("%s记录已被修改或删除，版本:%v", e.Table, e.Version)
+}
+
+//用于errors.Is(err, ErrStaleObject)判断
+func (e *StaleObjectError) Is(target error) bool {
+	return target == ErrStaleObject
+}
+
+//乐观锁冲突错误，Update返回的错误为*StaleObjectError
+var ErrStaleObject error = &StaleObjectError{}
+
+//实体版本字段更新前的值
+type versionLock struct {
+	field reflect.Value
+	old   reflect.Value
+}
+
+//内部方法：记录实体版本字段的值，实体为struct指针且定义了version字段时有效，否则为nil
+func (dtx DbContext) versionLock(entity interface{}) *versionLock {
+	v := reflect.ValueOf(entity)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	table, err := dtx.db.TableInfo(entity)
+	if err != nil || table.Version == "" {
+		return nil
+	}
+	field, err := table.VersionColumn().ValueOf(entity)
+	if err != nil || !field.CanSet() {
+		return nil
+	}
+	old := reflect.New(field.Type()).Elem()
+	old.Set(*field)
+	return &versionLock{field: *field, old: old}
+}
+
+//内部方法：更新数量为0时恢复实体的版本值（xorm执行成功即加1）并返回StaleObjectError
+func (l *versionLock) check(tableName string, n int64, err error) (int64, error) {
+	if l == nil || err != nil || n > 0 {
+		return n, err
+	}
+	l.restore()
+	return 0, &StaleObjectError{Table: tableName, Version: l.old.Interface()}
+}
+
+//内部方法：恢复实体更新前的版本值
+func (l *versionLock) restore() {
+	if l != nil {
+		l.field.Set(l.old)
+	}
+}
+
+//内部方法：以更新前的版本值执行fn（双写新分表），完成后恢复为更新后的版本值
+func (l *versionLock) rewind(fn func() error) error {
+	if l == nil {
+		return fn()
+	}
+	cur := reflect.New(l.field.Type()).Elem()
+	cur.Set(l.field)
+	l.field.Set(l.old)
+	defer l.field.Set(cur)
+	return fn()
+}
+
+/*
+* 乐观锁更新重试：按主键读取记录，调用apply修改后更新，版本冲突时重新读取并重试
+* 实体须定义version字段，更新规则同Update（只更新非零值字段）
+*
+* param  ctx       上下文
+* param  attempts  最多尝试次数，默认3
+* param  entity    数据对象指针，每次尝试前按主键重新读取
+* param  apply     修改函数，对entity进行修改，返回错误时停止并返回该错误
+* param  id        主键值
+*
+* return 更新成功数量，重试后仍冲突时返回StaleObjectError
+ */
+func (dtx DbContext) RetryUpdate(ctx context.Context, attempts int, entity interface{}, apply func() error, id ...interface{}) (int64, error) {
+	v := reflect.ValueOf(entity)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return 0, errors.New("entity必须为struct指针")
+	}
+	table, err := dtx.db.TableInfo(entity)
+	if err != nil {
+		return 0, err
+	}
+	if table.Version == "" {
+		return 0, fmt.Errorf("%s未定义version字段", table.Name)
+	}
+	if len(table.PrimaryKeys) != len(id) {
+		return 0, fmt.Errorf("%s的主键数量为%d", table.Name, len(table.PrimaryKeys))
+	}
+	condi := make(map[string]interface{}, len(id))
+	for i, pk := range table.PrimaryKeys {
+		condi[pk] = id[i]
+	}
+	if attempts <= 0 {
+		attempts = 3
+	}
+
+	primary := dtx.UsePrimary()
+	for i := 0; ; i++ {
+		if err = ctx.Err(); err != nil {
+			return 0, err
+		}
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+		has, err := primary.get(ctx, entity, id...)
+		if err != nil {
+			return 0, err
+		}
+		if !has {
+			return 0, fmt.Errorf("%s记录不存在:%v", table.Name, id)
+		}
+		if err = apply(); err != nil {
+			return 0, err
+		}
+
+		n, err := primary.UpdateContext(ctx, "", entity, condi)
+		if !errors.Is(err, ErrStaleObject) || i+1 >= attempts {
+			return n, err
+		}
+		log.Debugf("%s版本冲突，第%d次重试", table.Name, i+1)
+	}
+}
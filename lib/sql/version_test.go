@@ -0,0 +1,101 @@
+package sql_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/maclon-lee/golanglib/lib/sql"
+)
+
+type versionedItem struct {
+	Id      int64  `xorm:"pk 'Id'"`
+	Name    string `xorm:"'Name'"`
+	Version int    `xorm:"version 'Version'"`
+}
+
+func (versionedItem) TableName() string {
+	return "versioned_item"
+}
+
+func TestUpdateStaleObject(t *testing.T) {
+	dtx := newSqlite(t, nil, versionedItem{})
+	if _, err := dtx.Inserts(&versionedItem{Id: 1, Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var a, b versionedItem
+	if err := dtx.Get(&a, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := dtx.Get(&b, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	a.Name = "b"
+	if n, err := dtx.Update("", &a, versionedItem{Id: 1}); err != nil || n != 1 {
+		t.Fatalf("first update: %d, %v", n, err)
+	}
+	version := b.Version
+	b.Name = "c"
+	_, err := dtx.Update("", &b, versionedItem{Id: 1})
+	if !errors.Is(err, sql.ErrStaleObject) {
+		t.Fatalf("second update: got %v, want ErrStaleObject", err)
+	}
+	if b.Version != version {
+		t.Errorf("version not restored: got %d, want %d", b.Version, version)
+	}
+
+	//BatchExec的更新同样检查版本，冲突时整批回滚并恢复版本值
+	c := versionedItem{Id: 1, Name: "d", Version: a.Version}
+	_, err = dtx.BatchExec([]sql.BatchSqlReq{
+		{Mode: 2, Bean: &c, Condi: versionedItem{Id: 1}},
+		{Mode: 2, Bean: &b, Condi: versionedItem{Id: 1}},
+	})
+	if !errors.Is(err, sql.ErrStaleObject) {
+		t.Fatalf("BatchExec: got %v, want ErrStaleObject", err)
+	}
+	if c.Version != a.Version {
+		t.Errorf("BatchExec version not restored: got %d, want %d", c.Version, a.Version)
+	}
+	var got versionedItem
+	if err = dtx.Get(&got, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "b" || got.Version != a.Version {
+		t.Errorf("BatchExec not rolled back: %+v", got)
+	}
+}
+
+func TestRetryUpdate(t *testing.T) {
+	dtx := newSqlite(t, nil, versionedItem{})
+	if _, err := dtx.Inserts(&versionedItem{Id: 1, Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	//第一次修改前记录被其他写入修改，重试后成功
+	var item versionedItem
+	attempts := 0
+	n, err := dtx.RetryUpdate(ctx, 3, &item, func() error {
+		attempts++
+		if attempts == 1 {
+			other := versionedItem{Name: "other", Version: item.Version}
+			if _, err := dtx.Update("", &other, versionedItem{Id: 1}); err != nil {
+				return err
+			}
+		}
+		item.Name = "retried"
+		return nil
+	}, int64(1))
+	if err != nil || n != 1 {
+		t.Fatalf("RetryUpdate: %d, %v", n, err)
+	}
+	if attempts != 2 {
+		t.Errorf("attempts: got %d, want 2", attempts)
+	}
+
+	if _, err = dtx.RetryUpdate(ctx, 3, &item, func() error { return nil }, int64(2)); err == nil {
+		t.Error("missing row should fail")
+	}
+}
@@ -1,13 +1,18 @@
 package utility
 
 import (
+	"database/sql/driver"
+	"encoding/binary"
 	"fmt"
 	"hash/crc32"
+	"math/bits"
 	"reflect"
+	"strconv"
 	"time"
 )
 
 //计算hashcode，目前只支持int，string等基础类型
+//int64截断为int32、时间取秒，仅用于兼容已有分表（分表策略为空时），新分表请使用lib/sql中的命名策略
 func GetHashcode(v interface{}) int32 {
 	switch t := v.(type) {
 	case int:
@@ -50,3 +55,123 @@ func GetStringCode(str string) int32 {
 	}
 	return 0
 }
+
+/*
+* 分表哈希的规范字节表示，不同类型的相同值（如int64(5)和"5"）结果一致
+* 整数为十进制字符串，时间为UTC的RFC3339Nano，字符串和[]byte为原值
+*
+* param  v  字段值，支持指针、reflect.Value、driver.Valuer（如null.Int、sql.NullInt64）
+* return 字节表示，值为nil或无效（如null.Int{Valid:false}）时ok为false
+ */
+func HashBytes(v interface{}) (data []byte, ok bool) {
+	v, ok = HashValue(v)
+	if !ok {
+		return nil, false
+	}
+
+	switch t := v.(type) {
+	case []byte:
+		return t, true
+	case string:
+		return []byte(t), true
+	case bool:
+		return []byte(strconv.FormatBool(t)), true
+	case time.Time:
+		return []byte(t.UTC().Format(time.RFC3339Nano)), true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return []byte(strconv.FormatInt(rv.Int(), 10)), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return []byte(strconv.FormatUint(rv.Uint(), 10)), true
+	case reflect.Float32, reflect.Float64:
+		return []byte(strconv.FormatFloat(rv.Float(), 'g', -1, 64)), true
+	case reflect.String:
+		return []byte(rv.String()), true
+	}
+	return []byte(fmt.Sprintf("%v", v)), true
+}
+
+/*
+* 取出字段的原值，用于区分零值和未提供的值
+*
+* param  v  字段值，支持指针、reflect.Value、driver.Valuer（如null.Int、sql.NullInt64）
+* return 原值，值为nil、空指针、无效的reflect.Value或driver.Valuer返回nil时ok为false
+ */
+func HashValue(v interface{}) (interface{}, bool) {
+	if rv, isValue := v.(reflect.Value); isValue {
+		if !rv.IsValid() || !rv.CanInterface() {
+			return nil, false
+		}
+		v = rv.Interface()
+	}
+	if v == nil {
+		return nil, false
+	}
+	if valuer, isValuer := v.(driver.Valuer); isValuer {
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return nil, false
+		}
+		val, err := valuer.Value()
+		if err != nil || val == nil {
+			return nil, false
+		}
+		return val, true
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, false
+		}
+		return HashValue(rv.Elem().Interface())
+	}
+	return v, true
+}
+
+//MurmurHash3 x86 32位
+func Murmur3(data []byte, seed uint32) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+	h := seed
+	n := len(data) / 4
+	for i := 0; i < n; i++ {
+		k := binary.LittleEndian.Uint32(data[i*4:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	var k uint32
+	tail := data[n*4:]
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
@@ -30,3 +30,41 @@ func TestConvToIntBykey(t *testing.T) {
 	t.Log(ok)
 
 }
+
+func TestMurmur3(t *testing.T) {
+	cases := []struct {
+		data string
+		seed uint32
+		want uint32
+	}{
+		{"", 0, 0},
+		{"", 1, 0x514e28b7},
+		{"a", 0, 0x3c2569b2},
+		{"abcd", 0x9747b28c, 0xf0478627},
+		{"Hello, world!", 0x9747b28c, 0x24884cba},
+	}
+	for _, c := range cases {
+		if got := Murmur3([]byte(c.data), c.seed); got != c.want {
+			t.Errorf("Murmur3(%q, %x) = %x, want %x", c.data, c.seed, got, c.want)
+		}
+	}
+}
+
+func TestHashBytes(t *testing.T) {
+	var nilPtr *int64
+	zero := int64(0)
+	if _, ok := HashBytes(nilPtr); ok {
+		t.Error("nil pointer should be missing")
+	}
+	if _, ok := HashBytes(reflect.Value{}); ok {
+		t.Error("invalid value should be missing")
+	}
+	if b, ok := HashBytes(&zero); !ok || string(b) != "0" {
+		t.Errorf("zero = %q %v", b, ok)
+	}
+	a, _ := HashBytes(int64(1) << 40)
+	b, _ := HashBytes("1099511627776")
+	if string(a) != string(b) {
+		t.Errorf("int64 = %q, string = %q", a, b)
+	}
+}